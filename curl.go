@@ -0,0 +1,237 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// curlCommand is a request described by a curl command line.
+type curlCommand struct {
+	method   string
+	url      string
+	header   http.Header
+	body     []byte
+	username string
+	password string
+}
+
+// curlIgnored are curl options without arguments that do not change
+// the request hey makes.
+var curlIgnored = map[string]bool{
+	"--compressed": true,
+	"-k":           true,
+	"--insecure":   true,
+	"-s":           true,
+	"--silent":     true,
+	"-S":           true,
+	"--show-error": true,
+	"-L":           true,
+	"--location":   true,
+	"-v":           true,
+	"--verbose":    true,
+	"-i":           true,
+	"--include":    true,
+}
+
+// parseCurl parses a curl command line, such as the ones copied with
+// "Copy as cURL" from browser developer tools. It supports -X, -H, -d,
+// --data-raw, --data-binary, -u, -A, -b and -I.
+func parseCurl(cmd string) (*curlCommand, error) {
+	args, err := splitShellWords(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+	c := &curlCommand{header: make(http.Header)}
+	var data []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			if c.url != "" {
+				return nil, fmt.Errorf("curl: more than one URL: %q", arg)
+			}
+			c.url = arg
+			continue
+		}
+		if curlIgnored[arg] {
+			continue
+		}
+		if arg == "-I" || arg == "--head" {
+			c.method = "HEAD"
+			continue
+		}
+		// Options with a value, either as the next argument or,
+		// for short options, attached as in -XPOST.
+		name, value := arg, ""
+		if !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			name, value = arg[:2], arg[2:]
+		} else {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("curl: missing value for %s", arg)
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "-X", "--request":
+			c.method = strings.ToUpper(value)
+		case "-H", "--header":
+			parts := strings.SplitN(value, ":", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+				return nil, fmt.Errorf("curl: invalid header %q", value)
+			}
+			c.header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		case "-d", "--data", "--data-ascii", "--data-binary":
+			if strings.HasPrefix(value, "@") {
+				b, err := ioutil.ReadFile(value[1:])
+				if err != nil {
+					return nil, err
+				}
+				value = string(b)
+				if name != "--data-binary" {
+					value = strings.Replace(strings.Replace(value, "\r", "", -1), "\n", "", -1)
+				}
+			}
+			data = append(data, value)
+		case "--data-raw":
+			data = append(data, value)
+		case "-u", "--user":
+			parts := strings.SplitN(value, ":", 2)
+			c.username = parts[0]
+			if len(parts) == 2 {
+				c.password = parts[1]
+			}
+		case "-A", "--user-agent":
+			c.header.Set("User-Agent", value)
+		case "-b", "--cookie":
+			c.header.Add("Cookie", value)
+		case "--url":
+			c.url = value
+		default:
+			return nil, fmt.Errorf("curl: unsupported option %s", arg)
+		}
+	}
+	if c.url == "" {
+		return nil, errors.New("curl: no URL specified")
+	}
+	if data != nil {
+		c.body = []byte(strings.Join(data, "&"))
+		if c.method == "" {
+			c.method = "POST"
+		}
+		if c.header.Get("Content-Type") == "" {
+			c.header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if c.method == "" {
+		c.method = "GET"
+	}
+	return c, nil
+}
+
+// target returns the URL and method of the request, with method instead
+// of the one of the command if methodSet, as when -m is given. The
+// command names the URL, so args, the URL arguments, must be empty.
+func (c *curlCommand) target(args []string, method string, methodSet bool) (string, string, error) {
+	if len(args) > 0 {
+		return "", "", errors.New("-curl cannot be used with a <url> argument.")
+	}
+	if !methodSet {
+		method = c.method
+	}
+	return c.url, method, nil
+}
+
+// splitShellWords splits s into words the way a POSIX shell would,
+// honoring single quotes, double quotes, $'...' strings and backslash
+// escapes, including line continuations.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word []byte
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = word[:0], false
+			}
+		case ch == '\\':
+			i++
+			if i < len(s) && s[i] != '\n' {
+				word, inWord = append(word, s[i]), true
+			}
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("curl: unterminated single quote")
+			}
+			word, inWord = append(word, s[i+1:i+1+end]...), true
+			i += end + 1
+		case ch == '$' && i+1 < len(s) && s[i+1] == '\'':
+			i += 2
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					switch s[i] {
+					case 'n':
+						word = append(word, '\n')
+					case 't':
+						word = append(word, '\t')
+					case 'r':
+						word = append(word, '\r')
+					default:
+						word = append(word, s[i])
+					}
+					continue
+				}
+				word = append(word, s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("curl: unterminated $' quote")
+			}
+			inWord = true
+		case ch == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word = append(word, s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("curl: unterminated double quote")
+			}
+			inWord = true
+		default:
+			word, inWord = append(word, ch), true
+		}
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseCurl(t *testing.T) {
+	cmd := `curl 'https://example.com/api?x=1' \
+  -X PUT \
+  -H 'Content-Type: application/json' \
+  -H "X-Quoted: \"a b\"" \
+  --data-raw $'{"msg":"it\'s\\n"}' \
+  -u gopher:pa:ss \
+  --compressed`
+	c, err := parseCurl(cmd)
+	if err != nil {
+		t.Fatalf("parseCurl errored: %v", err)
+	}
+	if got, want := c.url, "https://example.com/api?x=1"; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got, want := c.method, "PUT"; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got, want := c.header.Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got, want := c.header.Get("X-Quoted"), `"a b"`; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got, want := string(c.body), "{\"msg\":\"it's\\n\"}"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if c.username != "gopher" || c.password != "pa:ss" {
+		t.Errorf("got %v:%v; want gopher:pa:ss", c.username, c.password)
+	}
+}
+
+func TestParseCurlData(t *testing.T) {
+	c, err := parseCurl(`curl -d a=1 -d b=2 http://example.com`)
+	if err != nil {
+		t.Fatalf("parseCurl errored: %v", err)
+	}
+	if got, want := c.method, "POST"; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got, want := string(c.body), "a=1&b=2"; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got, want := c.header.Get("Content-Type"), "application/x-www-form-urlencoded"; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestParseInvalidCurl(t *testing.T) {
+	for _, cmd := range []string{
+		`curl -X POST`,
+		`curl 'http://example.com`,
+		`curl --unknown-option x http://example.com`,
+		`curl -H nocolon http://example.com`,
+	} {
+		if _, err := parseCurl(cmd); err == nil {
+			t.Errorf("%q: expected an error, found none", cmd)
+		}
+	}
+}
+
+func TestCurlTarget(t *testing.T) {
+	c, err := parseCurl(`curl -X PUT http://example.com/a`)
+	if err != nil {
+		t.Fatalf("parseCurl errored: %v", err)
+	}
+	url, method, err := c.target(nil, "GET", false)
+	if err != nil {
+		t.Fatalf("target errored: %v", err)
+	}
+	if url != "http://example.com/a" || method != "PUT" {
+		t.Errorf("got %v %v; want PUT http://example.com/a", method, url)
+	}
+	// An explicit -m overrides the method of the command.
+	if _, method, _ = c.target(nil, "DELETE", true); method != "DELETE" {
+		t.Errorf("got %v; want DELETE", method)
+	}
+	// The command names the URL.
+	if _, _, err := c.target([]string{"http://example.com/b"}, "GET", false); err == nil {
+		t.Error("expected an error for a <url> argument, found none")
+	}
+}
@@ -16,6 +16,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -26,6 +27,7 @@ import (
 	"os/signal"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,7 +37,8 @@ import (
 const (
 	headerRegexp = `^([\w-]+):\s*(.+)`
 	authRegexp   = `^(.+):([^\s].+)`
-	heyUA        = "hey/0.0.1"
+	formRegexp   = `^([^=]+)=(.*)$`
+	targetRegexp = `^(\d+)\s+(?:([A-Za-z]+)\s+)?(\S+)(?:\s+(.*))?$`
 )
 
 var (
@@ -44,11 +47,39 @@ var (
 	body        = flag.String("d", "", "")
 	bodyFile    = flag.String("D", "", "")
 	accept      = flag.String("A", "", "")
-	contentType = flag.String("T", "text/html", "")
+	contentType = flag.String("T", "", "")
 	authHeader  = flag.String("a", "", "")
+	digestAuth  = flag.String("digest", "", "")
+	ntlmAuth    = flag.String("ntlm", "", "")
 	hostHeader  = flag.String("host", "", "")
+	headerFile  = flag.String("header-file", "", "")
+	curlCmd     = flag.String("curl", "", "")
 
-	output = flag.String("o", "", "")
+	chunkSize  = flag.Int("chunk-size", 0, "")
+	chunkDelay = flag.Duration("chunk-delay", 0, "")
+
+	forceContentLength = flag.Bool("force-content-length", false, "")
+	forceChunked       = flag.Bool("force-chunked", false, "")
+	gzipBody           = flag.Bool("gzip-body", false, "")
+	gzipFallback       = flag.Bool("gzip-fallback", false, "")
+	expectContinue     = flag.Bool("expect-continue", false, "")
+
+	oauth2TokenURL     = flag.String("oauth2-token-url", "", "")
+	oauth2ClientID     = flag.String("oauth2-client-id", "", "")
+	oauth2ClientSecret = flag.String("oauth2-client-secret", "", "")
+	oauth2Scopes       = flag.String("oauth2-scopes", "", "")
+
+	output         = flag.String("o", "", "")
+	outputTemplate = flag.String("output-template", "", "")
+
+	interval       = flag.Duration("interval", 0, "")
+	intervalFormat = flag.String("interval-format", "", "")
+
+	histogramBuckets = flag.String("histogram-buckets", "", "")
+	linearBuckets    = flag.Bool("linear-buckets", false, "")
+
+	baselineFile      = flag.String("baseline", "", "")
+	baselineTolerance = flag.Float64("baseline-tolerance", requester.DefaultBaselineTolerance, "")
 
 	c = flag.Int("c", 50, "")
 	n = flag.Int("n", 200, "")
@@ -56,16 +87,89 @@ var (
 	t = flag.Int("t", 20, "")
 	z = flag.Duration("z", 0, "")
 
-	h2   = flag.Bool("h2", false, "")
-	cpus = flag.Int("cpus", runtime.GOMAXPROCS(-1), "")
+	drainTimeout   = flag.Duration("drain-timeout", 0, "")
+	deadlineHeader = flag.String("deadline-header", "", "")
+
+	h2        = flag.Bool("h2", false, "")
+	h2Conns   = flag.Int("h2-conns", 0, "")
+	h2Streams = flag.Int("h2-streams", 0, "")
+	http10    = flag.Bool("http10", false, "")
+	cpus      = flag.Int("cpus", runtime.GOMAXPROCS(-1), "")
+	debug     = flag.Bool("debug", false, "")
 
 	disableCompression = flag.Bool("disable-compression", false, "")
+	acceptEncoding     = flag.String("accept-encoding", "", "")
 	disableKeepAlives  = flag.Bool("disable-keepalive", false, "")
+	maxConnDuration    = flag.Duration("max-conn-duration", 0, "")
 	disableRedirects   = flag.Bool("disable-redirects", false, "")
+	noDowngrade        = flag.Bool("no-downgrade", false, "")
+	stripRedirectAuth  = flag.Bool("strip-redirect-auth", false, "")
+	readBufferSize     = flag.Int("read-buffer", 0, "")
+	writeBufferSize    = flag.Int("write-buffer", 0, "")
 	proxyAddr          = flag.String("x", "", "")
+	adaptive           = flag.Duration("adaptive", 0, "")
+	prewarmConns       = flag.Int("prewarm", 0, "")
+	reuseAddr          = flag.Bool("reuse-addr", false, "")
+	ipVersion          = flag.String("ip-version", "", "")
+	dnsRoundRobin      = flag.Bool("dns-rr", false, "")
+	handshakeOnly      = flag.Bool("handshake-only", false, "")
+	caFile             = flag.String("cacert", "", "")
+	serverName         = flag.String("sni", "", "")
+	rawMode            = flag.Bool("raw", false, "")
+	pipelineDepth      = flag.Int("pipeline", 0, "")
+	maxInFlight        = flag.Int("max-in-flight", 0, "")
+	maxInFlightDrop    = flag.Bool("max-in-flight-drop", false, "")
+	maxBandwidth       = flag.Int("max-bandwidth", 0, "")
+	checkFDLimit       = flag.Bool("check-fd-limit", true, "")
+	workStealing       = flag.Bool("work-stealing", false, "")
+	startupStagger     = flag.Duration("stagger", 0, "")
+	openModel          = flag.Bool("open", false, "")
+	correctOmission    = flag.Bool("correct-omission", false, "")
+	rateFile           = flag.String("rate-file", "", "")
+	findC              = flag.Bool("find-c", false, "")
+	cacheBust          = flag.Bool("cache-bust", false, "")
+	onlyErrors         = flag.Bool("only-errors", false, "")
+	slowThreshold      = flag.Duration("slow-threshold", 0, "")
+	slowDumpDir        = flag.String("slow-dump-dir", "slow", "")
+	showSlowest        = flag.Int("show-slowest", 0, "")
+	showFastest        = flag.Int("show-fastest", 0, "")
+	apdex              = flag.Duration("apdex", 0, "")
+	cacheBustParam     = flag.String("cache-bust-param", "", "")
+	requestIDHeader    = flag.String("request-id-header", "", "")
+	revalidate         = flag.Bool("revalidate", false, "")
+	circuitBreaker     = flag.Float64("circuit-breaker", 0, "")
+	circuitWindow      = flag.Int("circuit-window", 100, "")
+	maxFailures        = flag.Int("max-failures", 0, "")
+	abortOnBody        = flag.String("abort-on-body", "", "")
+	metricField        = flag.String("metric-field", "", "")
+	maxBodyBytes       = flag.Int64("max-body", 0, "")
+	discardBody        = flag.Bool("discard-body", false, "")
+	sse                = flag.Bool("sse", false, "")
+	sseMax             = flag.Duration("sse-max", 0, "")
+
+	urlFile       = flag.String("url-file", "", "")
+	urlFileRandom = flag.Bool("url-file-random", false, "")
+	harFile       = flag.String("har", "", "")
+	harThinkTime  = flag.Bool("har-think-time", false, "")
+	preserveTime  = flag.Bool("preserve-timing", false, "")
+	timeScale     = flag.Float64("time-scale", 1, "")
+	replayFactor  = flag.Int("replay-factor", 0, "")
+	seed          = flag.Int64("seed", 0, "")
+	dumpSequence  = flag.String("dump-sequence", "", "")
+
+	grpcMethod = flag.String("grpc", "", "")
+	protoset   = flag.String("protoset", "", "")
+	grpcWeb    = flag.String("grpc-web", "", "")
+
+	ws         = flag.Bool("ws", false, "")
+	wsHold     = flag.Duration("ws-hold", 0, "")
+	wsInterval = flag.Duration("ws-interval", 0, "")
 )
 
 var usage = `Usage: hey [options...] <url>
+       hey [options...] -url-file <file>
+       hey [options...] -har <file>
+       hey [options...] -curl <command>
 
 Options:
   -n  Number of requests to run. Default is 200.
@@ -75,28 +179,243 @@ Options:
   -z  Duration of application to send requests. When duration is reached,
       application stops and exits. If duration is specified, n is ignored.
       Examples: -z 10s -z 3m.
+  -drain-timeout  How long to wait for the requests in flight when stopped,
+                  at the end of -z or on interrupt, before canceling them.
+                  Default is to wait for them to complete.
   -o  Output type. If none provided, a summary is printed.
-      "csv" is the only supported alternative. Dumps the response
-      metrics in comma-separated values format.
-
-  -m  HTTP method, one of GET, POST, PUT, DELETE, HEAD, OPTIONS.
+      "csv" dumps the response metrics in comma-separated values
+      format as they complete. "json" prints the summary as JSON.
+  -output-template  File of a Go text/template that formats the summary,
+                    executed with the run statistics (requester.RunStats).
+  -only-errors      Only output the requests that failed or got a 4xx or 5xx
+                    response, as they complete, with their URL, status,
+                    error and response body snippet, in csv or in json
+                    with -o json.
+  -slow-threshold   Capture the requests slower than this, with the status,
+                    headers and body of their response, each to a file of
+                    -slow-dump-dir. For example, -slow-threshold 2s.
+  -slow-dump-dir    Directory of the -slow-threshold captures, created if
+                    needed. Default is slow.
+  -show-slowest     Number of the slowest requests to print in the summary,
+                    with their URL, status and timing breakdown.
+  -show-fastest     Number of the fastest requests to print in the summary.
+  -apdex            Target response time of the Apdex score printed in the
+                    summary. For example, -apdex 500ms.
+  -interval         Write the request rate, error rate and latency
+                    percentiles of each interval while running.
+                    For example, -interval 5s.
+  -interval-format  Format of the interval rows, "csv" (default) or "json".
+  -histogram-buckets  Comma-separated upper bounds of the response time
+                      histogram buckets. For example, 5ms,10ms,50ms,100ms,1s.
+  -linear-buckets     Space the histogram buckets linearly rather than
+                      logarithmically, the default for long-tailed latencies.
+  -baseline         JSON summary of an earlier run, written with -o json, to
+                    compare this run to. Exits with an error if the requests
+                    per second or the p50, p90 or p99 latency are worse by
+                    more than -baseline-tolerance, or if the share of failed
+                    and 5xx requests rose by more than one point.
+  -baseline-tolerance  Allowed relative change, such as 0.1 (default) for 10%%.
+  -tag              Tag of the run, as key=value, such as env=staging, added to
+                    the json output. Repeat for more tags.
+
+  -m  HTTP method, one of GET, POST, PUT, DELETE, HEAD, OPTIONS, or
+      any other method such as PROPFIND or PURGE, which is sent as is.
   -H  Custom HTTP header. You can specify as many as needed by repeating the flag.
       For example, -H "Accept: text/html" -H "Content-Type: application/xml" .
+  -header-file  File of HTTP headers, one "Name: Value" per line. Blank lines
+                and lines starting with # are skipped. -H takes precedence.
   -t  Timeout for each request in seconds. Default is 20, use 0 for infinite.
+  -deadline-header  Header of the requests, such as grpc-timeout or
+                    X-Deadline, that sets their deadline, as in 500m for
+                    grpc-timeout or 500ms for others. Requests past their
+                    deadline are counted apart.
   -A  HTTP Accept header.
   -d  HTTP request body.
   -D  HTTP request body from file. For example, /home/user/file.txt or ./file.txt.
-  -T  Content-type, defaults to "text/html".
+  -F  Multipart form field, as name=value, or file to upload, as name=@path.
+      Repeat for more parts. Files are streamed, and -m defaults to POST.
+  -T  Content-type of request bodies, unless set with -H. Unset by default,
+      as with curl.
   -a  Basic authentication, username:password.
   -x  HTTP Proxy address as host:port.
   -h2 Enable HTTP/2.
+  -h2-conns    Number of HTTP/2 connections to spread the requests over.
+  -h2-streams  Most concurrent streams of each HTTP/2 connection.
+  -http10 Make HTTP/1.0 requests.
 
   -host	HTTP Host header.
+  -digest	Digest authentication, username:password.
+  -ntlm	NTLM authentication, [domain\]username:password. Each worker keeps
+        its own authenticated connection.
+  -curl	A curl command line, such as one copied with "Copy as cURL" from
+        browser developer tools, to take the URL, method, headers and body
+        from, instead of <url>. Other options still apply and -m, -H, -d, -D
+        and -a take precedence.
+  -cacert	PEM file of the root certificates to verify https servers with.
+        Certificates are not verified by default.
+  -sni	TLS server name to send (SNI) instead of the host of <url>.
+
+  -chunk-size   Stream the request body with chunked transfer encoding, in
+                chunks of this many bytes, and report the uploads the server
+                cut off before the whole body was sent.
+  -chunk-delay  Delay between -chunk-size chunks. For example, -chunk-delay 1s.
+  -force-content-length  Always send request bodies with a Content-Length,
+                         even the slow ones of -chunk-size.
+  -force-chunked         Always send request bodies with chunked transfer
+                         encoding, even when their length is known.
+  -expect-continue       Send request bodies only after a 100 Continue
+                         response to an "Expect: 100-continue" header, and
+                         report its round trip.
+  -gzip-body             Send request bodies compressed with gzip.
+  -gzip-fallback         Send -gzip-body requests again uncompressed when the
+                         server answers 415 Unsupported Media Type.
+
+  -oauth2-token-url      OAuth2 token endpoint to get a bearer token from, with
+                         the client credentials grant, for each request. The
+                         token is refreshed before it expires. The certificate
+                         of the endpoint is always verified, against -cacert
+                         if set.
+  -oauth2-client-id      OAuth2 client ID.
+  -oauth2-client-secret  OAuth2 client secret.
+  -oauth2-scopes         Space-separated OAuth2 scopes to request.
+
+  -grpc      Make gRPC unary calls of the method, as package.Service/Method,
+             with the request message in JSON from -d or -D. Plaintext
+             HTTP/2 is used for http:// URLs. The method is looked up with
+             server reflection unless -protoset is set.
+  -protoset  File defining the -grpc method, written by protoc with
+             --include_imports --descriptor_set_out.
+  -grpc-web  Make the -grpc calls gRPC-Web ones, as binary or text, over
+             HTTP/1.1 or, with -h2, HTTP/2.
+
+  -ws           Open WebSocket connections to <url> instead of making
+                requests, and report the handshake failures, dropped
+                connections and message round trips.
+  -ws-hold      How long to hold each WebSocket connection. For example,
+                -ws-hold 30s.
+  -ws-interval  Send the -d or -D body as a message at this interval on
+                each WebSocket connection, expecting a reply to each.
+
+  -url-file         File of targets to request instead of <url>, one per line
+                    as "[@OFFSET] [METHOD] URL [BODY]". Blank lines and lines
+                    starting with # are ignored. Targets are used in order,
+                    repeating. OFFSET is when the request was recorded, such
+                    as @1.5s, for -preserve-timing.
+  -url-file-random  Pick targets from -url-file at random.
+  -target           Endpoint to request with workers of its own instead of
+                    <url>, as "C [METHOD] URL [BODY]", such as
+                    "10 POST http://host/write". Repeat for more targets;
+                    -c is then their total, and each is reported apart.
+                    -q still limits each worker.
+  -har              HAR (HTTP Archive) file to replay instead of <url>.
+  -har-think-time   Wait between HAR entries as long as when they were
+                    recorded.
+  -preserve-timing  Replay -url-file or -har targets on their recorded
+                    schedule, regardless of response times, and report how
+                    closely it was kept.
+  -time-scale       Multiply the recorded delays of -preserve-timing, such
+                    as 0.5 to replay twice as fast. Default is 1.
+  -replay-factor    Make each -url-file or -har target this many requests,
+                    to scale a recorded workload up. -n counts them all.
+  -seed             Seed of -url-file-random, for the same sequence of
+                    requests in every run with -c 1. Default is random.
+  -dump-sequence    File to write the method, URL and body of each request
+                    to, in order, for -url-file to replay the sequence.
 
   -disable-compression  Disable compression.
+  -accept-encoding      Accept-Encoding header to send. Default is gzip
+                        unless compression is disabled. gzip, deflate, br
+                        and zstd responses are decoded to measure them.
   -disable-keepalive    Disable keep-alive, prevents re-use of TCP
                         connections between different HTTP requests.
+  -max-conn-duration    Close connections older than this before their next
+                        request, to model load balancers that limit their
+                        age. For example, -max-conn-duration 30s.
   -disable-redirects    Disable following of HTTP redirects
+  -no-downgrade         Fail requests redirected from https to http.
+  -strip-redirect-auth  Drop the Authorization header on redirects to another
+                        scheme, host or port, as browsers do.
+  -read-buffer          Size in bytes of the read buffer of each HTTP/1.x
+                        connection, such as 65536 for large responses at high
+                        rates. Default is 4096.
+  -write-buffer         Size in bytes of the write buffer of each HTTP/1.x
+                        connection. Default is 4096.
+  -prewarm              Number of connections to establish before starting.
+  -local-addr           Local IP address to make connections from. Repeat to
+                        use several in turn.
+  -reuse-addr           Set SO_REUSEADDR on connections, to reuse local ports
+                        in TIME_WAIT when they run out.
+  -ip-version           Connect over IPv4 only with 4, or IPv6 only with 6,
+                        and report the IP version of the connections. With
+                        auto, report it without restricting connections.
+  -dns-rr               Resolve the host of <url> once and spread connections
+                        over all its addresses in turn, reporting the
+                        requests and connections of each.
+  -handshake-only       Only connect to <url>, with the TLS handshake for
+                        https, and close, without sending requests, and
+                        report the handshake latencies, rate and failures.
+  -raw                  Make requests without the Go HTTP client, writing the
+                        same serialized request and reading only the status
+                        and framing of responses, for servers faster than the
+                        client. Excludes -h2, -http10, -x and most body and
+                        authentication options.
+  -pipeline             Experimental. With -raw, write this many requests at
+                        once on each connection without waiting for responses,
+                        and report the speedup over serial requests.
+  -max-in-flight        Maximum number of requests in flight at once. Requests
+                        over it wait, unless -max-in-flight-drop is set.
+  -max-in-flight-drop   Drop requests over -max-in-flight, and count them.
+  -max-bandwidth        Maximum bytes per second read and written by all the
+                        connections together, to simulate a slow link.
+  -check-fd-limit       Fail if -c and -prewarm exceed the open file limit.
+                        Default is true, use -check-fd-limit=false to skip.
+  -max-body             Maximum number of bytes to read from each response body.
+  -discard-body         Close response bodies without reading them.
+  -sse                  Read responses as server-sent event streams, until
+                        closed, and report the time to the first event,
+                        the gaps between events and the event rate.
+  -sse-max              Maximum duration to read each -sse stream.
+  -open                 Send requests at -q times -c queries per second
+                        regardless of response times, queuing them when all
+                        workers are busy, and report latencies from when they
+                        were scheduled.
+  -rate-file            File of "offset,qps" lines, such as "90s,250", for the
+                        request rate to follow over the run instead of -q.
+  -correct-omission     Also report latencies corrected for coordinated
+                        omission, as if requests had been sent every 1/-q
+                        seconds by each worker while the server stalled.
+  -cache-bust           Append a unique query parameter to each request and
+                        send Cache-Control: no-cache, to get past caches.
+  -cache-bust-param     Name of the -cache-bust query parameter. Default is _cb.
+  -request-id-header    Header to send a unique ID in with each request, such
+                        as X-Request-ID, to find them in the server logs. The
+                        IDs of failures are written with -only-errors.
+  -revalidate           Send the ETag and Last-Modified of earlier responses as
+                        If-None-Match and If-Modified-Since, and report the
+                        share of 304 Not Modified responses.
+  -circuit-breaker      Stop the run early once more than this share of the
+                        last -circuit-window requests failed or got a 5xx
+                        response, such as 0.5. Default is no circuit breaker.
+  -circuit-window       Number of requests of the -circuit-breaker error rate.
+                        Default is 100.
+  -max-failures         Stop the run early once this many requests in a row
+                        failed or got a 5xx response.
+  -abort-on-body        Stop the run as soon as a response body contains this
+                        text, such as an error telling the service is degraded.
+  -metric-field         Report the distribution of this top-level number field
+                        of json response bodies, such as a server-side timing.
+  -work-stealing        Let workers take requests from a shared count of -n
+                        instead of making -n/-c requests each.
+  -stagger              Delay the start of each worker by this much after the
+                        one before, to avoid a burst of connections at the
+                        start. For example, -stagger 10ms.
+  -find-c               Search for the concurrency, up to -c, that gives the
+                        most requests per second without doubling the 90th
+                        percentile latency, making -n requests per try.
+  -adaptive             Adapt concurrency to keep the average latency under
+                        the given target, up to -c workers. For example, -adaptive 200ms.
+  -debug                Log connections, requests, responses and errors
+                        to stderr.
   -cpus                 Number of used cpu cores.
                         (default for current machine is %d cores)
 `
@@ -108,19 +427,43 @@ func main() {
 
 	var hs headerSlice
 	flag.Var(&hs, "H", "")
+	var forms headerSlice
+	flag.Var(&forms, "F", "")
+	var localAddrs headerSlice
+	flag.Var(&localAddrs, "local-addr", "")
+	var tagList headerSlice
+	flag.Var(&tagList, "tag", "")
+	var targetList headerSlice
+	flag.Var(&targetList, "target", "")
 
 	flag.Parse()
-	if flag.NArg() < 1 {
+	if flag.NArg() < 1 && *urlFile == "" && *harFile == "" && *curlCmd == "" && len(targetList) == 0 {
 		usageAndExit("")
 	}
 
 	runtime.GOMAXPROCS(*cpus)
 	num := *n
 	conc := *c
+
+	var targets []requester.Target
+	if len(targetList) > 0 {
+		conc = 0
+		for _, t := range targetList {
+			target, err := parseTarget(t)
+			if err != nil {
+				usageAndExit(err.Error())
+			}
+			targets = append(targets, target)
+			conc += target.C
+		}
+	}
 	q := *q
 	dur := *z
 
 	if dur > 0 {
+		if *findC {
+			usageAndExit("-find-c cannot be used with -z.")
+		}
 		num = math.MaxInt32
 		if conc <= 0 {
 			usageAndExit("-c cannot be smaller than 1.")
@@ -135,12 +478,27 @@ func main() {
 		}
 	}
 
-	url := flag.Args()[0]
+	var url string
+	if flag.NArg() > 0 {
+		url = flag.Args()[0]
+	}
 	method := strings.ToUpper(*m)
 
-	// set content-type
 	header := make(http.Header)
-	header.Set("Content-Type", *contentType)
+
+	var curl *curlCommand
+	if *curlCmd != "" {
+		var err error
+		if curl, err = parseCurl(*curlCmd); err != nil {
+			usageAndExit(err.Error())
+		}
+		if url, method, err = curl.target(flag.Args(), method, isFlagSet("m")); err != nil {
+			usageAndExit(err.Error())
+		}
+		for k, v := range curl.header {
+			header[k] = v
+		}
+	}
 	// set any other additional headers
 	if *headers != "" {
 		usageAndExit("Flag '-h' is deprecated, please use '-H' instead.")
@@ -160,6 +518,9 @@ func main() {
 
 	// set basic auth if set
 	var username, password string
+	if curl != nil {
+		username, password = curl.username, curl.password
+	}
 	if *authHeader != "" {
 		match, err := parseInputWithRegexp(*authHeader, authRegexp)
 		if err != nil {
@@ -167,8 +528,31 @@ func main() {
 		}
 		username, password = match[1], match[2]
 	}
+	var digestUser, digestPassword string
+	if *digestAuth != "" {
+		match, err := parseInputWithRegexp(*digestAuth, authRegexp)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		digestUser, digestPassword = match[1], match[2]
+	}
+
+	var ntlm *requester.NTLMAuth
+	if *ntlmAuth != "" {
+		match, err := parseInputWithRegexp(*ntlmAuth, authRegexp)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		ntlm = &requester.NTLMAuth{User: match[1], Password: match[2]}
+		if i := strings.IndexByte(ntlm.User, '\\'); i >= 0 {
+			ntlm.Domain, ntlm.User = ntlm.User[:i], ntlm.User[i+1:]
+		}
+	}
 
 	var bodyAll []byte
+	if curl != nil {
+		bodyAll = curl.body
+	}
 	if *body != "" {
 		bodyAll = []byte(*body)
 	}
@@ -180,8 +564,33 @@ func main() {
 		bodyAll = slurp
 	}
 
-	if *output != "csv" && *output != "" {
-		usageAndExit("Invalid output type; only csv is supported.")
+	if *output != "csv" && *output != "json" && *output != "" {
+		usageAndExit("Invalid output type; only csv and json are supported.")
+	}
+
+	var parts []requester.MultipartPart
+	for _, f := range forms {
+		match, err := parseInputWithRegexp(f, formRegexp)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if strings.HasPrefix(match[2], "@") {
+			parts = append(parts, requester.MultipartPart{Name: match[1], File: match[2][1:]})
+		} else {
+			parts = append(parts, requester.MultipartPart{Name: match[1], Value: match[2]})
+		}
+	}
+	if len(parts) > 0 && method == "GET" {
+		method = "POST"
+	}
+
+	var summaryTemplate string
+	if *outputTemplate != "" {
+		slurp, err := ioutil.ReadFile(*outputTemplate)
+		if err != nil {
+			errAndExit(err.Error())
+		}
+		summaryTemplate = string(slurp)
 	}
 
 	var proxyURL *gourl.URL
@@ -207,30 +616,181 @@ func main() {
 		req.Host = *hostHeader
 	}
 
-	ua := req.UserAgent()
-	if ua == "" {
-		ua = heyUA
-	} else {
-		ua += " " + heyUA
-	}
-	header.Set("User-Agent", ua)
 	req.Header = header
 
-	w := &requester.Work{
-		Request:            req,
-		RequestBody:        bodyAll,
-		N:                  num,
-		C:                  conc,
-		QPS:                q,
-		Timeout:            *t,
-		DisableCompression: *disableCompression,
-		DisableKeepAlives:  *disableKeepAlives,
-		DisableRedirects:   *disableRedirects,
-		H2:                 *h2,
-		ProxyAddr:          proxyURL,
-		Output:             *output,
+	var tags map[string]string
+	for _, tag := range tagList {
+		match, err := parseInputWithRegexp(tag, formRegexp)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[match[1]] = match[2]
+	}
+
+	var buckets []time.Duration
+	if *histogramBuckets != "" {
+		for _, s := range strings.Split(*histogramBuckets, ",") {
+			d, err := time.ParseDuration(strings.TrimSpace(s))
+			if err != nil {
+				usageAndExit(fmt.Sprintf("invalid histogram bucket %q", s))
+			}
+			buckets = append(buckets, d)
+		}
+	}
+
+	newWork := func(num, conc int) *requester.Work {
+		w := &requester.Work{
+			Request:                req,
+			RequestBody:            bodyAll,
+			HeaderFile:             *headerFile,
+			ContentType:            *contentType,
+			Multipart:              parts,
+			ChunkSize:              *chunkSize,
+			ChunkDelay:             *chunkDelay,
+			ForceContentLength:     *forceContentLength,
+			ForceChunked:           *forceChunked,
+			CompressRequestBody:    *gzipBody,
+			FallbackUncompressed:   *gzipFallback,
+			Expect100Continue:      *expectContinue,
+			N:                      num,
+			C:                      conc,
+			QPS:                    q,
+			Timeout:                *t,
+			DrainTimeout:           *drainTimeout,
+			DeadlineHeader:         *deadlineHeader,
+			DisableCompression:     *disableCompression,
+			AcceptEncoding:         *acceptEncoding,
+			DisableKeepAlives:      *disableKeepAlives,
+			MaxConnDuration:        *maxConnDuration,
+			DisableRedirects:       *disableRedirects,
+			NoDowngradeRedirects:   *noDowngrade,
+			StripCrossOriginAuth:   *stripRedirectAuth,
+			ReadBufferSize:         *readBufferSize,
+			WriteBufferSize:        *writeBufferSize,
+			H2:                     *h2,
+			H2Conns:                *h2Conns,
+			H2MaxConcurrentStreams: *h2Streams,
+			HTTP10:                 *http10,
+			PrewarmConns:           *prewarmConns,
+			LocalAddrs:             localAddrs,
+			ReuseAddr:              *reuseAddr,
+			IPVersion:              *ipVersion,
+			DNSRoundRobin:          *dnsRoundRobin,
+			HandshakeOnly:          *handshakeOnly,
+			CAFile:                 *caFile,
+			ServerName:             *serverName,
+			RawMode:                *rawMode,
+			PipelineDepth:          *pipelineDepth,
+			MaxInFlight:            *maxInFlight,
+			DigestAuthUser:         digestUser,
+			DigestAuthPassword:     digestPassword,
+			NTLMAuth:               ntlm,
+			MaxInFlightDrop:        *maxInFlightDrop,
+			MaxBandwidth:           *maxBandwidth,
+			CheckFDLimit:           *checkFDLimit,
+			WorkStealing:           *workStealing,
+			StartupStagger:         *startupStagger,
+			CacheBust:              *cacheBust,
+			CacheBustParam:         *cacheBustParam,
+			RequestIDHeader:        *requestIDHeader,
+			Revalidate:             *revalidate,
+			OpenModel:              *openModel,
+			CorrectOmission:        *correctOmission,
+			MaxBodyBytes:           *maxBodyBytes,
+			DiscardBodyImmediately: *discardBody,
+			SSE:                    *sse,
+			SSEMaxDuration:         *sseMax,
+			ProxyAddr:              proxyURL,
+			Output:                 *output,
+			SummaryTemplate:        summaryTemplate,
+			Tags:                   tags,
+			Debug:                  *debug,
+			OutputErrorsOnly:       *onlyErrors,
+			SlowThreshold:          *slowThreshold,
+			SlowDumpDir:            *slowDumpDir,
+			ShowSlowest:            *showSlowest,
+			ShowFastest:            *showFastest,
+			ApdexTarget:            *apdex,
+			Interval:               *interval,
+			IntervalFormat:         *intervalFormat,
+			HistogramBuckets:       buckets,
+			LinearBuckets:          *linearBuckets,
+			BaselineFile:           *baselineFile,
+			BaselineTolerance:      *baselineTolerance,
+			URLFile:                *urlFile,
+			Targets:                targets,
+			URLFileRandom:          *urlFileRandom,
+			Seed:                   *seed,
+			DumpSequenceFile:       *dumpSequence,
+			HARFile:                *harFile,
+			ReplayFactor:           *replayFactor,
+			HARThinkTime:           *harThinkTime,
+			PreserveTiming:         *preserveTime,
+			TimeScale:              *timeScale,
+			GRPCMethod:             *grpcMethod,
+			GRPCProtoset:           *protoset,
+			GRPCWeb:                *grpcWeb,
+			MaxConsecutiveFailures: *maxFailures,
+		}
+		if *adaptive > 0 {
+			w.Adaptive = &requester.Adaptive{TargetLatency: *adaptive}
+		}
+		if *oauth2TokenURL != "" {
+			w.OAuth2 = &requester.OAuth2{
+				TokenURL:     *oauth2TokenURL,
+				ClientID:     *oauth2ClientID,
+				ClientSecret: *oauth2ClientSecret,
+				Scopes:       strings.Fields(*oauth2Scopes),
+			}
+		}
+		if *circuitBreaker > 0 {
+			w.CircuitBreaker = &requester.CircuitBreaker{Window: *circuitWindow, ErrorRate: *circuitBreaker}
+		}
+		if *abortOnBody != "" {
+			w.AbortOnResponse = func(resp *http.Response) bool {
+				body, _ := ioutil.ReadAll(resp.Body)
+				return strings.Contains(string(body), *abortOnBody)
+			}
+		}
+		if *metricField != "" {
+			w.ExtractMetric = func(body []byte) (float64, error) {
+				var fields map[string]json.RawMessage
+				if err := json.Unmarshal(body, &fields); err != nil {
+					return 0, err
+				}
+				v, ok := fields[*metricField]
+				if !ok {
+					return 0, fmt.Errorf("no %q field", *metricField)
+				}
+				var n float64
+				err := json.Unmarshal(v, &n)
+				return n, err
+			}
+		}
+		if *ws {
+			w.WebSocket = &requester.WebSocket{Hold: *wsHold, Interval: *wsInterval, Message: bodyAll}
+		}
+		return w
+	}
+
+	var schedule []requester.RatePoint
+	if *rateFile != "" {
+		if schedule, err = requester.LoadRateSchedule(*rateFile); err != nil {
+			errAndExit(err.Error())
+		}
+	}
+
+	if *findC {
+		findConcurrency(newWork, num, conc, schedule)
+		return
 	}
 
+	w := newWork(num, conc)
+	w.RateSchedule = schedule
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	go func() {
@@ -239,23 +799,59 @@ func main() {
 	}()
 	if dur > 0 {
 		go func() {
+			<-w.Started()
 			time.Sleep(dur)
 			w.Stop()
 		}()
 	}
-	w.Run()
+	if err := w.Run(); err != nil {
+		errAndExit(err.Error())
+	}
+}
+
+// findConcurrency runs a concurrency search up to conc, with num requests
+// per run, and prints the trials and the recommended concurrency.
+func findConcurrency(newWork func(num, conc int) *requester.Work, num, conc int, schedule []requester.RatePoint) {
+	f := &requester.ConcurrencyFinder{
+		NewWork: func(c int) *requester.Work {
+			w := newWork(num, c)
+			if w.N < c {
+				w.N = c
+			}
+			w.RateSchedule = schedule
+			return w
+		},
+		MaxC: conc,
+	}
+	best, trials, err := f.Find()
+	if err != nil {
+		errAndExit(err.Error())
+	}
+	fmt.Printf("Concurrency search:\n")
+	for _, t := range trials {
+		fmt.Printf("  %d workers\t%4.4f requests/sec\t%4.4f secs p90\t%d errors\n",
+			t.C, t.RPS, t.Latency.Seconds(), t.Errors)
+	}
+	fmt.Printf("\nRecommended concurrency: %d\n", best)
 }
 
 func errAndExit(msg string) {
-	fmt.Fprintf(os.Stderr, msg)
-	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintln(os.Stderr, msg)
 	os.Exit(1)
 }
 
+// isFlagSet reports whether the flag name was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
 func usageAndExit(msg string) {
 	if msg != "" {
-		fmt.Fprintf(os.Stderr, msg)
-		fmt.Fprintf(os.Stderr, "\n\n")
+		fmt.Fprint(os.Stderr, msg, "\n\n")
 	}
 	flag.Usage()
 	fmt.Fprintf(os.Stderr, "\n")
@@ -271,6 +867,27 @@ func parseInputWithRegexp(input, regx string) ([]string, error) {
 	return matches, nil
 }
 
+// parseTarget parses a -target flag of the form "C [METHOD] URL [BODY]".
+func parseTarget(s string) (requester.Target, error) {
+	match, err := parseInputWithRegexp(strings.TrimSpace(s), targetRegexp)
+	if err != nil {
+		return requester.Target{}, err
+	}
+	c, err := strconv.Atoi(match[1])
+	if err != nil {
+		return requester.Target{}, err
+	}
+	u, err := gourl.Parse(match[3])
+	if err != nil {
+		return requester.Target{}, err
+	}
+	t := requester.Target{Method: strings.ToUpper(match[2]), URL: u, C: c}
+	if match[4] != "" {
+		t.Body = []byte(match[4])
+	}
+	return t, nil
+}
+
 type headerSlice []string
 
 func (h *headerSlice) String() string {
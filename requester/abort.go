@@ -0,0 +1,55 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrAborted is returned by Run when AbortOnResponse stopped the run.
+var ErrAborted = errors.New("requester: run aborted by AbortOnResponse")
+
+// maxAbortBody is the most of each response body AbortOnResponse gets.
+const maxAbortBody = 1 << 20
+
+// checkAbort calls AbortOnResponse with resp, its body replaced with
+// the start of it, as read, and stops the run if it returns true. It
+// reports whether it did.
+func (b *Work) checkAbort(resp *http.Response, body *snippetWriter) bool {
+	var buf []byte
+	if body != nil {
+		buf = body.buf
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	if !b.AbortOnResponse(resp) {
+		return false
+	}
+	atomic.StoreInt32(&b.aborted, 1)
+	b.Stop()
+	return true
+}
+
+// printAbort prints the response for which AbortOnResponse stopped the
+// run.
+func (r *report) printAbort() {
+	res := r.abortedBy
+	r.printf("\nAborted:\n")
+	r.printf("  After:\t%d requests\n", r.abortAt)
+	r.printf("  Response:\t[%d] %s\n", res.StatusCode, res.URL)
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAbortOnResponse(t *testing.T) {
+	var n int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&n, 1) >= 10 {
+			w.Write([]byte("service degraded"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	var out bytes.Buffer
+	w := &Work{
+		Request: req,
+		N:       1000,
+		C:       1,
+		Output:  "json",
+		Writer:  &out,
+		AbortOnResponse: func(resp *http.Response) bool {
+			body, _ := ioutil.ReadAll(resp.Body)
+			return strings.Contains(string(body), "degraded")
+		},
+	}
+	if err := w.Run(); err != ErrAborted {
+		t.Fatalf("Expected ErrAborted, found %v", err)
+	}
+	if w.report.numRes != 10 || w.report.abortAt != 10 {
+		t.Errorf("Expected the run to stop at the 10th request, found %v results, aborted at %v", w.report.numRes, w.report.abortAt)
+	}
+	// The body is still measured.
+	if w.report.decodedTotal != 9*2+int64(len("service degraded")) {
+		t.Errorf("Expected the bodies to be measured, found %v bytes", w.report.decodedTotal)
+	}
+	var sum JSONSummary
+	if err := json.Unmarshal(out.Bytes(), &sum); err != nil {
+		t.Fatal(err)
+	}
+	if !sum.Aborted || sum.Requests != 10 {
+		t.Errorf("Expected an aborted run of 10 requests, found %+v", sum)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Adaptive configures adaptive concurrency. The run starts with a single
+// active worker and adjusts the number of active workers every Interval,
+// up to Work.C: it is increased by Step while the server is healthy and
+// halved as soon as the average latency exceeds TargetLatency or the
+// failure rate exceeds MaxErrorRate (AIMD). Errors, 429 and 5xx responses
+// count as failures.
+type Adaptive struct {
+	// TargetLatency is the average latency above which concurrency is
+	// reduced. Zero disables the latency check.
+	TargetLatency time.Duration
+
+	// MaxErrorRate is the fraction of failed requests, between 0 and 1,
+	// above which concurrency is reduced. Zero disables the error check.
+	MaxErrorRate float64
+
+	// Interval is how often concurrency is adjusted. Defaults to 1s.
+	Interval time.Duration
+
+	// Step is the number of workers added on each healthy interval.
+	// Defaults to 1.
+	Step int
+}
+
+// concurrencyStep records the concurrency in effect from a point of the run.
+type concurrencyStep struct {
+	offset time.Duration
+	c      int
+}
+
+// adaptiveController gates workers according to the current concurrency
+// limit and adjusts the limit from the results of each interval.
+type adaptiveController struct {
+	cfg       Adaptive
+	max       int
+	remaining int64         // requests left to hand out
+	drained   chan struct{} // closed when no requests are left
+	drainOnce sync.Once
+
+	mu         sync.Mutex
+	limit      int
+	changed    chan struct{} // closed when limit changes
+	count      int
+	failures   int
+	latencySum time.Duration
+	steps      []concurrencyStep
+}
+
+func newAdaptiveController(cfg Adaptive, n, c int) *adaptiveController {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.Step <= 0 {
+		cfg.Step = 1
+	}
+	return &adaptiveController{
+		cfg:       cfg,
+		max:       c,
+		remaining: int64(n),
+		drained:   make(chan struct{}),
+		limit:     1,
+		changed:   make(chan struct{}),
+		steps:     []concurrencyStep{{0, 1}},
+	}
+}
+
+// acquire blocks worker id until it is within the concurrency limit and
+// reserves one request for it. It returns false if the worker should
+// exit, either because all requests are handed out or the run is stopped.
+func (a *adaptiveController) acquire(id int, stopCh <-chan struct{}) bool {
+	for {
+		a.mu.Lock()
+		limit, changed := a.limit, a.changed
+		a.mu.Unlock()
+		if id < limit {
+			break
+		}
+		select {
+		case <-stopCh:
+			return false
+		case <-a.drained:
+			return false
+		case <-changed:
+		}
+	}
+	left := atomic.AddInt64(&a.remaining, -1)
+	if left <= 0 {
+		a.drainOnce.Do(func() { close(a.drained) })
+	}
+	return left >= 0
+}
+
+// observe records the outcome of a request for the current interval.
+func (a *adaptiveController) observe(d time.Duration, code int, err error) {
+	a.mu.Lock()
+	a.count++
+	a.latencySum += d
+	if err != nil || code == 429 || code >= 500 {
+		a.failures++
+	}
+	a.mu.Unlock()
+}
+
+// run adjusts the limit every interval until done is closed.
+func (a *adaptiveController) run(start time.Time, done chan struct{}) {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			a.adjust(time.Now().Sub(start))
+		}
+	}
+}
+
+func (a *adaptiveController) adjust(offset time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.count == 0 {
+		return
+	}
+	avg := a.latencySum / time.Duration(a.count)
+	errRate := float64(a.failures) / float64(a.count)
+	a.count, a.failures, a.latencySum = 0, 0, 0
+
+	limit := a.limit
+	if (a.cfg.TargetLatency > 0 && avg > a.cfg.TargetLatency) ||
+		(a.cfg.MaxErrorRate > 0 && errRate > a.cfg.MaxErrorRate) {
+		limit = limit / 2
+		if limit < 1 {
+			limit = 1
+		}
+	} else {
+		limit = min(limit+a.cfg.Step, a.max)
+	}
+	if limit == a.limit {
+		return
+	}
+	a.limit = limit
+	a.steps = append(a.steps, concurrencyStep{offset, limit})
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// trajectory returns the concurrency changes made during the run.
+func (a *adaptiveController) trajectory() []concurrencyStep {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]concurrencyStep(nil), a.steps...)
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveAdjust(t *testing.T) {
+	a := newAdaptiveController(Adaptive{TargetLatency: 100 * time.Millisecond, MaxErrorRate: 0.1, Step: 2}, 100, 5)
+	healthy := func() {
+		a.observe(10*time.Millisecond, 200, nil)
+		a.adjust(0)
+	}
+	healthy()
+	healthy()
+	if a.limit != 5 {
+		t.Errorf("Expected concurrency to increase up to 5, found %v", a.limit)
+	}
+	a.observe(time.Second, 200, nil)
+	a.adjust(0)
+	if a.limit != 2 {
+		t.Errorf("Expected concurrency to halve on high latency, found %v", a.limit)
+	}
+	a.observe(10*time.Millisecond, 503, nil)
+	a.adjust(0)
+	if a.limit != 1 {
+		t.Errorf("Expected concurrency to halve on 5xx, found %v", a.limit)
+	}
+	a.observe(10*time.Millisecond, 0, errors.New("refused"))
+	a.adjust(0)
+	if a.limit != 1 {
+		t.Errorf("Expected concurrency to stay at 1, found %v", a.limit)
+	}
+	if got := len(a.trajectory()); got != 5 {
+		t.Errorf("Expected 5 concurrency steps, found %v", got)
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	var count, inFlight, maxInFlight int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			m := atomic.LoadInt64(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+				break
+			}
+		}
+		// Latency grows with load.
+		time.Sleep(time.Duration(n) * 2 * time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       300,
+		C:       20,
+		Adaptive: &Adaptive{
+			TargetLatency: 8 * time.Millisecond,
+			Interval:      20 * time.Millisecond,
+		},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 300 {
+		t.Errorf("Expected to send 300 requests, found %v", count)
+	}
+	if maxInFlight >= 20 {
+		t.Errorf("Expected concurrency to stay under 20, found %v", maxInFlight)
+	}
+}
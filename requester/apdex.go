@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import "time"
+
+// apdexCounts are the requests of a run by Apdex zone.
+type apdexCounts struct {
+	satisfied  int // within the target
+	tolerating int // within 4 times the target
+	frustrated int // slower, or failed
+}
+
+// score returns the Apdex score of the counts, from 0 to 1.
+func (c apdexCounts) score() float64 {
+	total := c.satisfied + c.tolerating + c.frustrated
+	if total == 0 {
+		return 0
+	}
+	return (float64(c.satisfied) + float64(c.tolerating)/2) / float64(total)
+}
+
+// apdex returns the requests so far by Apdex zone for target. It must be
+// called with r.mu held.
+func (r *report) apdex(target time.Duration) apdexCounts {
+	var c apdexCounts
+	t := target.Seconds()
+	for _, l := range r.lats {
+		switch {
+		case l <= t:
+			c.satisfied++
+		case l <= 4*t:
+			c.tolerating++
+		default:
+			c.frustrated++
+		}
+	}
+	for _, n := range r.errorDist {
+		c.frustrated += n
+	}
+	return c
+}
+
+// Apdex returns the Apdex score of the requests so far for ApdexTarget,
+// from 0 when every request was frustrated to 1 when all were satisfied.
+// It returns 0 before Run or without ApdexTarget.
+func (b *Work) Apdex() float64 {
+	b.mu.Lock()
+	r := b.report
+	b.mu.Unlock()
+	if r == nil || b.ApdexTarget <= 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.apdex(b.ApdexTarget).score()
+}
+
+// printApdex prints the Apdex score of the run with its zones.
+func (r *report) printApdex() {
+	c := r.apdex(r.apdexTarget)
+	r.printf("  Apdex:\t%.2f for %v (%d satisfied, %d tolerating, %d frustrated)\n", c.score(), r.apdexTarget, c.satisfied, c.tolerating, c.frustrated)
+}
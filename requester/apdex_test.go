@@ -0,0 +1,82 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApdex(t *testing.T) {
+	var n int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Of every 4 requests, 2 are satisfied, 1 tolerating and 1
+		// frustrated.
+		switch atomic.AddInt64(&n, 1) % 4 {
+		case 2:
+			time.Sleep(100 * time.Millisecond)
+		case 3:
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	var out bytes.Buffer
+	w := &Work{Request: req, N: 8, C: 1, Writer: &out, ApdexTarget: 50 * time.Millisecond}
+	if w.Apdex() != 0 {
+		t.Error("Expected no score before Run")
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	// (4 + 2/2) / 8
+	if got := w.Apdex(); math.Abs(got-0.625) > 1e-9 {
+		t.Errorf("Expected an Apdex of 0.625, found %v", got)
+	}
+	if !strings.Contains(out.String(), "Apdex:\t0.62 for 50ms (4 satisfied, 2 tolerating, 2 frustrated)") {
+		t.Errorf("Expected the Apdex in the summary, found %q", out.String())
+	}
+
+	out.Reset()
+	n = 0
+	w = &Work{Request: req, N: 8, C: 1, Writer: &out, Output: "json", ApdexTarget: 50 * time.Millisecond}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var sum JSONSummary
+	if err := json.Unmarshal(out.Bytes(), &sum); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(sum.Apdex-0.625) > 1e-9 {
+		t.Errorf("Expected an Apdex of 0.625 in the json summary, found %v", sum.Apdex)
+	}
+}
+
+func TestApdexFailures(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:1", nil)
+	w := &Work{Request: req, N: 4, C: 1, Writer: &bytes.Buffer{}, ApdexTarget: time.Second}
+	w.Run()
+	if got := w.Apdex(); got != 0 {
+		t.Errorf("Expected failed requests to be frustrated, found an Apdex of %v", got)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxBandwidthChunk is the most each read or write of a connection moves
+// at once with MaxBandwidth, so that a large one cannot burst past the
+// limit.
+const maxBandwidthChunk = 16 << 10
+
+// bandwidthLimiter shares MaxBandwidth between the connections of all
+// the workers, as a bucket of bytes refilled at the rate, in both
+// directions.
+type bandwidthLimiter struct {
+	rate int64 // bytes per second
+
+	mu   sync.Mutex
+	next time.Time // when the bytes moved so far are paid for
+
+	bytes int64 // bytes read and written
+}
+
+// wait records n bytes moved and waits until the rate allows them.
+func (l *bandwidthLimiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddInt64(&l.bytes, int64(n))
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	at := l.next
+	l.mu.Unlock()
+	time.Sleep(at.Sub(now))
+}
+
+// wrap returns a dial function whose connections are limited by l.
+func (l *bandwidthLimiter) wrap(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &limitedConn{Conn: c, l: l}, nil
+	}
+}
+
+// limitedConn is a connection limited by a bandwidthLimiter.
+type limitedConn struct {
+	net.Conn
+	l *bandwidthLimiter
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p[:min(len(p), maxBandwidthChunk)])
+	c.l.wait(n)
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxBandwidthChunk)]
+		c.l.wait(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxBandwidth(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 64<<10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	const limit = 256 << 10
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	var out bytes.Buffer
+	w := &Work{Request: req, N: 6, C: 2, Writer: &out, MaxBandwidth: limit}
+	start := time.Now()
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	r := w.report
+	if r.bandwidthBytes < 6*int64(len(body)) {
+		t.Errorf("Expected at least the bodies to be counted, found %v bytes", r.bandwidthBytes)
+	}
+	if rate := float64(r.bandwidthBytes) / elapsed.Seconds(); rate > limit*1.1 {
+		t.Errorf("Expected at most %v bytes/sec, found %.0f", limit, rate)
+	}
+	if !strings.Contains(out.String(), "bytes/sec of 262144 allowed") {
+		t.Errorf("Expected the bandwidth in the summary, found %q", out.String())
+	}
+}
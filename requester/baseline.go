@@ -0,0 +1,133 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultBaselineTolerance is the default of Work.BaselineTolerance.
+const DefaultBaselineTolerance = 0.1
+
+// maxErrorRateRise is how much the error rate may rise over the baseline,
+// in percentage points, before it is a regression.
+const maxErrorRateRise = 1.0
+
+// ErrRegression is returned by Run when the run regressed against
+// BaselineFile.
+var ErrRegression = errors.New("requester: regression against the baseline")
+
+// loadBaseline reads a JSON summary written by an earlier run.
+func loadBaseline(path string) (*JSONSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("requester: baseline: %v", err)
+	}
+	defer f.Close()
+	var base JSONSummary
+	if err := json.NewDecoder(f).Decode(&base); err != nil {
+		return nil, fmt.Errorf("requester: baseline %s: %v", path, err)
+	}
+	if base.SchemaVersion > JSONSchemaVersion {
+		return nil, fmt.Errorf("requester: baseline %s: unsupported schema version %d", path, base.SchemaVersion)
+	}
+	if base.Requests == 0 {
+		return nil, fmt.Errorf("requester: baseline %s: no requests", path)
+	}
+	return &base, nil
+}
+
+// compareBaseline compares the finished run to the baseline and returns
+// the number of regressions.
+func (b *Work) compareBaseline() int {
+	w := b.summaryWriter()
+	if b.Reporter != nil || b.Output != "" || b.OutputErrorsOnly {
+		// Keep the output machine-readable.
+		w = os.Stderr
+	}
+	tolerance := b.BaselineTolerance
+	if tolerance == 0 {
+		tolerance = DefaultBaselineTolerance
+	}
+	return b.report.compareBaseline(w, b.baseline, tolerance)
+}
+
+// compareBaseline writes the differences between the run and base to w
+// and returns the number of regressions: a rate of requests lower by more
+// than tolerance, a p50, p90 or p99 latency higher by more than
+// tolerance, or an error rate, counting 5xx responses, more than
+// maxErrorRateRise percentage points higher.
+func (r *report) compareBaseline(w io.Writer, base *JSONSummary, tolerance float64) int {
+	s := r.snapshot()
+	regressions := 0
+	mark := func(regressed bool) string {
+		if regressed {
+			regressions++
+			return "\tREGRESSION"
+		}
+		return ""
+	}
+	change := func(now, then float64) (string, float64) {
+		if then == 0 {
+			return "", 0
+		}
+		d := now/then - 1
+		return fmt.Sprintf("\t%+.1f%%", 100*d), d
+	}
+	fmt.Fprintf(w, "\nBaseline comparison (tolerance %.0f%%):\n", 100*tolerance)
+	c, d := change(s.RPS, base.RPS)
+	fmt.Fprintf(w, "  Requests/sec:\t%4.4f vs %4.4f%s%s\n", s.RPS, base.RPS, c, mark(d < -tolerance))
+	for _, p := range []int{50, 90, 99} {
+		then, ok := base.Latencies[fmt.Sprintf("p%d", p)]
+		if !ok {
+			continue
+		}
+		now := s.Latencies[p].Seconds()
+		c, d := change(now, then)
+		fmt.Fprintf(w, "  p%d latency:\t%4.4f vs %4.4f secs%s%s\n", p, now, then, c, mark(d > tolerance))
+	}
+	var baseErrors int
+	for _, n := range base.Errors {
+		baseErrors += n
+	}
+	now := errorRate(s.Requests, int(s.Errors), s.StatusCodes)
+	then := errorRate(base.Requests, baseErrors, base.StatusCodes)
+	fmt.Fprintf(w, "  Error rate:\t%.1f%% vs %.1f%%\t%+.1f pts%s\n", now, then, now-then, mark(now-then > maxErrorRateRise))
+	if regressions > 0 {
+		fmt.Fprintf(w, "  Result:\tFAIL, %d regressions\n", regressions)
+	} else {
+		fmt.Fprintf(w, "  Result:\tPASS\n")
+	}
+	return regressions
+}
+
+// errorRate returns the percentage of requests that failed or got a 5xx
+// response.
+func errorRate(requests int64, failures int, statusCodes map[int]int) float64 {
+	if requests == 0 {
+		return 0
+	}
+	failed := failures
+	for code, n := range statusCodes {
+		if code >= 500 {
+			failed += n
+		}
+	}
+	return 100 * float64(failed) / float64(requests)
+}
@@ -0,0 +1,93 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// The baseline of a slow run passes, that of a much faster one fails.
+	slow := writeTempFile(t, `{"requests": 10, "rps": 1, "latencies": {"p50": 10, "p90": 10, "p99": 10}, "status_codes": {"200": 10}}`)
+	defer os.Remove(slow)
+	fast := writeTempFile(t, `{"requests": 10, "rps": 1e9, "latencies": {"p50": 1e-9, "p99": 1e-9}, "status_codes": {"200": 10}}`)
+	defer os.Remove(fast)
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 10, C: 1, BaselineFile: slow, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatalf("Expected no regression, found %v", err)
+	}
+	for _, want := range []string{"Baseline comparison (tolerance 10%):", "p90 latency:", "Result:\tPASS"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, found %v", want, out.String())
+		}
+	}
+
+	out.Reset()
+	w = &Work{Request: req, N: 10, C: 1, BaselineFile: fast, BaselineTolerance: 0.5, Writer: &out}
+	if err := w.Run(); err != ErrRegression {
+		t.Fatalf("Expected a regression, found %v", err)
+	}
+	if strings.Contains(out.String(), "p90 latency:") {
+		t.Errorf("Expected latencies missing from the baseline to be skipped, found %v", out.String())
+	}
+	if got := strings.Count(out.String(), "REGRESSION"); got != 3 {
+		t.Errorf("Expected 3 regressions, found %v in %v", got, out.String())
+	}
+}
+
+func TestBaselineErrorRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	base := writeTempFile(t, `{"requests": 10, "rps": 1, "latencies": {}, "status_codes": {"200": 9}, "errors": {"timeout": 1}}`)
+	defer os.Remove(base)
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 4, C: 1, BaselineFile: base, Writer: &out}
+	if err := w.Run(); err != ErrRegression {
+		t.Fatalf("Expected a regression, found %v", err)
+	}
+	if !strings.Contains(out.String(), "Error rate:\t100.0% vs 10.0%\t+90.0 pts\tREGRESSION") {
+		t.Errorf("Expected an error rate regression, found %v", out.String())
+	}
+}
+
+func TestBaselineInvalid(t *testing.T) {
+	empty := writeTempFile(t, `{"requests": 0}`)
+	defer os.Remove(empty)
+	newer := writeTempFile(t, fmt.Sprintf(`{"schema_version": %d, "requests": 10}`, JSONSchemaVersion+1))
+	defer os.Remove(newer)
+	req, _ := http.NewRequest("GET", "http://127.0.0.1", nil)
+	for _, path := range []string{empty, newer, "/does/not/exist.json"} {
+		w := &Work{Request: req, N: 1, C: 1, BaselineFile: path, Reporter: &recordingReporter{}}
+		if err := w.Run(); err == nil {
+			t.Errorf("%s: expected an error, found none", path)
+		}
+	}
+}
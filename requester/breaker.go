@@ -0,0 +1,156 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrCircuitBroken is returned by Run when CircuitBreaker stopped the
+// run early.
+var ErrCircuitBroken = errors.New("requester: run stopped by the circuit breaker")
+
+// CircuitBreaker stops a run early once the requests fail too often,
+// rather than making all N requests to a service that is down.
+type CircuitBreaker struct {
+	// Window is the number of most recent requests the error rate is
+	// computed over.
+	Window int
+
+	// ErrorRate is the share of the requests of Window, between 0 and 1,
+	// that may fail or get a 5xx response. The circuit breaks once it is
+	// exceeded over a full Window.
+	ErrorRate float64
+}
+
+// circuitBreaker tracks the rolling error rate of a run and stops it once
+// the rate exceeds the threshold.
+type circuitBreaker struct {
+	cfg  CircuitBreaker
+	stop func()
+
+	mu      sync.Mutex
+	window  []bool // whether each of the last requests failed, as a ring
+	next    int
+	count   int64 // requests seen
+	failed  int   // failures in window
+	tripped bool
+	at      int64   // requests seen when the circuit broke
+	rate    float64 // error rate when the circuit broke
+}
+
+func newCircuitBreaker(cfg CircuitBreaker, stop func()) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg, stop: stop, window: make([]bool, cfg.Window)}
+}
+
+// observe records the result of a request, breaking the circuit if the
+// error rate over the window exceeds the threshold.
+func (c *circuitBreaker) observe(res *Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tripped {
+		return
+	}
+	failed := res.Err != nil || res.StatusCode >= 500
+	if c.window[c.next] {
+		c.failed--
+	}
+	if failed {
+		c.failed++
+	}
+	c.window[c.next] = failed
+	c.next = (c.next + 1) % len(c.window)
+	c.count++
+	if c.count < int64(len(c.window)) {
+		return
+	}
+	if rate := float64(c.failed) / float64(len(c.window)); rate > c.cfg.ErrorRate {
+		c.tripped, c.at, c.rate = true, c.count, rate
+		c.stop()
+	}
+}
+
+// broken reports whether the circuit broke.
+func (c *circuitBreaker) broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tripped
+}
+
+// printBreaker prints when the circuit breaker stopped the run.
+func (r *report) printBreaker() {
+	c := r.breaker
+	r.printf("\nCircuit breaker:\n")
+	r.printf("  Broken after:\t%d requests\n", c.at)
+	r.printf("  Error rate:\t%4.1f%% of the last %d requests, over %4.1f%% allowed\n", 100*c.rate, c.cfg.Window, 100*c.cfg.ErrorRate)
+}
+
+// ErrConsecutiveFailures is returned by Run when MaxConsecutiveFailures
+// stopped the run early.
+var ErrConsecutiveFailures = errors.New("requester: run stopped after consecutive failures")
+
+// failureStreak counts the requests that failed in a row and stops the
+// run once there are too many.
+type failureStreak struct {
+	max  int
+	stop func()
+
+	mu      sync.Mutex
+	streak  int
+	count   int64 // requests seen
+	tripped bool
+	at      int64   // requests seen when the run was stopped
+	last    *Result // the failure that stopped the run
+}
+
+// observe records the result of a request, stopping the run if it is
+// the max-th failure in a row.
+func (f *failureStreak) observe(res *Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tripped {
+		return
+	}
+	f.count++
+	if res.Err == nil && res.StatusCode < 500 {
+		f.streak = 0
+		return
+	}
+	if f.streak++; f.streak >= f.max {
+		f.tripped, f.at, f.last = true, f.count, res
+		f.stop()
+	}
+}
+
+// stopped reports whether the streak stopped the run.
+func (f *failureStreak) stopped() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tripped
+}
+
+// printFailureStreak prints when MaxConsecutiveFailures stopped the run.
+func (r *report) printFailureStreak() {
+	f := r.failures
+	r.printf("\nConsecutive failures:\n")
+	r.printf("  Stopped after:\t%d requests\n", f.at)
+	r.printf("  Failed in a row:\t%d requests\n", f.max)
+	if f.last.Err != nil {
+		r.printf("  Last failure:\t%v\n", f.last.Err)
+	} else {
+		r.printf("  Last failure:\tstatus %d\n", f.last.StatusCode)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var count int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The service goes down after 20 requests.
+		if atomic.AddInt64(&count, 1) > 20 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:        req,
+		N:              1000,
+		C:              1,
+		CircuitBreaker: &CircuitBreaker{Window: 10, ErrorRate: 0.5},
+		Writer:         &out,
+	}
+	if err := w.Run(); err != ErrCircuitBroken {
+		t.Fatalf("Expected ErrCircuitBroken, found %v", err)
+	}
+	// The sixth failure in a row breaks the circuit, while the next
+	// requests may already be in flight.
+	n := atomic.LoadInt64(&count)
+	if n < 26 || n > 30 {
+		t.Errorf("Expected about 26 requests, found %v", n)
+	}
+	if w.report.statusCodeDist[http.StatusOK] != 20 || int64(w.report.statusCodeDist[http.StatusServiceUnavailable]) != n-20 {
+		t.Errorf("Expected the partial results to be reported, found %v", w.report.statusCodeDist)
+	}
+	for _, want := range []string{"Broken after:\t26 requests", "Error rate:\t60.0% of the last 10 requests", "Status code distribution"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, found %v", want, out.String())
+		}
+	}
+
+	// A healthy run is not broken.
+	atomic.StoreInt64(&count, 0)
+	out.Reset()
+	w = &Work{Request: req, N: 20, C: 2, Output: "json", CircuitBreaker: &CircuitBreaker{Window: 5, ErrorRate: 0}, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var sum JSONSummary
+	if err := json.Unmarshal(out.Bytes(), &sum); err != nil || sum.CircuitBroken || sum.Requests != 20 {
+		t.Errorf("Expected 20 requests without a break, found %+v, %v", sum, err)
+	}
+}
+
+func TestMaxConsecutiveFailures(t *testing.T) {
+	var count int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every third request fails, then the service goes down after 20.
+		if n := atomic.AddInt64(&count, 1); n%3 == 0 || n > 20 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:                req,
+		N:                      1000,
+		C:                      1,
+		MaxConsecutiveFailures: 5,
+		Writer:                 &out,
+	}
+	if err := w.Run(); err != ErrConsecutiveFailures {
+		t.Fatalf("Expected ErrConsecutiveFailures, found %v", err)
+	}
+	// The sporadic failures do not stop the run, the fifth failure in a
+	// row does, while the next requests may already be in flight.
+	n := atomic.LoadInt64(&count)
+	if n < 25 || n > 29 {
+		t.Errorf("Expected about 25 requests, found %v", n)
+	}
+	for _, want := range []string{"Stopped after:\t25 requests", "Failed in a row:\t5 requests", "Last failure:\tstatus 503", "Status code distribution"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, found %v", want, out.String())
+		}
+	}
+
+	// Sporadic failures alone do not stop the run.
+	atomic.StoreInt64(&count, 0)
+	out.Reset()
+	w = &Work{Request: req, N: 20, C: 1, Output: "json", MaxConsecutiveFailures: 2, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var sum JSONSummary
+	if err := json.Unmarshal(out.Bytes(), &sum); err != nil || sum.ConsecutiveFailures || sum.Requests != 20 {
+		t.Errorf("Expected 20 requests without a stop, found %+v, %v", sum, err)
+	}
+}
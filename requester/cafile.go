@@ -0,0 +1,63 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// loadCAFile returns the pool of the PEM certificates of path, which
+// must hold at least one and nothing else.
+func loadCAFile(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("requester: %v", err)
+	}
+	pool := x509.NewCertPool()
+	for n := 0; ; n++ {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			if n == 0 || len(bytes.TrimSpace(data)) > 0 {
+				return nil, fmt.Errorf("requester: CAFile %s is not a PEM certificate bundle", path)
+			}
+			return pool, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("requester: CAFile %s holds a %s, expected certificates", path, block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("requester: invalid certificate in CAFile %s: %v", path, err)
+		}
+		pool.AddCert(cert)
+	}
+}
+
+// tlsConfig returns the TLS configuration of the connections to the
+// request URL, which sends ServerName if set, and verifies the
+// certificates of the server against CAFile if set, and does not verify
+// them otherwise.
+func (b *Work) tlsConfig() *tls.Config {
+	if b.rootCAs != nil {
+		return &tls.Config{RootCAs: b.rootCAs, ServerName: b.ServerName}
+	}
+	return &tls.Config{InsecureSkipVerify: true, ServerName: b.ServerName}
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// certPEM returns cert as a PEM block.
+func certPEM(cert []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}))
+}
+
+// newCA returns a self-signed CA certificate that signed nothing.
+func newCA(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "hey test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	trusted := writeTempFile(t, certPEM(server.Certificate().Raw))
+	defer os.Remove(trusted)
+	untrusted := writeTempFile(t, certPEM(newCA(t)))
+	defer os.Remove(untrusted)
+
+	for _, tt := range []struct {
+		file   string
+		failed int
+	}{
+		{trusted, 0},
+		{untrusted, 4},
+	} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		rr := &recordingReporter{}
+		w := &Work{Request: req, N: 4, C: 1, CAFile: tt.file, Reporter: rr}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		failed := 0
+		for _, res := range rr.results {
+			if res.Err != nil {
+				if !strings.Contains(res.Err.Error(), "unknown authority") {
+					t.Errorf("Expected an unknown authority error, found %v", res.Err)
+				}
+				failed++
+			}
+		}
+		if failed != tt.failed {
+			t.Errorf("Expected %v failed handshakes, found %v", tt.failed, failed)
+		}
+	}
+}
+
+func TestCAFileInvalid(t *testing.T) {
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")}))
+	for _, content := range []string{"", "not a certificate", certPEM([]byte("garbage")), key} {
+		path := writeTempFile(t, content)
+		req, _ := http.NewRequest("GET", "https://example.com", nil)
+		w := &Work{Request: req, N: 1, C: 1, CAFile: path}
+		if err := w.Run(); err == nil || !strings.Contains(err.Error(), "CAFile") {
+			t.Errorf("Expected a CAFile error for %q, found %v", content, err)
+		}
+		os.Remove(path)
+	}
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+	w := &Work{Request: req, N: 1, C: 1, CAFile: "/missing/ca.pem"}
+	if err := w.Run(); err == nil {
+		t.Errorf("Expected an error for a missing CAFile")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// chunkedBody is a request body sent in chunks of size bytes, delay
+// apart, for slow upload tests.
+type chunkedBody struct {
+	data  []byte
+	size  int
+	delay time.Duration
+	stop  <-chan struct{}
+
+	started   bool
+	sent      int64 // atomically, bytes read by the transport
+	done      int32 // atomically, set once the whole body was read
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newChunkedBody(data []byte, size int, delay time.Duration, stop <-chan struct{}) *chunkedBody {
+	return &chunkedBody{data: data, size: size, delay: delay, stop: stop, closed: make(chan struct{})}
+}
+
+func (c *chunkedBody) Read(p []byte) (int, error) {
+	if len(c.data) == 0 {
+		atomic.StoreInt32(&c.done, 1)
+		return 0, io.EOF
+	}
+	if c.started && c.delay > 0 {
+		t := time.NewTimer(c.delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-c.closed:
+			return 0, io.ErrClosedPipe
+		case <-c.stop:
+			return 0, io.ErrClosedPipe
+		}
+	}
+	c.started = true
+	n := copy(p[:min(len(p), c.size)], c.data)
+	c.data = c.data[n:]
+	atomic.AddInt64(&c.sent, int64(n))
+	return n, nil
+}
+
+// Close is called by the transport once it is done with the body,
+// possibly while Read waits for the next chunk.
+func (c *chunkedBody) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// complete reports whether the whole body was sent.
+func (c *chunkedBody) complete() bool {
+	return atomic.LoadInt32(&c.done) == 1
+}
+
+// printUploads prints how the chunked uploads of a ChunkSize run ended.
+func (r *report) printUploads() {
+	r.printf("\nChunked uploads:\n")
+	r.printf("  Completed:\t%d of %d\n", r.numUploads-r.numCutOff, r.numUploads)
+	r.printf("  Cut off:\t%d (response or error before the body was sent)\n", r.numCutOff)
+	if len(r.cutOffLats) > 0 {
+		sort.Float64s(r.cutOffLats)
+		r.printf("\nCut-off time distribution:\n")
+		for _, p := range pctlsReported {
+			r.printf("  %v%% in %4.4f secs\n", p, percentile(r.cutOffLats, float64(p)))
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChunkedBody(t *testing.T) {
+	var mu sync.Mutex
+	var encodings []string
+	var reads []int
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 64)
+		var n int
+		for {
+			m, err := r.Body.Read(buf)
+			if m > 0 {
+				n += m
+				mu.Lock()
+				reads = append(reads, m)
+				mu.Unlock()
+			}
+			if err != nil {
+				break
+			}
+		}
+		mu.Lock()
+		encodings = append(encodings, strings.Join(r.TransferEncoding, ","))
+		mu.Unlock()
+		if n != 10 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	w := &Work{
+		Request:     req,
+		RequestBody: []byte("0123456789"),
+		N:           2,
+		C:           1,
+		ChunkSize:   4,
+		ChunkDelay:  10 * time.Millisecond,
+		Writer:      &out,
+	}
+	start := time.Now()
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("Expected the chunks to be delayed, the run took %v", d)
+	}
+	if w.report.statusCodeDist[http.StatusOK] != 2 {
+		t.Errorf("Expected 2 complete bodies, found %v", w.report.statusCodeDist)
+	}
+	for _, e := range encodings {
+		if e != "chunked" {
+			t.Errorf("Expected chunked transfer encoding, found %q", e)
+		}
+	}
+	for _, n := range reads {
+		if n > 4 {
+			t.Errorf("Expected chunks of at most 4 bytes, found a read of %v", n)
+		}
+	}
+	if !strings.Contains(out.String(), "Completed:\t2 of 2") {
+		t.Errorf("Expected the completed uploads in the output, found %v", out.String())
+	}
+}
+
+func TestChunkedBodyCutOff(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Give up on the upload after its first chunk.
+		io.ReadFull(r.Body, make([]byte, 1))
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusRequestTimeout)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	w := &Work{
+		Request:     req,
+		RequestBody: bytes.Repeat([]byte("x"), 100),
+		N:           3,
+		C:           1,
+		ChunkSize:   1,
+		ChunkDelay:  50 * time.Millisecond,
+		Writer:      &out,
+	}
+	start := time.Now()
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Expected the uploads to be cut off early, the run took %v", d)
+	}
+	if w.report.numCutOff != 3 {
+		t.Errorf("Expected 3 uploads cut off, found %v", w.report.numCutOff)
+	}
+	if !strings.Contains(out.String(), "Cut off:\t3") || !strings.Contains(out.String(), "Cut-off time distribution") {
+		t.Errorf("Expected the cut-off uploads in the output, found %v", out.String())
+	}
+}
+
+func TestChunkedBodyClose(t *testing.T) {
+	b := newChunkedBody([]byte("abcdef"), 3, time.Hour, nil)
+	p, err := ioutil.ReadAll(io.LimitReader(b, 3))
+	if err != nil || string(p) != "abc" {
+		t.Fatalf("Expected the first chunk, found %q, %v", p, err)
+	}
+	go b.Close()
+	if _, err := b.Read(make([]byte, 3)); err == nil {
+		t.Errorf("Expected Close to interrupt the wait for the next chunk")
+	}
+	if b.complete() {
+		t.Errorf("Expected the body to be incomplete")
+	}
+}
+
+func TestTransferEncoding(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		mu.Lock()
+		got = append(got, fmt.Sprintf("%s %d %d", strings.Join(r.TransferEncoding, ","), r.ContentLength, n))
+		mu.Unlock()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		w    *Work
+		want string
+	}{
+		{"default", &Work{}, " 10 10"},
+		{"force chunked", &Work{ForceChunked: true}, "chunked -1 10"},
+		{"chunk size", &Work{ChunkSize: 4}, "chunked -1 10"},
+		{"chunk size with content length", &Work{ChunkSize: 4, ForceContentLength: true}, " 10 10"},
+		{"body func with force chunked", &Work{ForceChunked: true, BodyFunc: func(int) ([]byte, string) {
+			return []byte("0123456789"), ""
+		}}, "chunked -1 10"},
+	}
+	for _, tt := range tests {
+		got = nil
+		req, _ := http.NewRequest("POST", server.URL, nil)
+		tt.w.Request, tt.w.RequestBody = req, []byte("0123456789")
+		tt.w.N, tt.w.C, tt.w.Reporter = 2, 1, &recordingReporter{}
+		if err := tt.w.Run(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got) != 2 {
+			t.Errorf("%s: expected 2 requests, found %v", tt.name, len(got))
+		}
+		for _, g := range got {
+			if g != tt.want {
+				t.Errorf("%s: expected transfer encoding, length and body size %q, found %q", tt.name, tt.want, g)
+			}
+		}
+	}
+}
+
+func TestExpect100Continue(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reject" {
+			// Respond without reading the body, so that the server
+			// does not send 100 Continue.
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		mu.Lock()
+		got = append(got, fmt.Sprintf("%s %d", r.Header.Get("Expect"), n))
+		mu.Unlock()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	reporter := &recordingReporter{}
+	w := &Work{Request: req, RequestBody: []byte("0123456789"), N: 2, C: 1, Expect100Continue: true, Reporter: reporter}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"100-continue 10", "100-continue 10"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected the header and body of both requests, found %q", got)
+	}
+	for _, res := range reporter.results {
+		if res.Err != nil || res.ContinueDuration <= 0 {
+			t.Errorf("Expected a 100 Continue round trip, found %v, %v", res.ContinueDuration, res.Err)
+		}
+	}
+	if len(w.report.continueLats) != 2 {
+		t.Errorf("Expected 2 reported round trips, found %v", w.report.continueLats)
+	}
+
+	req, _ = http.NewRequest("POST", server.URL+"/reject", nil)
+	reporter = &recordingReporter{}
+	w = &Work{Request: req, RequestBody: []byte("0123456789"), N: 2, C: 1, Expect100Continue: true, Reporter: reporter}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range reporter.results {
+		if res.StatusCode != http.StatusExpectationFailed || res.ContinueDuration != 0 {
+			t.Errorf("Expected a 417 without 100 Continue, found %v after %v", res.StatusCode, res.ContinueDuration)
+		}
+	}
+}
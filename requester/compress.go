@@ -0,0 +1,80 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// compressTransport sends request bodies compressed with gzip, for
+// CompressRequestBody. With fallback, a request answered with 415
+// Unsupported Media Type is sent once more, uncompressed.
+type compressTransport struct {
+	rt       http.RoundTripper
+	fallback bool
+	writers  sync.Pool // of *gzip.Writer
+
+	fallbacks int64 // requests sent again uncompressed
+}
+
+func newCompressTransport(rt http.RoundTripper, fallback bool) *compressTransport {
+	return &compressTransport{rt: rt, fallback: fallback}
+}
+
+func (t *compressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return t.rt.RoundTrip(req)
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	send := func(body []byte, encoding string) (*http.Response, error) {
+		r := req.Clone(req.Context())
+		if encoding != "" {
+			r.Header.Set("Content-Encoding", encoding)
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if req.ContentLength >= 0 {
+			// Keep the body chunked with ForceChunked.
+			r.ContentLength = int64(len(body))
+		}
+		return t.rt.RoundTrip(r)
+	}
+	var buf bytes.Buffer
+	zw, _ := t.writers.Get().(*gzip.Writer)
+	if zw == nil {
+		zw = gzip.NewWriter(&buf)
+	} else {
+		zw.Reset(&buf)
+	}
+	zw.Write(body)
+	zw.Close()
+	t.writers.Put(zw)
+	resp, err := send(buf.Bytes(), "gzip")
+	if err != nil || !t.fallback || resp.StatusCode != http.StatusUnsupportedMediaType {
+		return resp, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	atomic.AddInt64(&t.fallbacks, 1)
+	return send(body, "")
+}
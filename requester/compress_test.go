@@ -0,0 +1,104 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCompressRequestBody(t *testing.T) {
+	var bad int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			atomic.AddInt64(&bad, 1)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			atomic.AddInt64(&bad, 1)
+			return
+		}
+		if body, _ := ioutil.ReadAll(zr); string(body) != "hello" {
+			atomic.AddInt64(&bad, 1)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	w := &Work{Request: req, RequestBody: []byte("hello"), N: 20, C: 2, Writer: ioutil.Discard, CompressRequestBody: true}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if bad != 0 {
+		t.Errorf("Expected gzip bodies, found %v bad requests", bad)
+	}
+	if w.report.statusCodeDist[http.StatusOK] != 20 {
+		t.Errorf("Expected 20 responses, found %v", w.report.statusCodeDist)
+	}
+}
+
+func TestFallbackUncompressed(t *testing.T) {
+	var compressed, plain int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "" {
+			atomic.AddInt64(&compressed, 1)
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) == "hello" {
+			atomic.AddInt64(&plain, 1)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	var out bytes.Buffer
+	w := &Work{
+		Request:              req,
+		RequestBody:          []byte("hello"),
+		N:                    20,
+		C:                    2,
+		Writer:               &out,
+		CompressRequestBody:  true,
+		FallbackUncompressed: true,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if compressed != 20 || plain != 20 {
+		t.Errorf("Expected 20 compressed and 20 uncompressed requests, found %v and %v", compressed, plain)
+	}
+	if w.report.fallbacks != 20 || w.report.statusCodeDist[http.StatusOK] != 20 {
+		t.Errorf("Expected 20 fallbacks ending in 200s, found %v and %v", w.report.fallbacks, w.report.statusCodeDist)
+	}
+	if !strings.Contains(out.String(), "Uncompressed fallbacks:\t20 requests") {
+		t.Errorf("Expected the fallbacks in the summary, found %q", out.String())
+	}
+
+	// Without the fallback, the 415s are reported as is.
+	compressed, plain = 0, 0
+	w = &Work{Request: req, RequestBody: []byte("hello"), N: 20, C: 2, Writer: ioutil.Discard, CompressRequestBody: true}
+	w.Run()
+	if plain != 0 || w.report.statusCodeDist[http.StatusUnsupportedMediaType] != 20 {
+		t.Errorf("Expected 20 415s without the fallback, found %v", w.report.statusCodeDist)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"errors"
+	"io/ioutil"
+	"time"
+)
+
+// minGain is the throughput increase a higher concurrency must bring over
+// the best one so far to be preferred, so that noise does not favor
+// higher concurrency levels.
+const minGain = 1.05
+
+// ConcurrencyTrial is the outcome of a run of a ConcurrencyFinder.
+type ConcurrencyTrial struct {
+	C       int
+	RPS     float64
+	Latency time.Duration // 90th percentile latency
+	Errors  int64
+}
+
+// ConcurrencyFinder searches for the concurrency level that maximizes
+// throughput without inflating latency. It makes a run at concurrency 1
+// for the baseline latency, then doubles the concurrency for each run
+// while throughput increases and the 90th percentile latency stays within
+// LatencyFactor of the baseline, and finally bisects between the best
+// concurrency and the first one that did not improve.
+type ConcurrencyFinder struct {
+	// NewWork returns the Work of the run at concurrency c. Its N should
+	// be large enough for a stable measurement. Its output is discarded.
+	NewWork func(c int) *Work
+
+	// MaxC is the highest concurrency to try.
+	MaxC int
+
+	// LatencyFactor is how much the 90th percentile latency may grow
+	// over the baseline. Defaults to 2.
+	LatencyFactor float64
+}
+
+// Find runs the search and returns the recommended concurrency along with
+// the trials made, in order.
+func (f *ConcurrencyFinder) Find() (int, []ConcurrencyTrial, error) {
+	if f.NewWork == nil || f.MaxC < 1 {
+		return 0, nil, errors.New("requester: ConcurrencyFinder requires NewWork and a positive MaxC")
+	}
+	factor := f.LatencyFactor
+	if factor <= 0 {
+		factor = 2
+	}
+	var trials []ConcurrencyTrial
+	run := func(c int) (ConcurrencyTrial, error) {
+		w := f.NewWork(c)
+		w.Writer, w.ResultWriter, w.SummaryWriter = ioutil.Discard, ioutil.Discard, ioutil.Discard
+		if err := w.Run(); err != nil {
+			return ConcurrencyTrial{}, err
+		}
+		s := w.Snapshot()
+		t := ConcurrencyTrial{C: c, RPS: s.RPS, Latency: s.Latencies[90], Errors: s.Errors}
+		trials = append(trials, t)
+		return t, nil
+	}
+
+	best, err := run(1)
+	if err != nil {
+		return 0, trials, err
+	}
+	baseline := best.Latency
+	// better reports whether t improves on the best trial so far.
+	better := func(t ConcurrencyTrial) bool {
+		return t.Errors == 0 && t.Latency > 0 &&
+			float64(t.Latency) <= factor*float64(baseline) &&
+			t.RPS >= minGain*best.RPS
+	}
+
+	bad := 0
+	for c := 2; bad == 0; c *= 2 {
+		if c > f.MaxC {
+			c = f.MaxC
+		}
+		if c <= best.C {
+			break
+		}
+		t, err := run(c)
+		if err != nil {
+			return 0, trials, err
+		}
+		if !better(t) {
+			bad = c
+			break
+		}
+		best = t
+	}
+	for lo, hi := best.C, bad; hi-lo > 1; {
+		mid := (lo + hi) / 2
+		t, err := run(mid)
+		if err != nil {
+			return 0, trials, err
+		}
+		if better(t) {
+			best, lo = t, mid
+		} else {
+			hi = mid
+		}
+	}
+	return best.C, trials, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyFinder(t *testing.T) {
+	// The server handles 4 requests at a time, more queue up.
+	slots := make(chan struct{}, 4)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		slots <- struct{}{}
+		time.Sleep(20 * time.Millisecond)
+		<-slots
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	f := &ConcurrencyFinder{
+		NewWork: func(c int) *Work {
+			return &Work{Request: req, N: 10 * c, C: c}
+		},
+		MaxC:          32,
+		LatencyFactor: 1.3,
+	}
+	c, trials, err := f.Find()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c < 4 || c > 5 {
+		t.Errorf("Expected a concurrency of about 4, found %v in %+v", c, trials)
+	}
+	if trials[0].C != 1 || len(trials) < 4 {
+		t.Errorf("Expected a baseline run and a search, found %+v", trials)
+	}
+	for _, tr := range trials {
+		if tr.C > 8 {
+			t.Errorf("Expected the search to stop doubling at 8, found %+v", trials)
+		}
+	}
+
+	if _, _, err := (&ConcurrencyFinder{MaxC: 4}).Find(); err == nil {
+		t.Errorf("Expected an error without NewWork, found none")
+	}
+}
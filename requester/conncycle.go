@@ -0,0 +1,81 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// errConnExpired is the error of writing a request to a connection older
+// than MaxConnDuration.
+var errConnExpired = errors.New("requester: connection older than MaxConnDuration")
+
+// connCycler dials the connections of the transport and closes them
+// once older than max, before the next request is written to them. The
+// transport then retries the request on a new connection, as it does for
+// a kept-alive connection the server closed.
+type connCycler struct {
+	dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+	max    time.Duration
+	cycled int64 // connections closed for their age
+}
+
+// DialContext is used as the transport's dial function.
+func (c *connCycler) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := c.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &agedConn{Conn: conn, cycler: c, born: time.Now()}, nil
+}
+
+// agedConn is a connection of a connCycler.
+type agedConn struct {
+	net.Conn
+	cycler *connCycler
+	born   time.Time
+
+	read    int32 // set once a response was read since the last write
+	expired int32 // set once closed for its age
+}
+
+func (a *agedConn) Read(p []byte) (int, error) {
+	n, err := a.Conn.Read(p)
+	if n > 0 {
+		atomic.StoreInt32(&a.read, 1)
+	}
+	return n, err
+}
+
+// Write closes the connection and fails without writing anything if it
+// starts a new request, after a response was read, and the connection is
+// too old. The writes of a request in progress are left alone.
+func (a *agedConn) Write(p []byte) (int, error) {
+	if atomic.SwapInt32(&a.read, 0) == 1 && time.Since(a.born) >= a.cycler.max {
+		if atomic.CompareAndSwapInt32(&a.expired, 0, 1) {
+			atomic.AddInt64(&a.cycler.cycled, 1)
+			a.Conn.Close()
+		}
+		return 0, errConnExpired
+	}
+	if atomic.LoadInt32(&a.expired) == 1 {
+		return 0, errConnExpired
+	}
+	return a.Conn.Write(p)
+}
@@ -0,0 +1,74 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaxConnDuration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	run := func(max time.Duration) (*Work, []Result) {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		reporter := &recordingReporter{}
+		w := &Work{Request: req, N: 20, C: 1, MaxConnDuration: max, Reporter: reporter}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return w, reporter.results
+	}
+	newConns := func(results []Result) int {
+		n := 0
+		for _, res := range results {
+			if res.Err != nil {
+				t.Errorf("Expected no errors, found %v", res.Err)
+			}
+			if !res.ConnReused {
+				n++
+			}
+		}
+		return n
+	}
+
+	if _, results := run(0); newConns(results) != 1 {
+		t.Errorf("Expected a single connection without MaxConnDuration, found %v", newConns(results))
+	}
+	// The 20 requests take at least 400ms, cycling the connection after
+	// about every 5 requests.
+	w, results := run(100 * time.Millisecond)
+	n := newConns(results)
+	if n < 3 || n > 6 {
+		t.Errorf("Expected 3 to 6 connections, found %v", n)
+	}
+	if w.report.connsCycled != int64(n-1) {
+		t.Errorf("Expected %v connections cycled, found %v", n-1, w.report.connsCycled)
+	}
+	// A connection is never used past its age, give or take its dial.
+	var born time.Time
+	for _, res := range results {
+		if !res.ConnReused {
+			born = res.Start
+		} else if age := res.Start.Sub(born); age > 110*time.Millisecond {
+			t.Errorf("Expected a new connection after 100ms, found one reused after %v", age)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// grpcTimeoutUnits are the units of the grpc-timeout header.
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// headerDeadline returns the deadline of a request from its header
+// named name, or zero if it has none. The grpc-timeout header is in the
+// gRPC format, such as "500m" for 500 milliseconds, others are Go
+// durations, such as "500ms".
+func headerDeadline(h http.Header, name string) (time.Duration, error) {
+	v := h.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	var d time.Duration
+	var err error
+	if http.CanonicalHeaderKey(name) == "Grpc-Timeout" {
+		d, err = parseGRPCTimeout(v)
+	} else {
+		d, err = time.ParseDuration(v)
+	}
+	if err == nil && d <= 0 {
+		err = errors.New("not positive")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("requester: invalid deadline %s: %q: %v", name, v, err)
+	}
+	return d, nil
+}
+
+// parseGRPCTimeout parses a grpc-timeout value, of up to 8 digits and a
+// unit.
+func parseGRPCTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, errors.New("invalid length")
+	}
+	unit, ok := grpcTimeoutUnits[v[len(v)-1]]
+	if !ok {
+		return 0, errors.New("invalid unit")
+	}
+	n, err := strconv.ParseUint(v[:len(v)-1], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n) * unit, nil
+}
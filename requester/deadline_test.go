@@ -0,0 +1,90 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHeaderDeadline(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        time.Duration
+		err         bool
+	}{
+		{"grpc-timeout", "500m", 500 * time.Millisecond, false},
+		{"Grpc-Timeout", "2S", 2 * time.Second, false},
+		{"grpc-timeout", "100u", 100 * time.Microsecond, false},
+		{"grpc-timeout", "1H", time.Hour, false},
+		{"grpc-timeout", "500ms", 0, true},
+		{"grpc-timeout", "123456789S", 0, true},
+		{"grpc-timeout", "0S", 0, true},
+		{"X-Deadline", "500ms", 500 * time.Millisecond, false},
+		{"X-Deadline", "5m", 5 * time.Minute, false},
+		{"X-Deadline", "-1s", 0, true},
+		{"X-Deadline", "soon", 0, true},
+		{"X-Deadline", "", 0, false},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.value != "" {
+			h.Set(tt.name, tt.value)
+		}
+		got, err := headerDeadline(h, tt.name)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%s: %q: expected %v, error %v, found %v, %v", tt.name, tt.value, tt.want, tt.err, got, err)
+		}
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		deadline string
+		exceeded bool
+	}{
+		{"20ms", true},
+		{"2s", false},
+	} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("X-Deadline", tt.deadline)
+		reporter := &recordingReporter{}
+		w := &Work{Request: req, N: 4, C: 2, DeadlineHeader: "X-Deadline", Reporter: reporter}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if len(reporter.results) != 4 {
+			t.Fatalf("%s: expected 4 results, found %v", tt.deadline, len(reporter.results))
+		}
+		for _, res := range reporter.results {
+			if res.DeadlineExceeded != tt.exceeded || (res.Err != nil) != tt.exceeded {
+				t.Errorf("%s: expected deadline exceeded %v, found %v, error %v", tt.deadline, tt.exceeded, res.DeadlineExceeded, res.Err)
+			}
+			if tt.exceeded && res.Duration > 90*time.Millisecond {
+				t.Errorf("%s: expected the request to give up at its deadline, found %v", tt.deadline, res.Duration)
+			}
+		}
+		if want := map[bool]int64{true: 4}[tt.exceeded]; w.report.numDeadline != want {
+			t.Errorf("%s: expected %v requests past their deadline, found %v", tt.deadline, want, w.report.numDeadline)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// digestTransport authenticates requests with HTTP Digest authentication
+// (RFC 7616). A request without a cached challenge is sent as is and,
+// if the server answers with a 401 and a Digest challenge, sent again
+// with an Authorization header computed from it.
+type digestTransport struct {
+	rt             http.RoundTripper
+	user, password string
+
+	// idle holds the challenges of requests that are done, for the next
+	// ones to reuse so that each worker is challenged once rather than
+	// for every request.
+	idle chan *digestState
+
+	challenges int64 // extra round trips made to answer challenges
+}
+
+func newDigestTransport(rt http.RoundTripper, user, password string, c int) *digestTransport {
+	return &digestTransport{rt: rt, user: user, password: password, idle: make(chan *digestState, c)}
+}
+
+// digestState is a challenge and the number of requests made with it.
+type digestState struct {
+	challenge *digestChallenge
+	nc        int
+}
+
+type digestChallenge struct {
+	realm, nonce, opaque, algorithm, qop string
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var s *digestState
+	select {
+	case s = <-t.idle:
+	default:
+		s = &digestState{}
+	}
+	defer func() {
+		select {
+		case t.idle <- s:
+		default:
+		}
+	}()
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	send := func() (*http.Response, error) {
+		r := req.Clone(req.Context())
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		if s.challenge != nil {
+			s.nc++
+			auth, err := s.challenge.authorization(t.user, t.password, r.Method, r.URL.RequestURI(), s.nc)
+			if err != nil {
+				return nil, err
+			}
+			r.Header.Set("Authorization", auth)
+		}
+		return t.rt.RoundTrip(r)
+	}
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// No challenge yet, or a stale nonce: answer the new challenge once.
+	c, err := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	s.challenge, s.nc = c, 0
+	atomic.AddInt64(&t.challenges, 1)
+	return send()
+}
+
+// requestBody reads the body of req, if any, so that it can be sent
+// again.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return ioutil.ReadAll(req.Body)
+}
+
+// parseDigestChallenge parses the value of a WWW-Authenticate header
+// with a Digest challenge.
+func parseDigestChallenge(h string) (*digestChallenge, error) {
+	const prefix = "digest "
+	if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return nil, errors.New("not a Digest challenge")
+	}
+	c := &digestChallenge{algorithm: "MD5"}
+	params := h[len(prefix):]
+	for params != "" {
+		var name, value string
+		params = strings.TrimLeft(params, " ,")
+		i := strings.IndexByte(params, '=')
+		if i < 0 {
+			break
+		}
+		name, params = strings.ToLower(strings.TrimSpace(params[:i])), strings.TrimSpace(params[i+1:])
+		if strings.HasPrefix(params, `"`) {
+			// Quoted strings may contain commas and escaped characters.
+			var b strings.Builder
+			j := 1
+			for ; j < len(params) && params[j] != '"'; j++ {
+				if params[j] == '\\' && j+1 < len(params) {
+					j++
+				}
+				b.WriteByte(params[j])
+			}
+			value, params = b.String(), params[min(j+1, len(params)):]
+		} else {
+			j := strings.IndexByte(params, ',')
+			if j < 0 {
+				j = len(params)
+			}
+			value, params = strings.TrimSpace(params[:j]), params[j:]
+		}
+		switch name {
+		case "realm":
+			c.realm = value
+		case "nonce":
+			c.nonce = value
+		case "opaque":
+			c.opaque = value
+		case "algorithm":
+			c.algorithm = value
+		case "qop":
+			for _, q := range strings.Split(value, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					c.qop = "auth"
+				}
+			}
+			if c.qop == "" {
+				return nil, fmt.Errorf("unsupported qop %q", value)
+			}
+		}
+	}
+	if c.nonce == "" {
+		return nil, errors.New("Digest challenge without a nonce")
+	}
+	return c, nil
+}
+
+// authorization returns the Authorization header of the nc-th request
+// made with c.
+func (c *digestChallenge) authorization(user, password, method, uri string, nc int) (string, error) {
+	var newHash func() hash.Hash
+	algorithm := strings.ToUpper(c.algorithm)
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("requester: unsupported Digest algorithm %q", c.algorithm)
+	}
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(buf[:])
+	count := fmt.Sprintf("%08x", nc)
+	ha1 := h(user + ":" + c.realm + ":" + password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	var response string
+	if c.qop == "" {
+		response = h(ha1 + ":" + c.nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + count + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	}
+	auth := fmt.Sprintf("Digest username=%s, realm=%s, nonce=%s, uri=%s, algorithm=%s, response=%s",
+		quote(user), quote(c.realm), quote(c.nonce), quote(uri), c.algorithm, quote(response))
+	if c.opaque != "" {
+		auth += ", opaque=" + quote(c.opaque)
+	}
+	if c.qop != "" {
+		auth += fmt.Sprintf(", qop=%s, nc=%s, cnonce=%s", c.qop, count, quote(cnonce))
+	}
+	return auth, nil
+}
+
+var quoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quote returns s as an HTTP quoted-string.
+func quote(s string) string {
+	return `"` + quoteReplacer.Replace(s) + `"`
+}
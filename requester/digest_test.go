@@ -0,0 +1,135 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// digestServer checks Digest credentials with qop=auth, issuing a new
+// nonce with each challenge, and counts the challenges.
+func digestServer(user, password string, challenges *int64) *httptest.Server {
+	const realm = "hey"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			params := parseAuthParams(auth)
+			ha1 := md5Hex(params["username"] + ":" + realm + ":" + password)
+			ha2 := md5Hex(r.Method + ":" + params["uri"])
+			want := md5Hex(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+			body, _ := ioutil.ReadAll(r.Body)
+			if params["username"] == user && params["response"] == want && string(body) == "payload" {
+				return
+			}
+		}
+		n := atomic.AddInt64(challenges, 1)
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm=%q, qop="auth,auth-int", nonce="n%d", opaque="o"`, realm, n))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+}
+
+// parseAuthParams parses the parameters of an Authorization header.
+func parseAuthParams(h string) map[string]string {
+	params := make(map[string]string)
+	for _, p := range strings.Split(strings.TrimPrefix(h, "Digest "), ", ") {
+		if i := strings.IndexByte(p, '='); i > 0 {
+			params[p[:i]] = strings.Trim(p[i+1:], `"`)
+		}
+	}
+	return params
+}
+
+func TestDigestAuth(t *testing.T) {
+	var challenges int64
+	server := digestServer("gopher", "s3cret", &challenges)
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("POST", server.URL+"/x?y=1", nil)
+	w := &Work{
+		Request:            req,
+		RequestBody:        []byte("payload"),
+		N:                  20,
+		C:                  2,
+		DigestAuthUser:     "gopher",
+		DigestAuthPassword: "s3cret",
+		Writer:             &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.report.statusCodeDist[http.StatusOK]; got != 20 {
+		t.Errorf("Expected 20 authenticated requests, found %v", w.report.statusCodeDist)
+	}
+	if challenges < 1 || challenges > 2 {
+		t.Errorf("Expected a challenge per worker, found %v", challenges)
+	}
+	if w.report.digestChallenges != challenges {
+		t.Errorf("Expected %v extra round trips, found %v", challenges, w.report.digestChallenges)
+	}
+	if !strings.Contains(out.String(), "Digest challenges:") {
+		t.Errorf("Expected the challenges in the output, found %v", out.String())
+	}
+}
+
+func TestDigestAuthWrongPassword(t *testing.T) {
+	var challenges int64
+	server := digestServer("gopher", "s3cret", &challenges)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:            req,
+		N:                  3,
+		C:                  1,
+		DigestAuthUser:     "gopher",
+		DigestAuthPassword: "wrong",
+		Reporter:           &recordingReporter{},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.report.statusCodeDist[http.StatusUnauthorized]; got != 3 {
+		t.Errorf("Expected 3 unauthorized requests, found %v", w.report.statusCodeDist)
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	c, err := parseDigestChallenge(`Digest realm="a, \"b\"", nonce="xyz", algorithm=SHA-256, qop="auth"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.realm != `a, "b"` || c.nonce != "xyz" || c.algorithm != "SHA-256" || c.qop != "auth" {
+		t.Errorf("Unexpected challenge %+v", c)
+	}
+	for _, h := range []string{"Basic realm=\"a\"", "Digest realm=\"a\"", "Digest nonce=\"n\", qop=\"auth-int\""} {
+		if _, err := parseDigestChallenge(h); err == nil {
+			t.Errorf("%q: expected an error, found none", h)
+		}
+	}
+}
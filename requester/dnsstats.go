@@ -0,0 +1,122 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dnsCacheThreshold is the duration under which a lookup is taken as
+// answered from a cache, such as that of a local resolver, rather than
+// by the name servers.
+const dnsCacheThreshold = time.Millisecond
+
+// DNSStats are the DNS lookups of a run, from DNSStats.
+type DNSStats struct {
+	Lookups     int64         // lookups made
+	Failures    int64         // lookups that failed
+	Cached      int64         // lookups shorter than a millisecond, likely answered from a cache
+	NoLookup    int64         // connections made without a lookup, to an IP address or through a proxy
+	Connections int64         // connections made, with or without a lookup
+	AvgDuration time.Duration // average duration of the lookups
+	Addrs       []string      // addresses resolved, sorted
+}
+
+// dnsTracker gathers DNSStats from the connection trace of the requests.
+type dnsTracker struct {
+	mu    sync.Mutex
+	stats DNSStats
+	total time.Duration
+	addrs map[string]bool
+}
+
+// lookup records a lookup that took d.
+func (t *dnsTracker) lookup(d time.Duration, info httptrace.DNSDoneInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats.Lookups++
+	t.total += d
+	if info.Err != nil {
+		t.stats.Failures++
+		return
+	}
+	if d < dnsCacheThreshold {
+		t.stats.Cached++
+	}
+	if t.addrs == nil {
+		t.addrs = make(map[string]bool)
+	}
+	for _, a := range info.Addrs {
+		t.addrs[a.String()] = true
+	}
+}
+
+// conn records a new connection, made after a lookup or not.
+func (t *dnsTracker) conn(looked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats.Connections++
+	if !looked {
+		t.stats.NoLookup++
+	}
+}
+
+// DNSStats returns the DNS lookups made so far, to tell whether names are
+// resolved for every connection, as with DisableKeepAlives, and by the
+// name servers or a cache, from the time they take. They do not cover
+// WebSocket, HandshakeOnly and RawMode. It returns nil before Run.
+func (b *Work) DNSStats() *DNSStats {
+	b.mu.Lock()
+	t := b.dns
+	b.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+	return t.snapshot()
+}
+
+// snapshot returns a copy of the statistics so far.
+func (t *dnsTracker) snapshot() *DNSStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.stats
+	if s.Lookups > 0 {
+		s.AvgDuration = t.total / time.Duration(s.Lookups)
+	}
+	for a := range t.addrs {
+		s.Addrs = append(s.Addrs, a)
+	}
+	sort.Strings(s.Addrs)
+	return &s
+}
+
+// printDNS prints the DNS lookups of the run, with their average
+// duration, unlike the DNS-lookup latencies which count the requests
+// made without one.
+func (r *report) printDNS() {
+	s := r.dns
+	r.printf("\nDNS lookups:\n")
+	r.printf("  Lookups:\t%d for %d new connections\n", s.Lookups, s.Connections)
+	r.printf("  Average:\t%4.4f secs\n", s.AvgDuration.Seconds())
+	if s.Failures > 0 {
+		r.printf("  Failures:\t%d\n", s.Failures)
+	}
+	r.printf("  Likely cached:\t%d under %v\n", s.Cached, dnsCacheThreshold)
+	r.printf("  Addresses:\t%s\n", strings.Join(s.Addrs, ", "))
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDNSStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// A name is looked up for every connection.
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	req, _ := http.NewRequest("GET", url, nil)
+	var out bytes.Buffer
+	w := &Work{Request: req, N: 10, C: 1, Writer: &out, DisableKeepAlives: true}
+	if w.DNSStats() != nil {
+		t.Error("Expected no DNS stats before Run")
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s := w.DNSStats()
+	if s.Lookups != 10 || s.Connections != 10 || s.NoLookup != 0 {
+		t.Errorf("Expected a lookup for each of 10 connections, found %+v", s)
+	}
+	var found bool
+	for _, a := range s.Addrs {
+		found = found || a == "127.0.0.1"
+	}
+	if !found || s.AvgDuration <= 0 {
+		t.Errorf("Expected localhost resolved to 127.0.0.1, found %+v", s)
+	}
+	if !strings.Contains(out.String(), "DNS lookups:\n  Lookups:\t10 for 10 new connections") {
+		t.Errorf("Expected the lookups in the summary, found %q", out.String())
+	}
+
+	// An address needs no lookup.
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	out.Reset()
+	w = &Work{Request: req, N: 10, C: 1, Writer: &out, DisableKeepAlives: true}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if s := w.DNSStats(); s.Lookups != 0 || s.NoLookup != 10 {
+		t.Errorf("Expected 10 connections without a lookup, found %+v", s)
+	}
+	if strings.Contains(out.String(), "DNS lookups:") {
+		t.Errorf("Expected no lookups in the summary, found %q", out.String())
+	}
+}
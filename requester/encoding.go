@@ -0,0 +1,60 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// contentEncoding returns the content coding of a response, in lower
+// case, or "identity" if it has none.
+func contentEncoding(h string) string {
+	h = strings.ToLower(strings.TrimSpace(h))
+	if h == "" {
+		return "identity"
+	}
+	return h
+}
+
+// decodeBody returns a reader of the decoded content of body, encoded
+// with coding, or nil if the coding is not supported or the body is not
+// valid. The reader must be closed.
+func decodeBody(body io.Reader, coding string) io.ReadCloser {
+	switch coding {
+	case "gzip", "x-gzip":
+		if gz, err := gzip.NewReader(body); err == nil {
+			return gz
+		}
+	case "deflate":
+		if zr, err := zlib.NewReader(body); err == nil {
+			return zr
+		}
+	case "br":
+		return ioutil.NopCloser(brotli.NewReader(body))
+	case "zstd":
+		// A single goroutine is enough for a single stream.
+		if zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1)); err == nil {
+			return zr.IOReadCloser()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func encode(t *testing.T, coding, s string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		var err error
+		if w, err = zstd.NewWriter(&buf); err != nil {
+			t.Fatal(err)
+		}
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	}
+	w.Write([]byte(s))
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	plain := strings.Repeat("hey ", 1000)
+	for _, coding := range []string{"br", "zstd", "deflate"} {
+		encoded := encode(t, coding, plain)
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", coding)
+			w.Write(encoded)
+		}
+		server := httptest.NewServer(http.HandlerFunc(handler))
+
+		rep := &recordingReporter{}
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{
+			Request:        req,
+			N:              2,
+			C:              1,
+			AcceptEncoding: coding,
+			Reporter:       rep,
+		}
+		w.Run()
+		server.Close()
+		for _, res := range rep.results {
+			if !res.Compressed || res.Encoding != coding {
+				t.Errorf("Expected a %v encoded response, found %v", coding, res.Encoding)
+			}
+			if res.WireSize != int64(len(encoded)) || res.BodySize != int64(len(plain)) {
+				t.Errorf("%v: expected %v bytes on the wire and %v decoded, found %v and %v",
+					coding, len(encoded), len(plain), res.WireSize, res.BodySize)
+			}
+		}
+		if got := w.EncodingDist(); !reflect.DeepEqual(got, map[string]int{coding: 2}) {
+			t.Errorf("Expected 2 %v responses, found %v", coding, got)
+		}
+	}
+}
+
+func TestEncodingDistOutput(t *testing.T) {
+	encoded := encode(t, "br", "hey")
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") == "br" {
+			w.Header().Set("Content-Encoding", "br")
+			w.Write(encoded)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		acceptEncoding string
+		want           bool
+	}{{"br", true}, {"identity", false}} {
+		var out bytes.Buffer
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{Request: req, N: 1, C: 1, AcceptEncoding: tt.acceptEncoding, Writer: &out}
+		w.Run()
+		if got := strings.Contains(out.String(), "Content encoding distribution:"); got != tt.want {
+			t.Errorf("%v: expected the encoding distribution to be printed: %v, found %v", tt.acceptEncoding, tt.want, got)
+		}
+	}
+}
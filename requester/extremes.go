@@ -0,0 +1,99 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// extremes keeps the n slowest, or fastest, successful results of a run,
+// for ShowSlowest and ShowFastest.
+type extremes struct {
+	n       int
+	slowest bool
+	heap    []Result // the least extreme result first
+}
+
+func newExtremes(n int, slowest bool) *extremes {
+	return &extremes{n: n, slowest: slowest}
+}
+
+func (e *extremes) Len() int { return len(e.heap) }
+
+func (e *extremes) Less(i, j int) bool {
+	if e.slowest {
+		return e.heap[i].Duration < e.heap[j].Duration
+	}
+	return e.heap[i].Duration > e.heap[j].Duration
+}
+
+func (e *extremes) Swap(i, j int)      { e.heap[i], e.heap[j] = e.heap[j], e.heap[i] }
+func (e *extremes) Push(x interface{}) { e.heap = append(e.heap, x.(Result)) }
+
+func (e *extremes) Pop() interface{} {
+	res := e.heap[len(e.heap)-1]
+	e.heap = e.heap[:len(e.heap)-1]
+	return res
+}
+
+// add keeps res if it is among the n most extreme results so far.
+func (e *extremes) add(res *Result) {
+	if len(e.heap) < e.n {
+		heap.Push(e, *res)
+		return
+	}
+	if !e.more(res) {
+		return
+	}
+	e.heap[0] = *res
+	heap.Fix(e, 0)
+}
+
+// more reports whether res is more extreme than the least extreme result
+// kept.
+func (e *extremes) more(res *Result) bool {
+	if e.slowest {
+		return res.Duration > e.heap[0].Duration
+	}
+	return res.Duration < e.heap[0].Duration
+}
+
+// sorted returns the results kept, the most extreme first.
+func (e *extremes) sorted() []Result {
+	s := append([]Result(nil), e.heap...)
+	sort.Slice(s, func(i, j int) bool {
+		if e.slowest {
+			return s[i].Duration > s[j].Duration
+		}
+		return s[i].Duration < s[j].Duration
+	})
+	return s
+}
+
+// printExtremes prints the results of e with their URL, status and
+// timing breakdown, so that they can be reproduced.
+func (r *report) printExtremes(e *extremes) {
+	if e.slowest {
+		r.printf("\n%d slowest requests (total, DNS+dialup, req write, resp wait, resp read):\n", len(e.heap))
+	} else {
+		r.printf("\n%d fastest requests (total, DNS+dialup, req write, resp wait, resp read):\n", len(e.heap))
+	}
+	for _, res := range e.sorted() {
+		r.printf("  %4.4f, %4.4f, %4.4f, %4.4f, %4.4f secs\t[%d]\t%s\n",
+			res.Duration.Seconds(), res.ConnDuration.Seconds(), res.ReqDuration.Seconds(),
+			res.DelayDuration.Seconds(), res.ResDuration.Seconds(), res.StatusCode, res.URL)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtremes(t *testing.T) {
+	slowest, fastest := newExtremes(3, true), newExtremes(3, false)
+	for _, ms := range []int{5, 1, 9, 3, 7, 2, 8, 4, 6} {
+		res := &Result{Duration: time.Duration(ms) * time.Millisecond}
+		slowest.add(res)
+		fastest.add(res)
+	}
+	durations := func(e *extremes) []time.Duration {
+		var ds []time.Duration
+		for _, res := range e.sorted() {
+			ds = append(ds, res.Duration/time.Millisecond)
+		}
+		return ds
+	}
+	if got := durations(slowest); len(got) != 3 || got[0] != 9 || got[1] != 8 || got[2] != 7 {
+		t.Errorf("Expected the 3 slowest, 9, 8 and 7ms, found %v", got)
+	}
+	if got := durations(fastest); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("Expected the 3 fastest, 1, 2 and 3ms, found %v", got)
+	}
+}
+
+func TestShowSlowest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, _ := strconv.Atoi(r.URL.Query().Get("ms"))
+		time.Sleep(time.Duration(d) * time.Millisecond)
+	}))
+	defer server.Close()
+
+	urls := server.URL + "/?ms=1\n" + server.URL + "/?ms=50\n"
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 6, C: 1, URLFile: writeTempFile(t, urls), ShowSlowest: 2, ShowFastest: 1, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s := out.String()
+	i := strings.Index(s, "2 slowest requests")
+	j := strings.Index(s, "1 fastest requests")
+	if i < 0 || j < i {
+		t.Fatalf("Expected the slowest and fastest requests in the summary, found %q", s)
+	}
+	if slow := s[i:j]; strings.Count(slow, "/?ms=50") != 2 || !strings.Contains(slow, "[200]") {
+		t.Errorf("Expected the 2 slowest requests to be those of 50ms, found %q", slow)
+	}
+	if fast := s[j:]; !strings.Contains(fast, "/?ms=1\n") {
+		t.Errorf("Expected the fastest request to be one of 1ms, found %q", fast)
+	}
+}
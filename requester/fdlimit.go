@@ -0,0 +1,34 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import "fmt"
+
+// fdReserve is the number of file descriptors left for the process
+// itself: standard streams, files, resolvers and the like.
+const fdReserve = 16
+
+// checkFDLimit returns an error if the run would need more connections
+// than the process can open.
+func (b *Work) checkFDLimit() error {
+	limit := fdLimit()
+	if limit == 0 {
+		return nil
+	}
+	if b.C+b.PrewarmConns > limit-fdReserve {
+		return fmt.Errorf("requester: concurrency %d exceeds fd limit %d, raise it with ulimit -n", b.C+b.PrewarmConns, limit)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckFDLimit(t *testing.T) {
+	limit := fdLimit()
+	if limit == 0 {
+		t.Skip("fd limit unknown")
+	}
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: limit, C: limit, CheckFDLimit: true, Writer: ioutil.Discard}
+	err := w.Run()
+	want := fmt.Sprintf("concurrency %d exceeds fd limit %d", limit, limit)
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected an error with %q, found %v", want, err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no requests, found %v", count)
+	}
+
+	w = &Work{Request: req, N: 10, C: 2, CheckFDLimit: true, Writer: ioutil.Discard}
+	if err := w.Run(); err != nil {
+		t.Errorf("Expected no error, found %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/codes"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcReflectionPaths are the server reflection methods, tried in turn.
+// Their messages are the same.
+var grpcReflectionPaths = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// grpcCall is the unary method called with GRPCMethod.
+type grpcCall struct {
+	path  string // "/package.Service/Method"
+	input protoreflect.MessageDescriptor
+	web   string // GRPCWeb
+
+	// The request message of RequestBody, which most requests send,
+	// encoded once.
+	body  []byte
+	frame []byte
+}
+
+// resolveGRPC looks up the GRPCMethod descriptor, in GRPCProtoset or
+// with server reflection using c, and encodes RequestBody.
+func (b *Work) resolveGRPC(ctx context.Context, c *http.Client) (*grpcCall, error) {
+	name := strings.TrimPrefix(b.GRPCMethod, "/")
+	i := strings.LastIndex(name, "/")
+	if i <= 0 || i == len(name)-1 {
+		return nil, fmt.Errorf("requester: invalid gRPC method %q, expected package.Service/Method", b.GRPCMethod)
+	}
+	service, method := name[:i], name[i+1:]
+	var files *protoregistry.Files
+	var err error
+	if b.GRPCProtoset != "" {
+		files, err = loadProtoset(b.GRPCProtoset)
+	} else {
+		files, err = b.reflectFiles(ctx, c, service)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("requester: resolving gRPC method %s: %v", b.GRPCMethod, err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("requester: gRPC service %s not found", service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("requester: %s is not a gRPC service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("requester: gRPC method %s not found in %s", method, service)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("requester: gRPC method %s is not unary", b.GRPCMethod)
+	}
+	g := &grpcCall{path: "/" + service + "/" + method, input: md.Input(), web: b.GRPCWeb}
+	if g.frame, err = g.encode(b.RequestBody); err != nil {
+		return nil, err
+	}
+	g.body = b.RequestBody
+	return g, nil
+}
+
+// encode returns the request message of the JSON body, framed as gRPC,
+// or gRPC-Web, sends it. An empty body is the empty message.
+func (g *grpcCall) encode(body []byte) ([]byte, error) {
+	if g.frame != nil && bytes.Equal(body, g.body) {
+		return g.frame, nil
+	}
+	msg := dynamicpb.NewMessage(g.input)
+	if len(body) > 0 {
+		if err := protojson.Unmarshal(body, msg); err != nil {
+			return nil, fmt.Errorf("requester: invalid %s message: %v", g.input.FullName(), err)
+		}
+	}
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return g.wrap(grpcFrame(raw)), nil
+}
+
+// wrap returns frame as the request body of the call.
+func (g *grpcCall) wrap(frame []byte) []byte {
+	if g.web == "text" {
+		return []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+	return frame
+}
+
+// prepare turns req into a call of the method.
+func (g *grpcCall) prepare(req *http.Request) {
+	req.Method = "POST"
+	u := *req.URL
+	u.Path, u.RawPath, u.RawQuery = g.path, "", ""
+	req.URL = &u
+	if g.web != "" {
+		req.Header.Set("Content-Type", grpcWebContentTypes[g.web])
+		req.Header.Set("X-Grpc-Web", "1")
+		return
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+}
+
+// grpcFrame returns msg prefixed as an uncompressed gRPC message.
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	copy(frame[5:], msg)
+	return frame
+}
+
+// readGRPCFrame reads a gRPC message from r.
+func readGRPCFrame(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed gRPC messages are not supported")
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// grpcStatus returns the name of the gRPC status of resp, such as "OK"
+// or "NotFound", or "" if there is none. The body of resp must have been
+// read for the trailers to be available.
+func grpcStatus(resp *http.Response) (string, string) {
+	// Responses without a message may carry the status in their headers.
+	h := resp.Header
+	if h.Get("Grpc-Status") == "" {
+		h = resp.Trailer
+	}
+	return grpcCodeName(h.Get("Grpc-Status")), h.Get("Grpc-Message")
+}
+
+// grpcCodeName returns the name of the gRPC status code v, or v if it is
+// not a number.
+func grpcCodeName(v string) string {
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return v
+	}
+	return codes.Code(n).String()
+}
+
+// invokeGRPC makes a call of the method at path, with the message msg,
+// to the host of Request, and returns the response message.
+func (b *Work) invokeGRPC(ctx context.Context, c *http.Client, path string, msg []byte) ([]byte, string, error) {
+	call := &grpcCall{path: path, web: b.GRPCWeb}
+	req := cloneRequest(b.Request, call.wrap(grpcFrame(msg)))
+	call.prepare(req)
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected HTTP status %d", resp.StatusCode)
+	}
+	var res []byte
+	var status, message string
+	if call.web != "" {
+		frames := newGRPCWebFrames(resp.Header)
+		frames.keepFirst = true
+		io.Copy(frames, resp.Body)
+		res = frames.first
+		status, message = frames.status(resp.Header)
+	} else {
+		if res, err = readGRPCFrame(resp.Body); err != nil && err != io.EOF {
+			return nil, "", err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		status, message = grpcStatus(resp)
+	}
+	if status != codes.OK.String() {
+		if status == "" {
+			return nil, "", errors.New("no gRPC status in response")
+		}
+		return nil, status, fmt.Errorf("gRPC status %s: %s", status, message)
+	}
+	return res, status, nil
+}
+
+// reflectFiles asks the server for the file that defines service and
+// the files it depends on.
+func (b *Work) reflectFiles(ctx context.Context, c *http.Client, service string) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	req := &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}
+	paths := grpcReflectionPaths
+	for req != nil {
+		msg, err := proto.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		raw, status, err := b.invokeGRPC(ctx, c, paths[0], msg)
+		if status == codes.Unimplemented.String() && len(paths) > 1 {
+			paths = paths[1:]
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("server reflection: %v", err)
+		}
+		var res reflectionpb.ServerReflectionResponse
+		if err := proto.Unmarshal(raw, &res); err != nil {
+			return nil, fmt.Errorf("server reflection: %v", err)
+		}
+		if e := res.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("server reflection: %s", e.GetErrorMessage())
+		}
+		for _, raw := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, fd); err != nil {
+				return nil, fmt.Errorf("server reflection: %v", err)
+			}
+			if !seen[fd.GetName()] {
+				seen[fd.GetName()] = true
+				set.File = append(set.File, fd)
+			}
+		}
+		// Ask for the dependencies the server left out, one at a time.
+		req = nil
+		for _, fd := range set.File {
+			for _, dep := range fd.GetDependency() {
+				if !seen[dep] && req == nil {
+					seen[dep] = true
+					req = &reflectionpb.ServerReflectionRequest{
+						MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+					}
+				}
+			}
+		}
+	}
+	return protodesc.NewFiles(set)
+}
+
+// loadProtoset loads a FileDescriptorSet, as written by protoc with
+// --include_imports and --descriptor_set_out.
+func loadProtoset(path string) (*protoregistry.Files, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("invalid protoset %s: %v", path, err)
+	}
+	return protodesc.NewFiles(set)
+}
+
+// grpcTransport returns the HTTP/2 transport of gRPC calls, which speaks
+// HTTP/2 without TLS to http URLs. Its connections are dialed with
+// dialContext, so that LocalAddrs, DNSRoundRobin and MaxBandwidth apply.
+func (b *Work) grpcTransport(tlsConfig *tls.Config) http.RoundTripper {
+	tr := &http2.Transport{TLSClientConfig: tlsConfig, DisableCompression: true}
+	dial := b.dialContext()
+	if b.Request.URL.Scheme == "http" {
+		tr.AllowHTTP = true
+		tr.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		}
+	} else {
+		tr.DialTLSContext = func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			tc := tls.Client(conn, cfg)
+			if err := tc.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tc, nil
+		}
+	}
+	return tr
+}
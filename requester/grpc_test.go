@@ -0,0 +1,173 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// startGRPCServer starts a gRPC server with the health service, and
+// server reflection if reflect is set, and returns its URL.
+func startGRPCServer(t *testing.T, reflect bool) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	if reflect {
+		reflection.Register(s)
+	}
+	go s.Serve(l)
+	return "http://" + l.Addr().String(), s.Stop
+}
+
+func TestGRPCReflection(t *testing.T) {
+	url, stop := startGRPCServer(t, true)
+	defer stop()
+
+	for body, want := range map[string]string{
+		`{"service": ""}`:        "OK",
+		`{"service": "missing"}`: "NotFound",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := &Work{
+			Request:     req,
+			RequestBody: []byte(body),
+			GRPCMethod:  "grpc.health.v1.Health/Check",
+			N:           10,
+			C:           2,
+			Writer:      ioutil.Discard,
+		}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.GRPCStatusDist(); !reflect.DeepEqual(got, map[string]int{want: 10}) {
+			t.Errorf("Expected 10 %v calls for %v, found %v", want, body, got)
+		}
+	}
+}
+
+func TestGRPCProtoset(t *testing.T) {
+	url, stop := startGRPCServer(t, false)
+	defer stop()
+
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto)},
+	}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "hey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "health.protoset")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", url, nil)
+	w := &Work{
+		Request:      req,
+		GRPCMethod:   "/grpc.health.v1.Health/Check",
+		GRPCProtoset: path,
+		N:            5,
+		C:            1,
+		Writer:       ioutil.Discard,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.GRPCStatusDist(); !reflect.DeepEqual(got, map[string]int{"OK": 5}) {
+		t.Errorf("Expected 5 OK calls, found %v", got)
+	}
+}
+
+func TestGRPCInvalid(t *testing.T) {
+	url, stop := startGRPCServer(t, true)
+	defer stop()
+
+	for _, tt := range []struct {
+		method, body string
+	}{
+		{"grpc.health.v1.Health", ""},
+		{"grpc.health.v1.Health/Missing", ""},
+		{"grpc.health.v1.Missing/Check", ""},
+		{"grpc.health.v1.Health/Watch", ""},
+		{"grpc.health.v1.Health/Check", `{"missing": 1}`},
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := &Work{
+			Request:     req,
+			RequestBody: []byte(tt.body),
+			GRPCMethod:  tt.method,
+			N:           1,
+			C:           1,
+			Writer:      ioutil.Discard,
+		}
+		if err := w.Run(); err == nil {
+			t.Errorf("Expected an error for %v %v", tt.method, tt.body)
+		}
+	}
+}
+
+func TestGRPCTLSDialer(t *testing.T) {
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	server := httptest.NewUnstartedServer(s)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:      req,
+		RequestBody:  []byte(`{"service": ""}`),
+		GRPCMethod:   "grpc.health.v1.Health/Check",
+		N:            5,
+		C:            1,
+		Writer:       ioutil.Discard,
+		MaxBandwidth: 1 << 20,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.GRPCStatusDist(); !reflect.DeepEqual(got, map[string]int{"OK": 5}) {
+		t.Errorf("Expected 5 OK calls, found %v", got)
+	}
+	// The connections over TLS are dialed with the limiter.
+	if w.report.bandwidthBytes == 0 {
+		t.Error("Expected the bandwidth of the calls to be counted")
+	}
+}
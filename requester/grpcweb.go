@@ -0,0 +1,137 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"strings"
+)
+
+// grpcWebContentTypes are the request content types of GRPCWeb.
+var grpcWebContentTypes = map[string]string{
+	"binary": "application/grpc-web+proto",
+	"text":   "application/grpc-web-text",
+}
+
+// grpcWebFrames parses the frames of a gRPC-Web response body as it is
+// written to it: length-prefixed messages, then a frame of trailers,
+// base64 encoded for the text content types.
+type grpcWebFrames struct {
+	text    bool
+	pending []byte // base64 text not yet decoded, less than a quantum
+
+	prefix  [5]byte
+	n       int // bytes of prefix read
+	left    int // bytes of the current frame left to read
+	trailer bool
+
+	messages int
+	first    []byte // the first message, if keepFirst is set
+	trailers []byte // the trailer frame, in the HTTP/1 header format
+	hasTrail bool
+
+	keepFirst bool
+}
+
+// newGRPCWebFrames returns the parser of the body of resp.
+func newGRPCWebFrames(h http.Header) *grpcWebFrames {
+	return &grpcWebFrames{text: strings.HasPrefix(h.Get("Content-Type"), "application/grpc-web-text")}
+}
+
+func (f *grpcWebFrames) Write(p []byte) (int, error) {
+	if !f.text {
+		f.parse(p)
+		return len(p), nil
+	}
+	// Padded base64 chunks may be concatenated, so decode quantum by
+	// quantum.
+	var buf [3]byte
+	for _, c := range p {
+		if c == '\r' || c == '\n' || c == ' ' {
+			continue
+		}
+		f.pending = append(f.pending, c)
+		if len(f.pending) == 4 {
+			n, err := base64.StdEncoding.Decode(buf[:], f.pending)
+			f.pending = f.pending[:0]
+			if err != nil {
+				continue
+			}
+			f.parse(buf[:n])
+		}
+	}
+	return len(p), nil
+}
+
+// parse parses the decoded bytes of the body.
+func (f *grpcWebFrames) parse(p []byte) {
+	for len(p) > 0 {
+		if f.n < len(f.prefix) {
+			c := copy(f.prefix[f.n:], p)
+			f.n += c
+			p = p[c:]
+			if f.n < len(f.prefix) {
+				return
+			}
+			f.trailer = f.prefix[0]&0x80 != 0
+			f.left = int(binary.BigEndian.Uint32(f.prefix[1:]))
+		}
+		c := min(f.left, len(p))
+		switch {
+		case f.trailer:
+			f.trailers = append(f.trailers, p[:c]...)
+		case f.keepFirst && f.messages == 0:
+			f.first = append(f.first, p[:c]...)
+		}
+		f.left -= c
+		p = p[c:]
+		if f.left == 0 {
+			f.end()
+		}
+	}
+}
+
+// end records the frame just read.
+func (f *grpcWebFrames) end() {
+	if f.trailer {
+		f.hasTrail = true
+	} else {
+		f.messages++
+	}
+	f.n = 0
+}
+
+// status returns the gRPC status and message of the response, from the
+// trailer frame, or from the headers h of trailers-only responses.
+func (f *grpcWebFrames) status(h http.Header) (string, string) {
+	if f.hasTrail {
+		h = make(http.Header)
+		for _, line := range bytes.Split(f.trailers, []byte("\n")) {
+			if i := bytes.IndexByte(line, ':'); i > 0 {
+				h.Add(string(bytes.TrimSpace(line[:i])), string(bytes.TrimSpace(line[i+1:])))
+			}
+		}
+	}
+	return grpcCodeName(h.Get("Grpc-Status")), h.Get("Grpc-Message")
+}
+
+func (r *report) printGRPCWeb() {
+	r.printf("\ngRPC-Web frames:\n")
+	r.printf("  Messages:\t%d in %d responses\n", r.grpcWebMessages, r.grpcWebResponses)
+	r.printf("  Trailer frames:\t%d responses\n", r.grpcWebTrailers)
+}
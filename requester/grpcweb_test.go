@@ -0,0 +1,147 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// grpcWebHealth serves the Check method of the health service over
+// gRPC-Web, as a proxy in front of a gRPC server would: the empty service
+// is serving, and others are not found, with a trailers-only response.
+func grpcWebHealth(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/grpc.health.v1.Health/Check" || r.Header.Get("X-Grpc-Web") != "1" {
+			t.Errorf("Expected a gRPC-Web call, found %v with %v", r.URL.Path, r.Header)
+		}
+		ct := r.Header.Get("Content-Type")
+		text := ct == "application/grpc-web-text"
+		body, _ := ioutil.ReadAll(r.Body)
+		if text {
+			body, _ = base64.StdEncoding.DecodeString(string(body))
+		}
+		msg, err := readGRPCFrame(bytes.NewReader(body))
+		if err != nil {
+			t.Errorf("Expected a request message, found %v", err)
+		}
+		var req healthpb.HealthCheckRequest
+		proto.Unmarshal(msg, &req)
+		w.Header().Set("Content-Type", ct)
+		if req.Service != "" {
+			w.Header().Set("Grpc-Status", "5")
+			return
+		}
+		res, _ := proto.Marshal(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+		trailers := []byte("grpc-status: 0\r\ngrpc-message: \r\n")
+		frames := [][]byte{grpcFrame(res), grpcFrame(trailers)}
+		frames[1][0] = 0x80
+		for _, f := range frames {
+			if text {
+				// Each frame is encoded on its own, padding included.
+				f = []byte(base64.StdEncoding.EncodeToString(f))
+			}
+			w.Write(f)
+		}
+	})
+}
+
+func healthProtoset(t *testing.T) string {
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto)},
+	}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeTempFile(t, string(data))
+}
+
+func TestGRPCWeb(t *testing.T) {
+	server := httptest.NewServer(grpcWebHealth(t))
+	defer server.Close()
+	protoset := healthProtoset(t)
+	defer os.Remove(protoset)
+
+	for _, mode := range []string{"binary", "text"} {
+		for body, want := range map[string]string{
+			`{"service": ""}`:        "OK",
+			`{"service": "missing"}`: "NotFound",
+		} {
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			rr := &recordingReporter{}
+			w := &Work{
+				Request:      req,
+				RequestBody:  []byte(body),
+				GRPCMethod:   "grpc.health.v1.Health/Check",
+				GRPCProtoset: protoset,
+				GRPCWeb:      mode,
+				N:            6,
+				C:            2,
+				Reporter:     rr,
+			}
+			if err := w.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.GRPCStatusDist(); !reflect.DeepEqual(got, map[string]int{want: 6}) {
+				t.Errorf("%s: expected 6 %v calls for %v, found %v", mode, want, body, got)
+			}
+			for _, res := range rr.results {
+				if want == "OK" && (res.GRPCWebMessages != 1 || !res.GRPCWebTrailers) {
+					t.Errorf("%s: expected a message and a trailer frame, found %v and %v", mode, res.GRPCWebMessages, res.GRPCWebTrailers)
+				}
+				if want == "NotFound" && (res.GRPCWebMessages != 0 || res.GRPCWebTrailers) {
+					t.Errorf("%s: expected a trailers-only response, found %v messages", mode, res.GRPCWebMessages)
+				}
+			}
+		}
+	}
+}
+
+func TestGRPCWebFramesSplit(t *testing.T) {
+	trailer := grpcFrame([]byte("grpc-status: 14\r\ngrpc-message: down\r\n"))
+	trailer[0] = 0x80
+	body := append(append(grpcFrame([]byte("ab")), grpcFrame(nil)...), trailer...)
+	text := base64.StdEncoding.EncodeToString(body)
+	for _, tt := range []struct {
+		ct   string
+		body string
+	}{
+		{"application/grpc-web+proto", string(body)},
+		{"application/grpc-web-text", text},
+	} {
+		// Writing a byte at a time splits the frames and base64 quanta
+		// anywhere.
+		f := newGRPCWebFrames(http.Header{"Content-Type": {tt.ct}})
+		for _, c := range []byte(tt.body) {
+			f.Write([]byte{c})
+		}
+		status, message := f.status(nil)
+		if f.messages != 2 || status != "Unavailable" || message != "down" {
+			t.Errorf("%s: expected 2 messages and Unavailable: down, found %v and %v: %v", tt.ct, f.messages, status, message)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/http2"
+)
+
+// h2Pool spreads requests over a fixed number of HTTP/2 connections,
+// each with its own transport, sending each request on the connection
+// with the fewest streams open and, with maxStreams, waiting for one
+// with fewer than maxStreams.
+type h2Pool struct {
+	maxStreams int
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	conns []*h2Conn
+}
+
+// h2Conn is a connection of an h2Pool.
+type h2Conn struct {
+	rt       http.RoundTripper
+	streams  int   // streams open
+	peak     int   // most streams open at once
+	requests int64 // requests sent
+}
+
+// newH2Pool returns a pool of conns connections, dialed with dial, which
+// speak HTTP/2 without TLS if plain.
+func newH2Pool(conns, maxStreams int, tlsConfig *tls.Config, dial func(ctx context.Context, network, addr string) (net.Conn, error), plain, disableCompression bool) *h2Pool {
+	p := &h2Pool{maxStreams: maxStreams}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < conns; i++ {
+		tr := &http2.Transport{
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: disableCompression,
+			AllowHTTP:          true,
+			// Queue requests on the connection rather than opening
+			// another past the streams the server allows.
+			StrictMaxConcurrentStreams: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dial(ctx, network, addr)
+				if err != nil || plain {
+					return conn, err
+				}
+				tc := tls.Client(conn, cfg)
+				if err := tc.HandshakeContext(ctx); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return tc, nil
+			},
+		}
+		p.conns = append(p.conns, &h2Conn{rt: tr})
+	}
+	return p
+}
+
+func (p *h2Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := p.acquire()
+	resp, err := c.rt.RoundTrip(req)
+	if err != nil {
+		p.release(c)
+		return nil, err
+	}
+	// The stream stays open until the body is read or closed.
+	resp.Body = &h2Body{ReadCloser: resp.Body, release: func() { p.release(c) }}
+	return resp, nil
+}
+
+// acquire returns the connection with the fewest streams open, waiting
+// for one under maxStreams, and counts a stream open on it.
+func (p *h2Pool) acquire() *h2Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		c := p.conns[0]
+		for _, cc := range p.conns[1:] {
+			if cc.streams < c.streams {
+				c = cc
+			}
+		}
+		if p.maxStreams == 0 || c.streams < p.maxStreams {
+			c.streams++
+			c.requests++
+			if c.streams > c.peak {
+				c.peak = c.streams
+			}
+			return c
+		}
+		p.cond.Wait()
+	}
+}
+
+// stats returns a copy of the connections, with their counts.
+func (p *h2Pool) stats() []h2Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := make([]h2Conn, len(p.conns))
+	for i, c := range p.conns {
+		conns[i] = *c
+	}
+	return conns
+}
+
+func (p *h2Pool) release(c *h2Conn) {
+	p.mu.Lock()
+	c.streams--
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+// h2Body releases the stream of a response once its body is read to the
+// end or closed.
+type h2Body struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *h2Body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *h2Body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// printH2Conns prints the requests and the most concurrent streams of
+// each connection of H2Conns.
+func (r *report) printH2Conns() {
+	r.printf("\nHTTP/2 connections (requests, peak concurrent streams):\n")
+	for i, c := range r.h2Conns {
+		r.printf("  [%d]\t%d requests, %d streams\n", i+1, c.requests, c.peak)
+	}
+}
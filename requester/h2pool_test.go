@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestH2Conns(t *testing.T) {
+	var mu sync.Mutex
+	open := make(map[string]int) // streams open by connection
+	peak := make(map[string]int)
+	var protos []int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		open[r.RemoteAddr]++
+		if open[r.RemoteAddr] > peak[r.RemoteAddr] {
+			peak[r.RemoteAddr] = open[r.RemoteAddr]
+		}
+		protos = append(protos, r.ProtoMajor)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		open[r.RemoteAddr]--
+		mu.Unlock()
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 80, C: 8, H2: true, H2Conns: 2, H2MaxConcurrentStreams: 3, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range protos {
+		if p != 2 {
+			t.Fatalf("Expected HTTP/2 requests, found HTTP/%d", p)
+		}
+	}
+	if len(peak) != 2 {
+		t.Errorf("Expected 2 connections, found %v", peak)
+	}
+	for addr, n := range peak {
+		if n > 3 {
+			t.Errorf("Expected at most 3 streams per connection, found %v on %s", n, addr)
+		}
+	}
+	var requests int64
+	for _, c := range w.report.h2Conns {
+		requests += c.requests
+		if c.peak != 3 {
+			t.Errorf("Expected a peak of 3 streams, found %v", c.peak)
+		}
+	}
+	if len(w.report.h2Conns) != 2 || requests != 80 {
+		t.Errorf("Expected 80 requests over 2 connections, found %v over %v", requests, len(w.report.h2Conns))
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+)
+
+// handshake connects to the request URL, completing the TLS handshake of
+// https URLs, closes the connection and sends the result to the
+// reporter, without making a request. The dial is reported as the
+// connection duration and the handshake as the TLS duration.
+func (b *Work) handshake() {
+	u := b.Request.URL
+	ctx := b.ctx
+	if b.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(b.Timeout)*time.Second)
+		defer cancel()
+	}
+	s := time.Now()
+	res := &Result{URL: u.String(), Start: s}
+	conn, err := b.dialContext()(ctx, "tcp", hostPort(u))
+	if err == nil {
+		res.ConnDuration = time.Now().Sub(s)
+		res.IPFamily = ipFamily(conn.RemoteAddr())
+		if u.Scheme == "https" {
+			cfg := b.tlsConfig()
+			if cfg.ServerName == "" {
+				cfg.ServerName = u.Hostname()
+			}
+			tc := tls.Client(conn, cfg)
+			tlsStart := time.Now()
+			err = tc.HandshakeContext(ctx)
+			res.TLSDuration = time.Now().Sub(tlsStart)
+			if err == nil {
+				state := tc.ConnectionState()
+				res.TLSVersion, res.CipherSuite = state.Version, state.CipherSuite
+				res.ALPN = state.NegotiatedProtocol
+				res.ServerName = state.ServerName
+			}
+		}
+		conn.Close()
+	}
+	if err != nil && b.ctx.Err() != nil {
+		// The run was canceled, not the connection failed.
+		b.canceled()
+		return
+	}
+	res.Duration, res.Err = time.Now().Sub(s), err
+	b.results <- res
+}
+
+// printHandshakes prints the rate and failures of a HandshakeOnly run.
+func (r *report) printHandshakes() {
+	var failed int64
+	for _, n := range r.errorDist {
+		failed += int64(n)
+	}
+	completed := r.numRes - failed
+	r.printf("\nHandshakes:\n")
+	r.printf("  Completed:\t%d of %d\n", completed, r.numRes)
+	if r.total > 0 {
+		r.printf("  Handshakes/sec:\t%4.4f\n", float64(completed)/r.total.Seconds())
+	}
+	r.printf("  Failure rate:\t%4.1f%%\n", 100*float64(failed)/float64(r.numRes))
+}
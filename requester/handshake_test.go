@@ -0,0 +1,83 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandshakeOnly(t *testing.T) {
+	var requests int64
+	var conns int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+	}))
+	server.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 10, C: 2, HandshakeOnly: true, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no requests, found %v", requests)
+	}
+	if n := atomic.LoadInt64(&conns); n != 10 {
+		t.Errorf("Expected 10 connections, found %v", n)
+	}
+	if len(w.report.lats) != 10 || w.report.avgTLS == 0 {
+		t.Errorf("Expected 10 TLS handshakes, found %v with an average of %v", len(w.report.lats), w.report.avgTLS)
+	}
+	for _, want := range []string{"Completed:\t10 of 10", "Handshakes/sec:", "Failure rate:\t 0.0%", "TLS handshake distribution"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, found %v", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Status code distribution") {
+		t.Errorf("Expected no status codes in the output, found %v", out.String())
+	}
+}
+
+func TestHandshakeOnlyFailures(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", "http://"+addr, nil)
+	w := &Work{Request: req, N: 4, C: 1, HandshakeOnly: true, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Completed:\t0 of 4") || !strings.Contains(out.String(), "Failure rate:\t100.0%") {
+		t.Errorf("Expected the failed connections in the output, found %v", out.String())
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HAR (HTTP Archive) types, limited to the fields needed to replay requests.
+// See http://www.softwareishard.com/blog/har-12-spec/.
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time  `json:"startedDateTime"`
+	Request         harRequest `json:"request"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []harNameValue `json:"params"`
+}
+
+// harSkipHeaders are recorded headers that must not be replayed as is,
+// because the transport computes them for each request.
+var harSkipHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+}
+
+// loadHAR reads the HAR file at path and converts each entry into a target.
+// Each target waits for the time elapsed since the previous entry started.
+func loadHAR(path string) ([]*target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var har harFile
+	if err := json.NewDecoder(f).Decode(&har); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(har.Log.Entries) == 0 {
+		return nil, fmt.Errorf("%s: no entries found", path)
+	}
+	targets := make([]*target, 0, len(har.Log.Entries))
+	var prev time.Time
+	for i, e := range har.Log.Entries {
+		t, err := harTarget(e.Request)
+		if err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %v", path, i, err)
+		}
+		if i > 0 && e.StartedDateTime.After(prev) {
+			t.wait = e.StartedDateTime.Sub(prev)
+		}
+		prev = e.StartedDateTime
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func harTarget(r harRequest) (*target, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q", r.URL)
+	}
+	if u.RawQuery == "" && len(r.QueryString) > 0 {
+		q := make(url.Values)
+		for _, p := range r.QueryString {
+			q.Add(p.Name, p.Value)
+		}
+		u.RawQuery = q.Encode()
+	}
+	t := &target{
+		method: strings.ToUpper(r.Method),
+		url:    u,
+		header: make(http.Header),
+		// Never fall back to Work.RequestBody for recorded requests.
+		body: []byte{},
+	}
+	for _, h := range r.Headers {
+		name := http.CanonicalHeaderKey(h.Name)
+		if strings.HasPrefix(name, ":") || harSkipHeaders[name] {
+			continue
+		}
+		t.header.Add(name, h.Value)
+	}
+	if p := r.PostData; p != nil {
+		switch {
+		case p.Text != "":
+			t.body = []byte(p.Text)
+		case len(p.Params) > 0:
+			form := make(url.Values)
+			for _, v := range p.Params {
+				form.Add(v.Name, v.Value)
+			}
+			t.body = []byte(form.Encode())
+		}
+		if p.MimeType != "" && t.header.Get("Content-Type") == "" {
+			t.header.Set("Content-Type", p.MimeType)
+		}
+	}
+	return t, nil
+}
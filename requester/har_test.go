@@ -0,0 +1,173 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testHAR = `{
+  "log": {
+    "entries": [
+      {
+        "startedDateTime": "2017-01-01T10:00:00.000Z",
+        "request": {
+          "method": "GET",
+          "url": "%[1]s/search?q=hey&page=2",
+          "headers": [
+            {"name": "Host", "value": "example.com"},
+            {"name": "X-Recorded", "value": "yes"}
+          ],
+          "queryString": [
+            {"name": "q", "value": "hey"},
+            {"name": "page", "value": "2"}
+          ]
+        }
+      },
+      {
+        "startedDateTime": "2017-01-01T10:00:00.250Z",
+        "request": {
+          "method": "POST",
+          "url": "%[1]s/login",
+          "headers": [{"name": "Content-Length", "value": "1"}],
+          "postData": {
+            "mimeType": "application/x-www-form-urlencoded",
+            "params": [
+              {"name": "user", "value": "gopher"},
+              {"name": "pass", "value": "s3cret"}
+            ]
+          }
+        }
+      },
+      {
+        "startedDateTime": "2017-01-01T10:00:00.300Z",
+        "request": {
+          "method": "PUT",
+          "url": "%[1]s/items/1",
+          "postData": {"mimeType": "application/json", "text": "{\"n\":1}"}
+        }
+      }
+    ]
+  }
+}`
+
+func TestLoadHAR(t *testing.T) {
+	path := writeTempFile(t, fmt.Sprintf(testHAR, "http://example.com"))
+	defer os.Remove(path)
+
+	targets, err := loadHAR(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("Expected 3 targets, found %v", len(targets))
+	}
+	if got := targets[0].url.Query().Get("q"); got != "hey" {
+		t.Errorf("Query parameter q is expected to be hey, %v is found", got)
+	}
+	if targets[0].header.Get("Host") != "" {
+		t.Errorf("Host header should not be replayed")
+	}
+	if got := targets[1].wait; got != 250*time.Millisecond {
+		t.Errorf("Think time is expected to be 250ms, %v is found", got)
+	}
+	if got := string(targets[1].body); got != "pass=s3cret&user=gopher" {
+		t.Errorf("Form body is not properly encoded: %v", got)
+	}
+	if got := targets[2].header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content type is expected to be application/json, %v is found", got)
+	}
+}
+
+func TestHARFile(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		seen[fmt.Sprintf("%s %s %s %s", r.Method, r.URL.RequestURI(), r.Header.Get("X-Recorded"), body)]++
+		mu.Unlock()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	path := writeTempFile(t, fmt.Sprintf(testHAR, server.URL))
+	defer os.Remove(path)
+
+	req, _ := http.NewRequest("GET", "", nil)
+	w := &Work{
+		Request: req,
+		HARFile: path,
+		N:       6,
+		C:       1,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"GET /search?q=hey&page=2 yes ",
+		"POST /login  pass=s3cret&user=gopher",
+		`PUT /items/1  {"n":1}`,
+	} {
+		if got := seen[want]; got != 2 {
+			t.Errorf("Expected 2 requests %q, found %v", want, got)
+		}
+	}
+}
+
+func TestHARThinkTimeStop(t *testing.T) {
+	var count int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+	}))
+	defer server.Close()
+
+	// The second entry is replayed a minute after the first.
+	har := fmt.Sprintf(`{"log": {"entries": [
+  {"startedDateTime": "2017-01-01T10:00:00.000Z", "request": {"method": "GET", "url": "%[1]s/a"}},
+  {"startedDateTime": "2017-01-01T10:01:00.000Z", "request": {"method": "GET", "url": "%[1]s/b"}}
+]}}`, server.URL)
+	path := writeTempFile(t, har)
+	defer os.Remove(path)
+
+	req, _ := http.NewRequest("GET", "", nil)
+	w := &Work{
+		Request:      req,
+		HARFile:      path,
+		HARThinkTime: true,
+		N:            2,
+		C:            1,
+		Writer:       ioutil.Discard,
+	}
+	time.AfterFunc(200*time.Millisecond, w.Stop)
+	start := time.Now()
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Stop to end the think time, the run took %v", elapsed)
+	}
+	if got := atomic.LoadInt64(&count); got != 1 {
+		t.Errorf("Expected 1 request, found %v", got)
+	}
+}
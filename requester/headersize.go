@@ -0,0 +1,96 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net/http"
+	"sort"
+)
+
+// HeaderStats is the distribution of the size and number of fields of the
+// response headers, from HeaderSizeStats.
+type HeaderStats struct {
+	Responses int // responses measured
+
+	AvgBytes float64
+	MaxBytes int
+	Bytes    map[int]int // size of the headers at the percentiles of TTFBPercentiles
+
+	AvgFields float64
+	MaxFields int
+	Fields    map[int]int // number of fields at the same percentiles
+}
+
+// headerSize returns the size of h as written in HTTP/1.1, without the
+// status line, and its number of fields, a field with several values
+// counting once per value.
+func headerSize(h http.Header) (size, fields int) {
+	for k, vs := range h {
+		for _, v := range vs {
+			size += len(k) + len(": ") + len(v) + len("\r\n")
+			fields++
+		}
+	}
+	return size, fields
+}
+
+// HeaderSizeStats returns the distribution of the size and number of
+// fields of the response headers. It returns nil before Run, or if no
+// response was received.
+func (b *Work) HeaderSizeStats() *HeaderStats {
+	b.mu.Lock()
+	r := b.report
+	b.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.headerBytes) == 0 {
+		return nil
+	}
+	s := &HeaderStats{Responses: len(r.headerBytes), Bytes: make(map[int]int), Fields: make(map[int]int)}
+	bytes := append([]float64(nil), r.headerBytes...)
+	fields := append([]float64(nil), r.headerFields...)
+	sort.Float64s(bytes)
+	sort.Float64s(fields)
+	for _, p := range pctlsReported {
+		s.Bytes[p] = int(percentile(bytes, float64(p)))
+		s.Fields[p] = int(percentile(fields, float64(p)))
+	}
+	s.MaxBytes, s.MaxFields = int(bytes[len(bytes)-1]), int(fields[len(fields)-1])
+	s.AvgBytes, s.AvgFields = mean(bytes), mean(fields)
+	return s
+}
+
+// printHeaderSizes prints the average, median, 99th percentile and
+// largest size and number of fields of the response headers.
+func (r *report) printHeaderSizes() {
+	bytes := append([]float64(nil), r.headerBytes...)
+	fields := append([]float64(nil), r.headerFields...)
+	sort.Float64s(bytes)
+	sort.Float64s(fields)
+	r.printf("\nResponse headers (average, p50, p99, largest):\n")
+	r.printf("  Size:\t%.0f, %.0f, %.0f, %.0f bytes\n", mean(bytes), percentile(bytes, 50), percentile(bytes, 99), bytes[len(bytes)-1])
+	r.printf("  Fields:\t%.0f, %.0f, %.0f, %.0f\n", mean(fields), percentile(fields, 50), percentile(fields, 99), fields[len(fields)-1])
+}
+
+func mean(xs []float64) float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
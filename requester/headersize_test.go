@@ -0,0 +1,66 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHeaderSize(t *testing.T) {
+	h := http.Header{"X-A": {"1", "22"}, "Content-Type": {"text/plain"}}
+	// "X-A: 1\r\n", "X-A: 22\r\n" and "Content-Type: text/plain\r\n".
+	if size, fields := headerSize(h); size != 8+9+26 || fields != 3 {
+		t.Errorf("Expected 43 bytes in 3 fields, found %v in %v", size, fields)
+	}
+}
+
+func TestHeaderSizeStats(t *testing.T) {
+	var n int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// One response in ten gets a bloated debug header.
+		if atomic.AddInt64(&n, 1)%10 == 0 {
+			w.Header().Set("X-Debug", strings.Repeat("x", 1000))
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	var out bytes.Buffer
+	w := &Work{Request: req, N: 100, C: 1, Writer: &out}
+	if w.HeaderSizeStats() != nil {
+		t.Errorf("Expected no stats before Run")
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s := w.HeaderSizeStats()
+	if s == nil || s.Responses != 100 {
+		t.Fatalf("Expected the stats of 100 responses, found %+v", s)
+	}
+	if s.Bytes[50] >= 1000 || s.Bytes[95] < 1000 || s.MaxBytes < 1000 {
+		t.Errorf("Expected the debug header in the tail only, found %v, max %v", s.Bytes, s.MaxBytes)
+	}
+	if s.Fields[50] != s.MaxFields-1 {
+		t.Errorf("Expected one more field in the largest headers, found %v, max %v", s.Fields, s.MaxFields)
+	}
+	if !strings.Contains(out.String(), "Response headers (average, p50, p99, largest):") {
+		t.Errorf("Expected the header sizes in the summary, found %q", out.String())
+	}
+}
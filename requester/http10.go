@@ -0,0 +1,123 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+)
+
+// http10Transport is a minimal round tripper that speaks HTTP/1.0, which
+// http.Transport always upgrades to HTTP/1.1. Every request is made on a
+// new connection, closed with the response body, and bodies are always
+// sent with a Content-Length rather than chunked.
+type http10Transport struct {
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	tls  *tls.Config
+}
+
+func (t *http10Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	trace := httptrace.ContextClientTrace(ctx)
+	addr := hostPort(req.URL)
+	if trace != nil && trace.GetConn != nil {
+		trace.GetConn(addr)
+	}
+	conn, err := t.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	if req.URL.Scheme == "https" {
+		cfg := t.tls.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = req.URL.Hostname()
+		}
+		tc := tls.Client(conn, cfg)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		err := tc.Handshake()
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tc.ConnectionState(), err)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	if trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn})
+	}
+
+	// Request.Write always writes HTTP/1.1; rewrite the request line.
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	raw := buf.Bytes()
+	if i := bytes.Index(raw, []byte(" HTTP/1.1\r\n")); i >= 0 {
+		copy(raw[i:], " HTTP/1.0")
+	}
+	if _, err := conn.Write(raw); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if trace != nil && trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{})
+	}
+
+	br := bufio.NewReader(conn)
+	if _, err := br.Peek(1); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		resp.TLS = &state
+	}
+	resp.Body = &connBody{ReadCloser: resp.Body, conn: conn}
+	return resp, nil
+}
+
+// connBody closes its connection along with the response body.
+type connBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *connBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
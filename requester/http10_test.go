@@ -0,0 +1,77 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestHTTP10(t *testing.T) {
+	var mu sync.Mutex
+	var protos, bodies, encodings []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		protos = append(protos, r.Proto)
+		bodies = append(bodies, string(body))
+		if len(r.TransferEncoding) > 0 {
+			encodings = append(encodings, r.TransferEncoding[0])
+		}
+		mu.Unlock()
+		w.Write([]byte("ok"))
+	}
+	for _, start := range []func(*httptest.Server){
+		(*httptest.Server).Start,
+		(*httptest.Server).StartTLS,
+	} {
+		protos, bodies, encodings = nil, nil, nil
+		server := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+		start(server)
+
+		req, _ := http.NewRequest("POST", server.URL, nil)
+		w := &Work{
+			Request:     req,
+			RequestBody: []byte("Body"),
+			N:           4,
+			C:           2,
+			HTTP10:      true,
+		}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		server.Close()
+		if len(protos) != 4 {
+			t.Fatalf("Expected 4 requests, found %v", len(protos))
+		}
+		for i := range protos {
+			if protos[i] != "HTTP/1.0" {
+				t.Errorf("Protocol is expected to be HTTP/1.0, %v is found", protos[i])
+			}
+			if bodies[i] != "Body" {
+				t.Errorf("Body is expected to be Body, %v is found", bodies[i])
+			}
+		}
+		if len(encodings) > 0 {
+			t.Errorf("Expected no transfer encoding, found %v", encodings)
+		}
+		if got := w.report.statusCodeDist[200]; got != 4 {
+			t.Errorf("Expected 4 successful responses, found %v", got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import "sync/atomic"
+
+// inFlightLimiter caps the number of requests in flight at once.
+type inFlightLimiter struct {
+	slots chan struct{}
+	drop  bool
+
+	cur     int64
+	max     int64 // most requests in flight at once
+	dropped int64 // requests dropped at the cap
+}
+
+func newInFlightLimiter(max int, drop bool) *inFlightLimiter {
+	return &inFlightLimiter{slots: make(chan struct{}, max), drop: drop}
+}
+
+// acquire takes a slot for a request, waiting for one to be released
+// unless requests are dropped at the cap. It returns false if the
+// request must not be made, because it was dropped or stop was closed.
+func (l *inFlightLimiter) acquire(stop <-chan struct{}) bool {
+	if l.drop {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			atomic.AddInt64(&l.dropped, 1)
+			return false
+		}
+	} else {
+		select {
+		case l.slots <- struct{}{}:
+		case <-stop:
+			return false
+		}
+	}
+	n := atomic.AddInt64(&l.cur, 1)
+	for {
+		max := atomic.LoadInt64(&l.max)
+		if n <= max || atomic.CompareAndSwapInt64(&l.max, max, n) {
+			return true
+		}
+	}
+}
+
+// release frees the slot of a finished request.
+func (l *inFlightLimiter) release() {
+	atomic.AddInt64(&l.cur, -1)
+	<-l.slots
+}
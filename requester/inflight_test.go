@@ -0,0 +1,91 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrencyServer records the most requests it served at once.
+func concurrencyServer(max *int64) *httptest.Server {
+	var cur int64
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&cur, 1)
+		defer atomic.AddInt64(&cur, -1)
+		for {
+			m := atomic.LoadInt64(max)
+			if n <= m || atomic.CompareAndSwapInt64(max, m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+}
+
+func TestMaxInFlight(t *testing.T) {
+	var max int64
+	server := concurrencyServer(&max)
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 8, C: 4, MaxInFlight: 2, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if max > 2 {
+		t.Errorf("Expected at most 2 requests in flight, found %v", max)
+	}
+	if w.report.numRes != 8 {
+		t.Errorf("Expected 8 results, found %v", w.report.numRes)
+	}
+	if !strings.Contains(out.String(), "In flight:\t2 max of 2 allowed") {
+		t.Errorf("Expected the in-flight maximum in the output, found %v", out.String())
+	}
+}
+
+func TestMaxInFlightDrop(t *testing.T) {
+	var max int64
+	server := concurrencyServer(&max)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:         req,
+		N:               20,
+		C:               4,
+		QPS:             10,
+		OpenModel:       true,
+		MaxInFlight:     1,
+		MaxInFlightDrop: true,
+		Reporter:        &recordingReporter{},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if max > 1 {
+		t.Errorf("Expected at most 1 request in flight, found %v", max)
+	}
+	dropped := w.report.inFlightDropped
+	if dropped == 0 || w.report.numRes+dropped != 20 {
+		t.Errorf("Expected 20 requests made or dropped, found %v made and %v dropped", w.report.numRes, dropped)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// window accumulates the results completed in the current interval.
+type window struct {
+	index   int // intervals since the start of the run
+	count   int
+	errors  int
+	lats    []float64 // latencies of the successful requests
+	started bool      // whether the csv header was written
+}
+
+// intervalRow is a row of the time series written every Work.Interval.
+type intervalRow struct {
+	Offset    float64 `json:"offset"`
+	Requests  int     `json:"requests"`
+	RPS       float64 `json:"rps"`
+	ErrorRate float64 `json:"error_rate"`
+	P50       float64 `json:"p50"`
+	P99       float64 `json:"p99"`
+
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// flushWindows writes a row for every interval that ended by t. If final
+// is set, the interval in progress at t is written too, as a partial one.
+func (r *report) flushWindows(t time.Time, final bool) {
+	for {
+		end := r.start.Add(time.Duration(r.window.index+1) * r.interval)
+		if end.After(t) {
+			break
+		}
+		r.writeWindow(r.interval)
+	}
+	if final {
+		begin := r.start.Add(time.Duration(r.window.index) * r.interval)
+		if d := t.Sub(begin); d > 0 {
+			r.writeWindow(d)
+		}
+	}
+}
+
+// writeWindow writes the row of the current interval, which lasted d,
+// and moves on to the next interval.
+func (r *report) writeWindow(d time.Duration) {
+	w := r.window
+	sort.Float64s(w.lats)
+	row := intervalRow{
+		Offset:   (time.Duration(w.index)*r.interval + d).Seconds(),
+		Requests: w.count,
+		RPS:      float64(w.count) / d.Seconds(),
+		P50:      percentile(w.lats, 50),
+		P99:      percentile(w.lats, 99),
+		Tags:     r.tags,
+	}
+	if w.count > 0 {
+		row.ErrorRate = float64(w.errors) / float64(w.count)
+	}
+	if r.intervalFormat == "json" {
+		b, _ := json.Marshal(row)
+		fmt.Fprintf(r.rowWriter, "%s\n", b)
+	} else {
+		if !w.started {
+			fmt.Fprintf(r.rowWriter, "offset,requests,rps,error-rate,p50,p99\n")
+		}
+		fmt.Fprintf(r.rowWriter, "%4.4f,%d,%4.4f,%4.4f,%4.4f,%4.4f\n",
+			row.Offset, row.Requests, row.RPS, row.ErrorRate, row.P50, row.P99)
+	}
+	r.window = &window{index: w.index + 1, started: true}
+}
+
+// percentile returns the p-th percentile of sorted using the nearest rank
+// method, or 0 if sorted is empty.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,126 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func intervalRows(t *testing.T, out string) []intervalRow {
+	var rows []intervalRow
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var row intervalRow
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("Invalid interval row %q: %v", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestInterval(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:        req,
+		N:              25,
+		C:              1,
+		Interval:       100 * time.Millisecond,
+		IntervalFormat: "json",
+		Writer:         &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	rows := intervalRows(t, out.String())
+	if len(rows) < 3 {
+		t.Fatalf("Expected at least 3 interval rows, found %v", len(rows))
+	}
+	var total int
+	for i, row := range rows {
+		total += row.Requests
+		if i < len(rows)-1 {
+			if want := float64(i+1) * 0.1; row.Offset < want-1e-9 || row.Offset > want+1e-9 {
+				t.Errorf("Row %d offset is expected to be %v, %v is found", i, want, row.Offset)
+			}
+		}
+		if row.Requests > 0 && row.P50 < 0.01 {
+			t.Errorf("Row %d p50 is expected to be at least 10ms, %v is found", i, row.P50)
+		}
+	}
+	if total != 25 {
+		t.Errorf("Expected interval rows to cover 25 requests, found %v", total)
+	}
+	if last := rows[len(rows)-1]; last.Offset > w.report.total.Seconds()+1e-9 {
+		t.Errorf("Last row offset %v is past the end of the run", last.Offset)
+	}
+}
+
+func TestIntervalWindowedPercentiles(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// The server slows down after 15 requests.
+		if atomic.AddInt64(&count, 1) <= 15 {
+			time.Sleep(5 * time.Millisecond)
+		} else {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:        req,
+		N:              25,
+		C:              1,
+		Interval:       100 * time.Millisecond,
+		IntervalFormat: "json",
+		Writer:         &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	rows := intervalRows(t, out.String())
+	if len(rows) < 5 {
+		t.Fatalf("Expected at least 5 interval rows, found %v", len(rows))
+	}
+	if p99 := rows[0].P99; p99 >= 0.05 {
+		t.Errorf("First interval p99 is expected to be under 50ms, %v is found", p99)
+	}
+	// By the third interval, only slow requests complete.
+	for i, row := range rows[2:] {
+		if row.Requests > 0 && row.P50 < 0.05 {
+			t.Errorf("Interval %d p50 is expected to be at least 50ms, %v is found", i+2, row.P50)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// writerLogger returns a Logger that writes each message to w on a line
+// of its own, as "[level] msg key=value ...", with the fields sorted.
+func writerLogger(w io.Writer) func(level, msg string, fields map[string]interface{}) {
+	return func(level, msg string, fields map[string]interface{}) {
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var line strings.Builder
+		fmt.Fprintf(&line, "[%s] %s", level, msg)
+		for _, k := range keys {
+			fmt.Fprintf(&line, " %s=%v", k, fields[k])
+		}
+		line.WriteString("\n")
+		// A single write, so that lines from concurrent requests do not
+		// interleave.
+		io.WriteString(w, line.String())
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriterLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log := writerLogger(&buf)
+	log("debug", "request sent", map[string]interface{}{"url": "http://example.com", "method": "GET"})
+	log("error", "request failed", nil)
+	want := "[debug] request sent method=GET url=http://example.com\n[error] request failed\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, found %q", want, buf.String())
+	}
+}
+
+func TestDebugOutput(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 5, C: 1, Output: "csv", Debug: true, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected csv output, found %q: %v", out.String(), err)
+	}
+	if len(records) != 6 {
+		t.Errorf("Expected a header and 5 rows, found %v", records)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import "sort"
+
+// maxMetricBody is the most of each response body ExtractMetric gets.
+const maxMetricBody = 1 << 20
+
+// MetricStats is the distribution of the values ExtractMetric returned,
+// from MetricStats.
+type MetricStats struct {
+	Count  int // responses the metric was extracted from
+	Errors int // responses ExtractMetric failed on
+
+	Min, Max, Avg float64
+	Percentiles   map[int]float64 // at the percentiles of TTFBPercentiles
+}
+
+// MetricStats returns the distribution of the values ExtractMetric
+// returned. It returns nil before Run, if ExtractMetric is not set or if
+// no response was received.
+func (b *Work) MetricStats() *MetricStats {
+	b.mu.Lock()
+	r := b.report
+	b.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.metric || len(r.metrics)+int(r.metricErrors) == 0 {
+		return nil
+	}
+	s := &MetricStats{Count: len(r.metrics), Errors: int(r.metricErrors), Percentiles: make(map[int]float64)}
+	if len(r.metrics) == 0 {
+		return s
+	}
+	metrics := append([]float64(nil), r.metrics...)
+	sort.Float64s(metrics)
+	for _, p := range pctlsReported {
+		s.Percentiles[p] = percentile(metrics, float64(p))
+	}
+	s.Min, s.Max, s.Avg = metrics[0], metrics[len(metrics)-1], mean(metrics)
+	return s
+}
+
+// printMetric prints the distribution of the extracted metric, and the
+// number of responses it could not be extracted from.
+func (r *report) printMetric() {
+	r.printf("\nExtracted metric:\n")
+	r.printf("  Responses:\t%d\n", len(r.metrics))
+	if r.metricErrors > 0 {
+		r.printf("  Errors:\t%d\n", r.metricErrors)
+	}
+	if len(r.metrics) == 0 {
+		return
+	}
+	metrics := append([]float64(nil), r.metrics...)
+	sort.Float64s(metrics)
+	r.printf("  Min:\t%.4g\n", metrics[0])
+	r.printf("  Max:\t%.4g\n", metrics[len(metrics)-1])
+	r.printf("  Average:\t%.4g\n", mean(metrics))
+	for _, p := range pctlsReported {
+		r.printf("  %d%%:\t%.4g\n", p, percentile(metrics, float64(p)))
+	}
+}
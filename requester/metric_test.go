@@ -0,0 +1,93 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestExtractMetric(t *testing.T) {
+	var n int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt64(&n, 1)
+		if i%10 == 0 {
+			w.Write([]byte(`{}`))
+			return
+		}
+		fmt.Fprintf(w, `{"latency_ms": %d}`, i%10)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	var out bytes.Buffer
+	w := &Work{
+		Request: req,
+		N:       100,
+		C:       2,
+		Writer:  &out,
+		ExtractMetric: func(body []byte) (float64, error) {
+			var v struct {
+				Latency *float64 `json:"latency_ms"`
+			}
+			if err := json.Unmarshal(body, &v); err != nil {
+				return 0, err
+			}
+			if v.Latency == nil {
+				return 0, fmt.Errorf("no latency_ms")
+			}
+			return *v.Latency, nil
+		},
+	}
+	w.Run()
+	s := w.MetricStats()
+	if s == nil {
+		t.Fatal("Expected metric stats")
+	}
+	if s.Count != 90 || s.Errors != 10 {
+		t.Errorf("Expected 90 metrics and 10 errors, found %v and %v", s.Count, s.Errors)
+	}
+	if s.Min != 1 || s.Max != 9 || s.Avg != 5 {
+		t.Errorf("Expected a metric from 1 to 9 averaging 5, found %+v", s)
+	}
+	if s.Percentiles[50] != 5 {
+		t.Errorf("Expected a median of 5, found %v", s.Percentiles[50])
+	}
+	if !strings.Contains(out.String(), "Extracted metric:") {
+		t.Errorf("Expected the metric in the summary, found %q", out.String())
+	}
+}
+
+func TestExtractMetricNotSet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	var out bytes.Buffer
+	w := &Work{Request: req, N: 10, C: 1, Writer: &out}
+	w.Run()
+	if s := w.MetricStats(); s != nil {
+		t.Errorf("Expected no metric stats, found %+v", s)
+	}
+	if strings.Contains(out.String(), "Extracted metric") {
+		t.Errorf("Expected no metric in the summary, found %q", out.String())
+	}
+}
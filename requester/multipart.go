@@ -0,0 +1,131 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+)
+
+// MultipartPart is a part of a multipart/form-data request body: a form
+// field, or a file upload if File is set.
+type MultipartPart struct {
+	// Name is the name of the form field.
+	Name string
+
+	// Value is the value of a field without File.
+	Value string
+
+	// File is the path of the file to upload. It is read anew for each
+	// request, as the body is sent, and must keep its size for the run.
+	File string
+}
+
+// multipartBody streams multipart/form-data bodies made of parts, with
+// the same boundary and length for every request.
+type multipartBody struct {
+	parts    []MultipartPart
+	boundary string
+	length   int64
+}
+
+// newMultipartBody checks that the files of parts can be read and
+// computes the length of the bodies.
+func newMultipartBody(parts []MultipartPart) (*multipartBody, error) {
+	var size int64
+	for _, p := range parts {
+		if p.File == "" {
+			continue
+		}
+		fi, err := os.Stat(p.File)
+		if err != nil {
+			return nil, fmt.Errorf("requester: multipart file: %v", err)
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("requester: multipart file %s is not a regular file", p.File)
+		}
+		size += fi.Size()
+	}
+	// Write everything but the file contents to count the rest.
+	var c countingWriter
+	mw := multipart.NewWriter(&c)
+	m := &multipartBody{parts: parts, boundary: mw.Boundary()}
+	if err := m.write(mw, false); err != nil {
+		return nil, err
+	}
+	m.length = c.n + size
+	return m, nil
+}
+
+// contentType returns the Content-Type of the bodies.
+func (m *multipartBody) contentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// reader returns a new body. It is written as it is read, so files are
+// never held in memory.
+func (m *multipartBody) reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		mw := multipart.NewWriter(pw)
+		mw.SetBoundary(m.boundary)
+		// The transport closes the reader if the request fails, which
+		// fails the writes.
+		pw.CloseWithError(m.write(mw, true))
+	}()
+	return pr
+}
+
+// write writes the parts to mw, with the contents of the files only if
+// files is set.
+func (m *multipartBody) write(mw *multipart.Writer, files bool) error {
+	for _, p := range m.parts {
+		if p.File == "" {
+			if err := mw.WriteField(p.Name, p.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		w, err := mw.CreateFormFile(p.Name, filepath.Base(p.File))
+		if err != nil {
+			return err
+		}
+		if files {
+			f, err := os.Open(p.File)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return mw.Close()
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMultipart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := bytes.Repeat([]byte("0123456789"), 100000)
+	path := filepath.Join(dir, "upload.bin")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TransferEncoding) > 0 || r.ContentLength <= 0 {
+			t.Errorf("Expected a Content-Length, found %v %v", r.TransferEncoding, r.ContentLength)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Expected a multipart form, found %v", err)
+			return
+		}
+		if v := r.FormValue("name"); v != "hey" {
+			t.Errorf("Field name is expected to be hey, %v is found", v)
+		}
+		f, h, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected a file, found %v", err)
+			return
+		}
+		defer f.Close()
+		got, _ := ioutil.ReadAll(f)
+		if h.Filename != "upload.bin" || !bytes.Equal(got, content) {
+			t.Errorf("Expected upload.bin with %v bytes, found %v with %v bytes", len(content), h.Filename, len(got))
+		}
+		atomic.AddInt64(&count, 1)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       4,
+		C:       2,
+		Multipart: []MultipartPart{
+			{Name: "name", Value: "hey"},
+			{Name: "file", File: path},
+		},
+		Writer: ioutil.Discard,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("Expected 4 uploads, found %v", count)
+	}
+
+	w = &Work{Request: req, N: 1, C: 1, Multipart: []MultipartPart{{Name: "file", File: filepath.Join(dir, "missing")}}}
+	if err := w.Run(); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Target is one of the endpoints of a Targets run, requested by its own
+// workers.
+type Target struct {
+	// Name labels the target in the report. Defaults to its method and
+	// URL.
+	Name string
+
+	Method string      // method of the requests, defaults to that of Request
+	URL    *url.URL    // absolute URL of the requests
+	Header http.Header // headers set on top of those of Request
+	Body   []byte      // body of the requests, defaults to RequestBody
+
+	// C is the number of workers making requests to the target.
+	C int
+}
+
+// name returns the label of t in the report.
+func (t Target) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	if t.Method != "" {
+		return t.Method + " " + t.URL.String()
+	}
+	return t.URL.String()
+}
+
+// validateTargets checks Targets, as documented on Run.
+func (b *Work) validateTargets() error {
+	if b.URLFile != "" || b.HARFile != "" || b.OpenModel || len(b.RateSchedule) > 0 || b.PreserveTiming || b.Adaptive != nil || b.WorkStealing ||
+		b.RawMode || len(b.Multipart) > 0 || b.GRPCMethod != "" || b.WebSocket != nil || b.HandshakeOnly {
+		return errors.New("requester: Targets cannot be used with URLFile, HARFile, OpenModel, RateSchedule, PreserveTiming, Adaptive, WorkStealing, RawMode, Multipart, GRPCMethod, WebSocket or HandshakeOnly")
+	}
+	names := make(map[string]bool, len(b.Targets))
+	var c int
+	for _, t := range b.Targets {
+		if t.URL == nil || !t.URL.IsAbs() || t.URL.Host == "" {
+			return fmt.Errorf("requester: invalid target URL %q", t.URL)
+		}
+		if t.C <= 0 {
+			return fmt.Errorf("requester: target %q must have a positive C", t.name())
+		}
+		if names[t.name()] {
+			return fmt.Errorf("requester: duplicate target %q", t.name())
+		}
+		names[t.name()] = true
+		c += t.C
+	}
+	if c != b.C {
+		return fmt.Errorf("requester: C must be the sum of the C of the Targets, %d", c)
+	}
+	return nil
+}
+
+// assignTargets returns the target of each worker, by id: the first C of
+// the first target, and so on.
+func (b *Work) assignTargets() []*target {
+	workers := make([]*target, 0, b.C)
+	for _, t := range b.Targets {
+		tg := &target{
+			name:   t.name(),
+			method: t.Method,
+			url:    t.URL,
+			header: t.Header,
+			body:   t.Body,
+		}
+		for i := 0; i < t.C; i++ {
+			workers = append(workers, tg)
+		}
+	}
+	return workers
+}
+
+// targetStats are the results of the requests to a target of a Targets
+// run.
+type targetStats struct {
+	requests       int64
+	errors         int64
+	statusCodeDist map[int]int
+	lats           []float64 // of the successful requests, up to maxRes
+}
+
+// recordTarget adds res to the statistics of its target.
+func (r *report) recordTarget(res *Result) {
+	t := r.targets[res.Target]
+	if t == nil {
+		return
+	}
+	t.requests++
+	if res.Err != nil {
+		t.errors++
+		return
+	}
+	t.statusCodeDist[res.StatusCode]++
+	if len(t.lats) < maxRes {
+		t.lats = append(t.lats, res.Duration.Seconds())
+	}
+}
+
+// TargetStats returns the statistics of each target of a Targets run,
+// by name, such as its requests and latencies, computed independently of
+// the other targets. It returns nil before Run or without Targets.
+func (b *Work) TargetStats() map[string]RunStats {
+	b.mu.Lock()
+	r := b.report
+	b.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.targets) == 0 {
+		return nil
+	}
+	elapsed := r.total
+	if elapsed == 0 {
+		elapsed = time.Now().Sub(r.start)
+	}
+	stats := make(map[string]RunStats, len(r.targets))
+	for name, t := range r.targets {
+		s := RunStats{
+			Requests:    t.requests,
+			Errors:      t.errors,
+			StatusCodes: make(map[int]int, len(t.statusCodeDist)),
+			Elapsed:     elapsed,
+			Tags:        r.tags,
+		}
+		for code, n := range t.statusCodeDist {
+			s.StatusCodes[code] = n
+		}
+		if elapsed > 0 {
+			s.RPS = float64(s.Requests) / elapsed.Seconds()
+		}
+		s.setLatencies(t.lats)
+		stats[name] = s
+	}
+	return stats
+}
+
+// printTargets prints the rate of requests, errors and latencies of each
+// target of a Targets run.
+func (r *report) printTargets() {
+	r.printf("\nTargets:\n")
+	for _, name := range r.targetNames {
+		t := r.targets[name]
+		r.printf("  [%s]\n", name)
+		r.printf("    Requests/sec:\t%4.4f\n", float64(t.requests)/r.total.Seconds())
+		if t.errors > 0 {
+			r.printf("    Errors:\t%d\n", t.errors)
+		}
+		if len(t.lats) == 0 {
+			continue
+		}
+		lats := append([]float64(nil), t.lats...)
+		sort.Float64s(lats)
+		r.printf("    Average:\t%4.4f secs\n", mean(lats))
+		r.printf("    Slowest:\t%4.4f secs\n", lats[len(lats)-1])
+		r.printf("    50%%, 90%%, 99%%:\t%4.4f, %4.4f, %4.4f secs\n", percentile(lats, 50), percentile(lats, 90), percentile(lats, 99))
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTargets(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.Method+" "+r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/write" {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	write, _ := url.Parse(server.URL + "/write")
+	read, _ := url.Parse(server.URL + "/read")
+	req, _ := http.NewRequest("GET", "", nil)
+	var out bytes.Buffer
+	w := &Work{
+		Request: req,
+		N:       80,
+		C:       8,
+		Writer:  &out,
+		Targets: []Target{
+			{Name: "write", Method: "POST", URL: write, Body: []byte("x"), C: 2},
+			{URL: read, C: 6},
+		},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if hits["POST /write"] != 20 || hits["GET /read"] != 60 {
+		t.Errorf("Expected 20 writes and 60 reads, found %v", hits)
+	}
+	stats := w.TargetStats()
+	if s := stats["write"]; s.Requests != 20 || s.StatusCodes[http.StatusCreated] != 20 {
+		t.Errorf("Expected 20 writes, found %+v", s)
+	}
+	if s := stats[read.String()]; s.Requests != 60 || s.StatusCodes[http.StatusOK] != 60 || s.Latencies == nil {
+		t.Errorf("Expected 60 reads, found %+v", s)
+	}
+	if !strings.Contains(out.String(), "Targets:\n  [write]") {
+		t.Errorf("Expected the targets in the summary, found %q", out.String())
+	}
+}
+
+func TestTargetsNotSet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 10, C: 1, Writer: &bytes.Buffer{}}
+	w.Run()
+	if s := w.TargetStats(); s != nil {
+		t.Errorf("Expected no target stats, found %v", s)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLMAuth configures NTLM authentication, with NTLMv2 responses. NTLM
+// authenticates connections rather than requests, so each worker keeps
+// its own kept-alive connection to each host, authenticated with the
+// negotiate, challenge and authenticate exchange when the server first
+// answers with a 401 on it.
+type NTLMAuth struct {
+	User     string
+	Password string
+
+	// Domain is the domain of User. Optional.
+	Domain string
+}
+
+// ntlmTransport authenticates the connections of requests with NTLM.
+type ntlmTransport struct {
+	base *http.Transport
+	auth NTLMAuth
+
+	// idle holds the transports of the workers that are not making a
+	// request, each with one connection per host so that the messages of
+	// the handshake are sent on the connection they authenticate.
+	idle chan *http.Transport
+
+	handshakes int64 // handshakes made
+	failures   int64 // handshakes the server rejected
+}
+
+func newNTLMTransport(base *http.Transport, auth NTLMAuth, c int) *ntlmTransport {
+	return &ntlmTransport{base: base, auth: auth, idle: make(chan *http.Transport, c)}
+}
+
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var rt *http.Transport
+	select {
+	case rt = <-t.idle:
+	default:
+		rt = t.base.Clone()
+		rt.MaxConnsPerHost, rt.MaxIdleConnsPerHost = 1, 1
+	}
+	defer func() {
+		select {
+		case t.idle <- rt:
+		default:
+			rt.CloseIdleConnections()
+		}
+	}()
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	send := func(auth string) (*http.Response, error) {
+		r := req.Clone(req.Context())
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		return rt.RoundTrip(r)
+	}
+	resp, err := send("")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !hasNTLMChallenge(resp) {
+		return resp, err
+	}
+	// The connection is not authenticated yet. Drain the responses so
+	// that it is reused for the next message.
+	drain := func(resp *http.Response) {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	drain(resp)
+	atomic.AddInt64(&t.handshakes, 1)
+	if resp, err = send("NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiate())); err != nil {
+		return nil, err
+	}
+	var challenge []byte
+	if resp.StatusCode == http.StatusUnauthorized {
+		for _, h := range resp.Header.Values("WWW-Authenticate") {
+			if strings.HasPrefix(h, "NTLM ") {
+				challenge, _ = base64.StdEncoding.DecodeString(h[len("NTLM "):])
+			}
+		}
+	}
+	if challenge == nil {
+		atomic.AddInt64(&t.failures, 1)
+		return resp, nil
+	}
+	drain(resp)
+	msg, err := ntlmAuthenticate(challenge, t.auth, time.Now())
+	if err != nil {
+		atomic.AddInt64(&t.failures, 1)
+		return nil, err
+	}
+	resp, err = send("NTLM " + base64.StdEncoding.EncodeToString(msg))
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		atomic.AddInt64(&t.failures, 1)
+	}
+	return resp, err
+}
+
+// hasNTLMChallenge reports whether resp asks for NTLM authentication.
+func hasNTLMChallenge(resp *http.Response) bool {
+	for _, h := range resp.Header.Values("WWW-Authenticate") {
+		if strings.EqualFold(strings.TrimSpace(h), "NTLM") {
+			return true
+		}
+	}
+	return false
+}
+
+// NTLM negotiate flags (MS-NLMP, section 2.2.2.5).
+const (
+	ntlmUnicode                 = 0x00000001
+	ntlmRequestTarget           = 0x00000004
+	ntlmNTLM                    = 0x00000200
+	ntlmAlwaysSign              = 0x00008000
+	ntlmExtendedSessionSecurity = 0x00080000
+	ntlmTargetInfo              = 0x00800000
+
+	ntlmFlags = ntlmUnicode | ntlmRequestTarget | ntlmNTLM | ntlmAlwaysSign | ntlmExtendedSessionSecurity | ntlmTargetInfo
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmNegotiate returns the NEGOTIATE_MESSAGE that starts the handshake.
+func ntlmNegotiate() []byte {
+	m := make([]byte, 32)
+	copy(m, ntlmSignature)
+	binary.LittleEndian.PutUint32(m[8:], 1)
+	binary.LittleEndian.PutUint32(m[12:], ntlmFlags)
+	// Empty domain and workstation fields.
+	return m
+}
+
+// ntlmAuthenticate returns the AUTHENTICATE_MESSAGE answering challenge,
+// a CHALLENGE_MESSAGE, with NTLMv2 responses computed at now.
+func ntlmAuthenticate(challenge []byte, auth NTLMAuth, now time.Time) ([]byte, error) {
+	if len(challenge) < 48 || !bytes.Equal(challenge[:8], ntlmSignature) || binary.LittleEndian.Uint32(challenge[8:]) != 2 {
+		return nil, errors.New("requester: invalid NTLM challenge")
+	}
+	serverChallenge := challenge[24:32]
+	infoLen := int(binary.LittleEndian.Uint16(challenge[40:]))
+	infoOff := int(binary.LittleEndian.Uint32(challenge[44:]))
+	if infoOff+infoLen > len(challenge) {
+		return nil, errors.New("requester: invalid NTLM challenge")
+	}
+	targetInfo := challenge[infoOff : infoOff+infoLen]
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	key := ntowfv2(auth.User, auth.Password, auth.Domain)
+	nt := ntlmv2Response(key, serverChallenge, clientChallenge, targetInfo, now)
+	lm := append(hmacMD5(key, serverChallenge, clientChallenge), clientChallenge...)
+
+	fields := [][]byte{lm, nt, utf16le(auth.Domain), utf16le(auth.User), nil, nil}
+	m := make([]byte, 64)
+	copy(m, ntlmSignature)
+	binary.LittleEndian.PutUint32(m[8:], 3)
+	// The security buffers of the fields, in order from offset 12, point
+	// at their contents after the header.
+	for i, f := range fields {
+		buf := m[12+8*i:]
+		binary.LittleEndian.PutUint16(buf, uint16(len(f)))
+		binary.LittleEndian.PutUint16(buf[2:], uint16(len(f)))
+		binary.LittleEndian.PutUint32(buf[4:], uint32(len(m)))
+		m = append(m, f...)
+	}
+	binary.LittleEndian.PutUint32(m[60:], ntlmFlags)
+	return m, nil
+}
+
+// ntowfv2 returns the NTLMv2 response key of a user.
+func ntowfv2(user, password, domain string) []byte {
+	return hmacMD5(md4(utf16le(password)), utf16le(strings.ToUpper(user)+domain))
+}
+
+// ntlmv2Response returns the NTLMv2 response to serverChallenge: the
+// proof of the key followed by the client data it covers.
+func ntlmv2Response(key, serverChallenge, clientChallenge, targetInfo []byte, now time.Time) []byte {
+	// Windows file time: 100ns intervals since 1601.
+	ft := uint64(now.UnixNano()/100) + 116444736000000000
+	blob := make([]byte, 28, 28+len(targetInfo)+4)
+	blob[0], blob[1] = 1, 1
+	binary.LittleEndian.PutUint64(blob[8:], ft)
+	copy(blob[16:], clientChallenge)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+	return append(hmacMD5(key, serverChallenge, blob), blob...)
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// md4 returns the MD4 digest of p (RFC 1320), needed for the NT hash of
+// passwords and missing from the standard library.
+func md4(p []byte) []byte {
+	n := len(p)
+	msg := append(append([]byte(nil), p...), 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(n)*8)
+
+	a, b, c, d := uint32(0x67452301), uint32(0xefcdab89), uint32(0x98badcfe), uint32(0x10325476)
+	var x [16]uint32
+	for len(msg) > 0 {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[4*i:])
+		}
+		msg = msg[64:]
+		aa, bb, cc, dd := a, b, c, d
+		for _, i := range [4]int{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+(b&c|^b&d)+x[i], 3)
+			d = bits.RotateLeft32(d+(a&b|^a&c)+x[i+1], 7)
+			c = bits.RotateLeft32(c+(d&a|^d&b)+x[i+2], 11)
+			b = bits.RotateLeft32(b+(c&d|^c&a)+x[i+3], 19)
+		}
+		for _, i := range [4]int{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+(b&c|b&d|c&d)+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+(a&b|a&c|b&c)+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+(d&a|d&b|a&b)+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+(c&d|c&a|d&a)+x[i+12]+0x5a827999, 13)
+		}
+		for _, i := range [4]int{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+(b^c^d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+(a^b^c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+(d^a^b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+(c^d^a)+x[i+12]+0x6ed9eba1, 15)
+		}
+		a, b, c, d = a+aa, b+bb, c+cc, d+dd
+	}
+	sum := make([]byte, 0, 16)
+	for _, v := range [4]uint32{a, b, c, d} {
+		sum = binary.LittleEndian.AppendUint32(sum, v)
+	}
+	return sum
+}
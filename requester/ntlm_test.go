@@ -0,0 +1,146 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMD4(t *testing.T) {
+	tests := map[string]string{
+		"":    "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"abc": "a448017aaf21d8525fc10ae87aa6729d",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	}
+	for in, want := range tests {
+		if got := hex.EncodeToString(md4([]byte(in))); got != want {
+			t.Errorf("Expected MD4 %v of %q, found %v", want, in, got)
+		}
+	}
+}
+
+func TestNTOWFv2(t *testing.T) {
+	// MS-NLMP, section 4.2.4.1.1.
+	want := "0c868a403bfd7a93a3001ef22ef02e3f"
+	if got := hex.EncodeToString(ntowfv2("User", "Password", "Domain")); got != want {
+		t.Errorf("Expected NTOWFv2 %v, found %v", want, got)
+	}
+}
+
+// ntlmServer is a handler requiring NTLM authentication of connections,
+// checking the NTLMv2 responses for password.
+type ntlmServer struct {
+	password string
+
+	mu         sync.Mutex
+	challenged map[string][]byte // server challenges by remote address
+	authed     map[string]bool
+	handshakes int
+}
+
+func (s *ntlmServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.authed[r.RemoteAddr] {
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	msg, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "NTLM "))
+	switch {
+	case len(msg) > 12 && binary.LittleEndian.Uint32(msg[8:]) == 1:
+		s.handshakes++
+		sc := []byte("01234567")
+		s.challenged[r.RemoteAddr] = sc
+		info := []byte{0, 0, 0, 0} // MsvAvEOL
+		c := make([]byte, 48, 48+len(info))
+		copy(c, ntlmSignature)
+		binary.LittleEndian.PutUint32(c[8:], 2)
+		binary.LittleEndian.PutUint32(c[20:], ntlmFlags)
+		copy(c[24:], sc)
+		binary.LittleEndian.PutUint16(c[40:], uint16(len(info)))
+		binary.LittleEndian.PutUint16(c[42:], uint16(len(info)))
+		binary.LittleEndian.PutUint32(c[44:], 48)
+		c = append(c, info...)
+		w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(c))
+	case len(msg) > 64 && binary.LittleEndian.Uint32(msg[8:]) == 3:
+		field := func(i int) []byte {
+			n := binary.LittleEndian.Uint16(msg[12+8*i:])
+			off := binary.LittleEndian.Uint32(msg[16+8*i:])
+			return msg[off : off+uint32(n)]
+		}
+		nt, domain, user := field(1), field(2), field(3)
+		sc := s.challenged[r.RemoteAddr]
+		key := hmacMD5(md4(utf16le(s.password)), bytes.ToUpper(user), domain)
+		if sc != nil && bytes.Equal(nt[:16], hmacMD5(key, sc, nt[16:])) {
+			s.authed[r.RemoteAddr] = true
+			return
+		}
+		w.Header().Set("WWW-Authenticate", "NTLM")
+	default:
+		w.Header().Set("WWW-Authenticate", "NTLM")
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func TestNTLMAuth(t *testing.T) {
+	s := &ntlmServer{password: "secret", challenged: make(map[string][]byte), authed: make(map[string]bool)}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	w := &Work{
+		Request:     req,
+		RequestBody: []byte("body"),
+		N:           20,
+		C:           2,
+		NTLMAuth:    &NTLMAuth{User: "user", Password: "secret", Domain: "DOMAIN"},
+		Writer:      &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.report.statusCodeDist[http.StatusOK] != 20 {
+		t.Errorf("Expected 20 authenticated requests, found %v", w.report.statusCodeDist)
+	}
+	// Each worker authenticates its connection once.
+	if s.handshakes != 2 || w.report.ntlmHandshakes != 2 {
+		t.Errorf("Expected 2 handshakes, found %v on the server and %v reported", s.handshakes, w.report.ntlmHandshakes)
+	}
+	if !strings.Contains(out.String(), "NTLM handshakes:\t2, 0 rejected") {
+		t.Errorf("Expected the handshakes in the output, found %v", out.String())
+	}
+
+	// A wrong password is rejected, and reported.
+	out.Reset()
+	w = &Work{Request: req, N: 3, C: 1, NTLMAuth: &NTLMAuth{User: "user", Password: "wrong"}, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.report.statusCodeDist[http.StatusUnauthorized] != 3 || w.report.ntlmFailures != 3 {
+		t.Errorf("Expected 3 rejected handshakes, found %v and %v failures", w.report.statusCodeDist, w.report.ntlmFailures)
+	}
+	if !strings.Contains(out.String(), "NTLM handshakes:\t3, 3 rejected") {
+		t.Errorf("Expected the rejected handshakes in the output, found %v", out.String())
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2 configures the OAuth2 client credentials grant (RFC 6749,
+// section 4.4) to authorize requests with a bearer token. A token is
+// fetched before the run starts and again once 90% of its lifetime has
+// passed, through ProxyAddr if set. The certificate of the token
+// endpoint is verified, against CAFile if set, even though those of the
+// request URL are not without CAFile, as the client secret is sent to it.
+type OAuth2 struct {
+	// TokenURL is the token endpoint of the authorization server.
+	TokenURL string
+
+	// ClientID and ClientSecret are the credentials of the client, sent
+	// with HTTP Basic authentication.
+	ClientID     string
+	ClientSecret string
+
+	// Scopes are the scopes to request. Optional.
+	Scopes []string
+}
+
+// tokenSource fetches and caches the bearer token of an OAuth2 client.
+type tokenSource struct {
+	cfg    OAuth2
+	client *http.Client
+	logger func(level, msg string, fields map[string]interface{})
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time // zero if the token does not expire
+	refreshes int       // tokens fetched after the first
+}
+
+// newTokenSource returns the token source of cfg, which verifies the
+// token endpoint against rootCAs, or the system roots if nil, and fetches
+// tokens through proxy if set.
+func newTokenSource(cfg OAuth2, rootCAs *x509.CertPool, proxy *url.URL, logger func(level, msg string, fields map[string]interface{})) *tokenSource {
+	return &tokenSource{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: rootCAs},
+				Proxy:           http.ProxyURL(proxy),
+			},
+		},
+		logger: logger,
+	}
+}
+
+// authorize sets the Authorization header of req, fetching a new token
+// first if the current one is due for a refresh. Workers wait for the
+// one of them that refreshes it.
+func (s *tokenSource) authorize(ctx context.Context, req *http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == "" || (!s.refreshAt.IsZero() && time.Now().After(s.refreshAt)) {
+		refresh := s.token != ""
+		if err := s.fetch(ctx); err != nil {
+			return err
+		}
+		if refresh {
+			s.refreshes++
+			if s.logger != nil {
+				s.logger("debug", "oauth2 token refreshed", map[string]interface{}{"url": s.cfg.TokenURL})
+			}
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	return nil
+}
+
+// fetch requests a new token from the token endpoint.
+func (s *tokenSource) fetch(ctx context.Context) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	req, err := http.NewRequest("POST", s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("requester: fetching OAuth2 token: %v", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("requester: fetching OAuth2 token: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("requester: fetching OAuth2 token: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("requester: fetching OAuth2 token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return fmt.Errorf("requester: fetching OAuth2 token: %v", err)
+	}
+	if tok.AccessToken == "" {
+		return fmt.Errorf("requester: fetching OAuth2 token: no access_token in the response")
+	}
+	if tok.TokenType != "" && !strings.EqualFold(tok.TokenType, "bearer") {
+		return fmt.Errorf("requester: fetching OAuth2 token: unsupported token type %q", tok.TokenType)
+	}
+	s.token = tok.AccessToken
+	s.refreshAt = time.Time{}
+	if tok.ExpiresIn > 0 {
+		s.refreshAt = start.Add(time.Duration(tok.ExpiresIn) * time.Second * 9 / 10)
+	}
+	return nil
+}
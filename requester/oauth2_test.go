@@ -0,0 +1,161 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer issues numbered tokens to the client "hey" with the secret
+// "s3cret" and the scope "read".
+func tokenServer(issued *int64) *httptest.Server {
+	return httptest.NewServer(tokenHandler(issued))
+}
+
+func tokenHandler(issued *int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		r.ParseForm()
+		if !ok || id != "hey" || secret != "s3cret" || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt64(issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, n)
+	})
+}
+
+func TestOAuth2(t *testing.T) {
+	var issued int64
+	tokens := tokenServer(&issued)
+	defer tokens.Close()
+	var authorized int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			atomic.AddInt64(&authorized, 1)
+		}
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       10,
+		C:       2,
+		Writer:  &out,
+		OAuth2: &OAuth2{
+			TokenURL:     tokens.URL,
+			ClientID:     "hey",
+			ClientSecret: "s3cret",
+			Scopes:       []string{"read"},
+		},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if authorized != 10 || issued != 1 {
+		t.Errorf("Expected 10 requests with a single token, found %v requests and %v tokens", authorized, issued)
+	}
+	if !strings.Contains(out.String(), "Token refreshes:\t0") {
+		t.Errorf("Expected the token refreshes in the output, found %v", out.String())
+	}
+
+	w.OAuth2.ClientSecret = "wrong"
+	if err := w.Run(); err == nil {
+		t.Errorf("Expected an error for invalid client credentials")
+	}
+}
+
+func TestOAuth2Refresh(t *testing.T) {
+	var issued int64
+	tokens := tokenServer(&issued)
+	defer tokens.Close()
+
+	s := newTokenSource(OAuth2{TokenURL: tokens.URL, ClientID: "hey", ClientSecret: "s3cret", Scopes: []string{"read"}}, nil, nil, nil)
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	if err := s.authorize(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer token-1" {
+		t.Errorf("Expected the first token, found %q", got)
+	}
+	if s.refreshAt.Before(time.Now().Add(50 * time.Minute)) {
+		t.Errorf("Expected a refresh after 54 minutes, found %v", s.refreshAt)
+	}
+	s.refreshAt = time.Now().Add(-time.Second)
+	if err := s.authorize(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer token-2" || s.refreshes != 1 {
+		t.Errorf("Expected a refreshed token, found %q after %v refreshes", got, s.refreshes)
+	}
+}
+
+func TestOAuth2VerifiesTokenEndpoint(t *testing.T) {
+	var issued int64
+	tokens := httptest.NewTLSServer(tokenHandler(&issued))
+	defer tokens.Close()
+
+	cfg := OAuth2{TokenURL: tokens.URL, ClientID: "hey", ClientSecret: "s3cret", Scopes: []string{"read"}}
+	// The certificate of the test server is not trusted by the system.
+	if err := newTokenSource(cfg, nil, nil, nil).fetch(context.Background()); err == nil {
+		t.Error("Expected an error for an unverified token endpoint, found none")
+	}
+	if issued != 0 {
+		t.Errorf("Expected the credentials not to be sent, found %v tokens issued", issued)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tokens.Certificate())
+	if err := newTokenSource(cfg, pool, nil, nil).fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if issued != 1 {
+		t.Errorf("Expected a token to be issued, found %v", issued)
+	}
+}
+
+func TestOAuth2Proxy(t *testing.T) {
+	var issued, proxied int64
+	handler := tokenHandler(&issued)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host == "tokens.invalid" {
+			atomic.AddInt64(&proxied, 1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	cfg := OAuth2{TokenURL: "http://tokens.invalid/token", ClientID: "hey", ClientSecret: "s3cret", Scopes: []string{"read"}}
+	if err := newTokenSource(cfg, nil, proxyURL, nil).fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if proxied != 1 {
+		t.Errorf("Expected the token to be fetched through the proxy, found %v requests", proxied)
+	}
+}
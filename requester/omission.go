@@ -0,0 +1,31 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+// recordCorrected records the latency lat, in seconds, corrected for
+// coordinated omission the way HdrHistogram's recordValueWithExpectedInterval
+// does: if lat is longer than the expected interval between requests, the
+// requests that a worker would have sent while waiting are accounted for
+// with the latencies they would have seen, lat minus each multiple of the
+// interval, down to the interval.
+func (r *report) recordCorrected(lat float64) {
+	r.correctedLats = append(r.correctedLats, lat)
+	for missed := lat - r.expectedInterval; missed >= r.expectedInterval; missed -= r.expectedInterval {
+		if len(r.correctedLats) >= maxRes {
+			return
+		}
+		r.correctedLats = append(r.correctedLats, missed)
+	}
+}
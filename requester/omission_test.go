@@ -0,0 +1,79 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRecordCorrected(t *testing.T) {
+	r := &report{expectedInterval: 0.1}
+	r.recordCorrected(0.05)
+	r.recordCorrected(0.45)
+	want := []float64{0.05, 0.45, 0.35, 0.25, 0.15}
+	if len(r.correctedLats) != len(want) {
+		t.Fatalf("Expected %v, found %v", want, r.correctedLats)
+	}
+	for i := range want {
+		if math.Abs(r.correctedLats[i]-want[i]) > 1e-9 {
+			t.Errorf("Expected %v, found %v", want, r.correctedLats)
+			break
+		}
+	}
+}
+
+func TestCorrectOmission(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// The server stalls once, for 20 intervals.
+		if atomic.AddInt64(&count, 1) == 5 {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:         req,
+		N:               20,
+		C:               1,
+		QPS:             100,
+		CorrectOmission: true,
+		Writer:          ioutil.Discard,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lats := append([]float64(nil), w.report.correctedLats...)
+	if len(lats) < 35 {
+		t.Fatalf("Expected the stall to be backfilled, found %v latencies", len(lats))
+	}
+	sort.Float64s(lats)
+	measured := append([]float64(nil), w.report.lats...)
+	sort.Float64s(measured)
+	// A single slow request does not show at the 75th percentile unless
+	// corrected.
+	if p, c := percentile(measured, 75), percentile(lats, 75); c < 0.05 || p > 0.05 {
+		t.Errorf("Expected the 75th percentile to go from under to over 50ms, found %v and %v", p, c)
+	}
+}
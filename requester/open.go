@@ -0,0 +1,90 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net/http"
+	"time"
+)
+
+// ratePause is how far the dispatcher moves on while the scheduled rate
+// is zero.
+const ratePause = 10 * time.Millisecond
+
+// scheduled is a request scheduled by a dispatcher: when it should start
+// and, when replaying with PreserveTiming, its target.
+type scheduled struct {
+	at     time.Time
+	target *target
+}
+
+// dispatch sends the scheduled start time of each of the N requests of an
+// open model run to schedule, at QPS*C requests per second or following
+// RateSchedule, and closes it when done or stopped. Start times follow
+// from the start of the run, so they do not drift when workers fall
+// behind.
+func (b *Work) dispatch(schedule chan<- scheduled) {
+	defer close(schedule)
+	at := b.start
+	for i := 0; i < b.N; {
+		rate := b.rateAt(at.Sub(b.start))
+		if rate <= 0 {
+			last := b.RateSchedule[len(b.RateSchedule)-1]
+			if at.Sub(b.start) >= last.Offset {
+				// The schedule ended at a zero rate.
+				return
+			}
+			at = at.Add(ratePause)
+			continue
+		}
+		if d := at.Sub(time.Now()); d > 0 {
+			select {
+			case <-b.stopCh:
+				return
+			case <-time.After(d):
+			}
+		}
+		select {
+		case <-b.stopCh:
+			return
+		case schedule <- scheduled{at: at}:
+		}
+		i++
+		at = at.Add(time.Duration(float64(time.Second) / rate))
+	}
+}
+
+// rateAt returns the request rate at offset from the start of the run.
+func (b *Work) rateAt(offset time.Duration) float64 {
+	if len(b.RateSchedule) == 0 {
+		return b.QPS * float64(b.C)
+	}
+	return rateAt(b.RateSchedule, offset)
+}
+
+// runOpenWorker makes the requests scheduled by dispatch until there are
+// no more or the run is stopped.
+func (b *Work) runOpenWorker(client *http.Client, id int, schedule <-chan scheduled) {
+	num := 0
+	for s := range schedule {
+		select {
+		case <-b.stopCh:
+			return
+		default:
+		}
+		b.safeMakeRequest(client, id, num, s.at, s.target)
+		num++
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOpenModel(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+		time.Sleep(100 * time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	// A request is scheduled every 50ms but the single worker needs
+	// 100ms for each, so requests queue up behind schedule.
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:   req,
+		N:         6,
+		C:         1,
+		QPS:       20,
+		OpenModel: true,
+		Writer:    ioutil.Discard,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 6 {
+		t.Errorf("Expected to send 6 requests, found %v", count)
+	}
+	lats := w.report.correctedLats
+	if len(lats) != 6 {
+		t.Fatalf("Expected 6 corrected latencies, found %v", len(lats))
+	}
+	sort.Float64s(lats)
+	// The last request was scheduled at 250ms and done at about 600ms.
+	if worst := lats[len(lats)-1]; worst < 0.3 {
+		t.Errorf("Expected the corrected latency to include queuing, found %v", worst)
+	}
+	if worst := w.report.lats[len(w.report.lats)-1]; worst > 0.3 {
+		t.Errorf("Expected the service latency to exclude queuing, found %v", worst)
+	}
+}
+
+func TestOpenModelStop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:   req,
+		N:         1000,
+		C:         2,
+		QPS:       1,
+		OpenModel: true,
+		Writer:    ioutil.Discard,
+	}
+	time.AfterFunc(100*time.Millisecond, w.Stop)
+	start := time.Now()
+	w.Run()
+	if d := time.Now().Sub(start); d > 2*time.Second {
+		t.Errorf("Expected the dispatcher to stop promptly, took %v", d)
+	}
+}
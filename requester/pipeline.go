@@ -0,0 +1,148 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errPipelineBroken is the error of the pipelined requests a server
+// closed the connection, or failed, before answering.
+var errPipelineBroken = errors.New("pipelined request not answered")
+
+// rawResponse is a response to a pipelined request.
+type rawResponse struct {
+	code int
+	size int64
+	end  time.Time
+	err  error
+}
+
+// pipeline writes k requests at once on a connection, then reads their
+// responses in order.
+func (c *rawClient) pipeline(ctx context.Context, k int) ([]rawResponse, bool) {
+	resps := make([]rawResponse, k)
+	conn, reused, err := c.get(ctx)
+	if err == nil {
+		_, err = conn.Write(c.batch[:k*len(c.req)])
+	}
+	if err != nil {
+		now := time.Now()
+		for i := range resps {
+			resps[i] = rawResponse{end: now, err: err}
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		return resps, reused
+	}
+	keep := true
+	for i := range resps {
+		r := &resps[i]
+		if !keep {
+			// The responses left will not come on this connection.
+			r.end, r.err = resps[i-1].end, errPipelineBroken
+			continue
+		}
+		r.code, r.size, keep, r.err = c.readResponse(conn.r)
+		r.end = time.Now()
+	}
+	c.put(conn, keep)
+	return resps, reused
+}
+
+// runPipelineWorker makes the n requests of a worker in batches of
+// PipelineDepth.
+func (b *Work) runPipelineWorker(n int) {
+	for i := 0; i < n; i += b.PipelineDepth {
+		select {
+		case <-b.stopCh:
+			return
+		default:
+		}
+		b.makePipelinedRequests(min(b.PipelineDepth, n-i))
+	}
+}
+
+// makePipelinedRequests makes a batch of k pipelined requests and sends
+// their results to the reporter. The duration of each request runs from
+// the start of the batch to its response.
+func (b *Work) makePipelinedRequests(k int) {
+	s := time.Now()
+	resps, reused := b.raw.pipeline(b.ctx, k)
+	if b.ctx.Err() != nil {
+		// The run was canceled, not the requests failed.
+		for range resps {
+			b.canceled()
+		}
+		return
+	}
+	b.pipeline.add(s, resps)
+	for i, r := range resps {
+		b.results <- b.rawResult(s, r.end, r.code, r.size, reused || i > 0, r.err)
+	}
+}
+
+// pipelineStats are the batches of PipelineDepth.
+type pipelineStats struct {
+	mu      sync.Mutex
+	depth   int
+	batches int64
+	broken  int64 // batches with a request not answered
+	// serial is the estimated duration of the answered batches with
+	// their requests made one after the other, as many times the time to
+	// their first response as they have requests, and pipelined their
+	// actual duration.
+	serial    time.Duration
+	pipelined time.Duration
+}
+
+func (p *pipelineStats) add(start time.Time, resps []rawResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches++
+	for _, r := range resps {
+		if r.err != nil {
+			p.broken++
+			return
+		}
+	}
+	p.serial += time.Duration(len(resps)) * resps[0].end.Sub(start)
+	p.pipelined += resps[len(resps)-1].end.Sub(start)
+}
+
+// speedup returns how many times faster the answered batches were than
+// serial requests, or 0 if none was answered.
+func (p *pipelineStats) speedup() float64 {
+	if p.pipelined <= 0 {
+		return 0
+	}
+	return float64(p.serial) / float64(p.pipelined)
+}
+
+func (r *report) printPipeline() {
+	p := r.pipeline
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r.printf("\nPipelining (experimental):\n")
+	r.printf("  Depth:\t%d requests per batch\n", p.depth)
+	r.printf("  Batches:\t%d, %d not fully answered\n", p.batches, p.broken)
+	if s := p.speedup(); s > 0 {
+		r.printf("  Speedup:\t%4.2fx over serial requests (estimated)\n", s)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPipelineDepth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	rr := &recordingReporter{}
+	w := &Work{Request: req, N: 40, C: 2, RawMode: true, PipelineDepth: 4, Reporter: rr}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rr.results) != 40 {
+		t.Fatalf("Expected 40 results, found %v", len(rr.results))
+	}
+	for _, res := range rr.results {
+		if res.Err != nil || res.StatusCode != 200 || res.BodySize != 2 {
+			t.Fatalf("Expected a 200 response with a 2 byte body, found %v with %v bytes and error %v", res.StatusCode, res.BodySize, res.Err)
+		}
+	}
+	p := w.report.pipeline
+	if p.batches != 10 || p.broken != 0 {
+		t.Errorf("Expected 10 batches answered, found %v with %v broken", p.batches, p.broken)
+	}
+	if p.speedup() <= 0 {
+		t.Errorf("Expected a speedup, found %v", p.speedup())
+	}
+}
+
+func TestPipelineBroken(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				// Answer only the first request, as a server that does
+				// not support pipelining might.
+				http.ReadRequest(bufio.NewReader(c))
+				fmt.Fprint(c, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+			}()
+		}
+	}()
+
+	req, _ := http.NewRequest("GET", "http://"+ln.Addr().String(), nil)
+	rr := &recordingReporter{}
+	w := &Work{Request: req, N: 6, C: 1, RawMode: true, PipelineDepth: 3, Reporter: rr, Writer: ioutil.Discard}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for _, res := range rr.results {
+		if res.Err == errPipelineBroken {
+			failed++
+		}
+	}
+	if failed != 4 {
+		t.Errorf("Expected 4 requests not answered, found %v", failed)
+	}
+	if p := w.report.pipeline; p.batches != 2 || p.broken != 2 {
+		t.Errorf("Expected 2 broken batches, found %v of %v", p.broken, p.batches)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import "sync"
+
+// PoolStats are the statistics of the connection pool of the transport
+// over a run, gathered from the connection trace of the requests, from
+// PoolStats.
+type PoolStats struct {
+	Opened        int64 // connections opened
+	Reused        int64 // requests made on a connection of an earlier one
+	MaxConcurrent int64 // most connections in use by requests at once
+	IdleClosed    int64 // connections closed when done rather than kept idle, such as when the idle pool was full
+}
+
+// poolTracker gathers PoolStats. Each request holds the connections it
+// got until it puts them back idle or completes.
+type poolTracker struct {
+	mu     sync.Mutex
+	stats  PoolStats
+	active int64 // connections held by requests
+}
+
+// got records a request getting a connection.
+func (p *poolTracker) got(reused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if reused {
+		p.stats.Reused++
+	} else {
+		p.stats.Opened++
+	}
+	p.active++
+	if p.active > p.stats.MaxConcurrent {
+		p.stats.MaxConcurrent = p.active
+	}
+}
+
+// put records a request putting a connection back, closed if it could
+// not be kept idle.
+func (p *poolTracker) put(closed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if closed {
+		p.stats.IdleClosed++
+	}
+	p.active--
+}
+
+// release records a request completing while still holding n
+// connections, such as after an error.
+func (p *poolTracker) release(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active -= int64(n)
+}
+
+// PoolStats returns the statistics of the connection pool over the
+// requests made so far, such as the number of connections opened and the
+// most in use at once, to tell whether it is sized right. They do not
+// cover WebSocket, HandshakeOnly and RawMode, which manage their
+// connections themselves. It returns nil before Run.
+func (b *Work) PoolStats() *PoolStats {
+	b.mu.Lock()
+	p := b.pool
+	b.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	return &s
+}
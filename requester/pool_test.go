@@ -0,0 +1,69 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPoolStats(t *testing.T) {
+	const hosts = 4
+	var targets []Target
+	for i := 0; i < hosts; i++ {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+		u, _ := url.Parse(server.URL)
+		targets = append(targets, Target{URL: u, C: 1})
+	}
+
+	req, _ := http.NewRequest("GET", "", nil)
+	w := &Work{Request: req, N: 40, C: hosts, Writer: ioutil.Discard, Targets: targets}
+	if s := w.PoolStats(); s != nil {
+		t.Errorf("Expected no pool stats before Run, found %+v", s)
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s := w.PoolStats()
+	// A connection to each host, reused by the requests after the first.
+	if s.Opened != hosts || s.Reused != 40-hosts {
+		t.Errorf("Expected %v connections opened and %v reuses, found %+v", hosts, 40-hosts, s)
+	}
+	if s.MaxConcurrent < 1 || s.MaxConcurrent > hosts {
+		t.Errorf("Expected at most %v connections in use at once, found %v", hosts, s.MaxConcurrent)
+	}
+	if s.IdleClosed != 0 {
+		t.Errorf("Expected no idle connection closed, found %v", s.IdleClosed)
+	}
+}
+
+func TestPoolStatsDisableKeepAlives(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 10, C: 2, Writer: ioutil.Discard, DisableKeepAlives: true}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s := w.PoolStats()
+	if s.Opened != 10 || s.Reused != 0 || s.MaxConcurrent > 2 {
+		t.Errorf("Expected a connection for each request, at most 2 at once, found %+v", s)
+	}
+}
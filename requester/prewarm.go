@@ -0,0 +1,145 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// prewarmPool holds connections established before the run and hands
+// them out to the transport in place of dialing new ones.
+type prewarmPool struct {
+	dialer *net.Dialer
+	source *sourceDialer // dials from LocalAddrs, if set
+	tls    *tls.Config
+
+	mu     sync.Mutex
+	conns  map[string][]net.Conn // idle prewarmed connections by address
+	dialed int
+	used   int
+}
+
+func newPrewarmPool(tlsConfig *tls.Config, source *sourceDialer) *prewarmPool {
+	return &prewarmPool{
+		dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		source: source,
+		tls:    tlsConfig,
+		conns:  make(map[string][]net.Conn),
+	}
+}
+
+// fill establishes n connections to the host of u, including the TLS
+// handshake for https URLs.
+func (p *prewarmPool) fill(u *url.URL, n int) error {
+	addr := hostPort(u)
+	for i := 0; i < n; i++ {
+		var c net.Conn
+		var err error
+		if u.Scheme == "https" {
+			c, err = p.dialTLS("tcp", addr)
+		} else {
+			c, err = p.pick().Dial("tcp", addr)
+		}
+		if err != nil {
+			p.close()
+			return fmt.Errorf("requester: prewarming connection to %s: %v", addr, err)
+		}
+		p.mu.Lock()
+		p.conns[addr] = append(p.conns[addr], c)
+		p.dialed++
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// take returns a prewarmed connection to addr, or nil if there is none.
+func (p *prewarmPool) take(addr string) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := p.conns[addr]
+	if len(conns) == 0 {
+		return nil
+	}
+	c := conns[len(conns)-1]
+	p.conns[addr] = conns[:len(conns)-1]
+	p.used++
+	return c
+}
+
+// DialContext is used as the transport's dial function.
+func (p *prewarmPool) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c := p.take(addr); c != nil {
+		return c, nil
+	}
+	return p.pick().DialContext(ctx, network, addr)
+}
+
+// DialTLS is used as the transport's TLS dial function. Connections it
+// returns have completed their handshake.
+func (p *prewarmPool) DialTLS(network, addr string) (net.Conn, error) {
+	if c := p.take(addr); c != nil {
+		return c, nil
+	}
+	return p.dialTLS(network, addr)
+}
+
+func (p *prewarmPool) dialTLS(network, addr string) (net.Conn, error) {
+	cfg := p.tls.Clone()
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerName = host
+	}
+	return tls.DialWithDialer(p.pick(), network, addr, cfg)
+}
+
+// pick returns the dialer of the next connection.
+func (p *prewarmPool) pick() *net.Dialer {
+	if p.source != nil {
+		return p.source.pick()
+	}
+	return p.dialer
+}
+
+// close closes the prewarmed connections that were never used.
+func (p *prewarmPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for addr, conns := range p.conns {
+		for _, c := range conns {
+			c.Close()
+		}
+		delete(p.conns, addr)
+	}
+}
+
+// hostPort returns the host:port address to dial for u.
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func testPrewarm(t *testing.T, server *httptest.Server, conns *int64) {
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:      req,
+		N:            20,
+		C:            2,
+		PrewarmConns: 2,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt64(conns); got != 2 {
+		t.Errorf("Expected 2 connections to the server, found %v", got)
+	}
+	if got := w.report.prewarmUsed; got != 2 {
+		t.Errorf("Expected 2 prewarmed connections to be used, found %v", got)
+	}
+	// Only the first request on each prewarmed connection is not a reuse.
+	if got := w.report.numReused; got != 18 {
+		t.Errorf("Expected 18 requests on reused connections, found %v", got)
+	}
+}
+
+func TestPrewarmConns(t *testing.T) {
+	var conns int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	testPrewarm(t, server, &conns)
+}
+
+func TestPrewarmConnsTLS(t *testing.T) {
+	var conns int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+	testPrewarm(t, server, &conns)
+}
@@ -15,21 +15,71 @@
 package requester
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net/http"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 const (
 	barChar = "∎"
+
+	// minLogBucket is the first logarithmic histogram bucket, in seconds,
+	// when the fastest latency is zero.
+	minLogBucket = 1e-6
 )
 
 // We report for max 1M results.
 const maxRes = 1000000
 
+// pctlsReported are the percentiles reported for latency distributions.
+var pctlsReported = []int{10, 25, 50, 75, 90, 95, 99}
+
+// portExhaustion is the error reported for dials that found no free
+// local port.
+const portExhaustion = "local port exhaustion"
+
+// bodyReadError is the error reported for response bodies cut short.
+const bodyReadError = "body read error"
+
+// bodyReadTimeout is the error reported for response bodies cut short by
+// the request timing out.
+const bodyReadTimeout = "body read timeout"
+
+// errorKey returns the key of err in the error distribution.
+func errorKey(err error) string {
+	// The kernel has no ephemeral port left for the local address, which
+	// reads as a server failure in the error itself.
+	if errors.Is(err, syscall.EADDRNOTAVAIL) {
+		return portExhaustion
+	}
+	// Whatever cut the body short, the response was incomplete.
+	var body *bodyError
+	if errors.As(err, &body) {
+		if body.timeout {
+			return bodyReadTimeout
+		}
+		return bodyReadError
+	}
+	// The error of the client names the URL, which may vary.
+	if errors.Is(err, errDowngradeRedirect) {
+		return errDowngradeRedirect.Error()
+	}
+	return err.Error()
+}
+
 type report struct {
+	// mu guards the aggregates below against Snapshot while the reporter
+	// records results.
+	mu sync.Mutex
+
 	avgTotal float64
 	fastest  float64
 	slowest  float64
@@ -41,101 +91,514 @@ type report struct {
 	avgReq    float64
 	avgRes    float64
 	avgDelay  float64
+	avgTTFB   float64
+	avgTLS    float64
 	connLats  []float64
 	dnsLats   []float64
 	reqLats   []float64
 	resLats   []float64
 	delayLats []float64
+	ttfbLats  []float64
+	tlsLats   []float64
+
+	// continueLats are the ContinueDurations of the requests that got a
+	// 100 Continue response, averaging avgContinue.
+	avgContinue  float64
+	continueLats []float64
+
+	// headerBytes and headerFields are the HeaderBytes and HeaderFields
+	// of the responses.
+	headerBytes  []float64
+	headerFields []float64
+
+	// correctedLats are the latencies corrected for coordinated omission:
+	// measured from the scheduled start of the requests in the open model,
+	// or backfilled with the expected interval between requests, in
+	// seconds, otherwise.
+	openModel        bool
+	expectedInterval float64
+	correctedLats    []float64
 
-	results chan *result
+	// histBuckets are the bucket bounds of the histogram, in seconds, if
+	// set, and linearBuckets spaces the automatic ones linearly rather
+	// than logarithmically.
+	histBuckets   []float64
+	linearBuckets bool
+
+	// scheduleLags are how far behind the recorded schedule requests were
+	// sent with PreserveTiming, in seconds.
+	replay       bool
+	scheduleLags []float64
+
+	results chan *Result
 	done    chan bool
 	total   time.Duration
 
-	errorDist      map[string]int
-	statusCodeDist map[int]int
-	lats           []float64
-	sizeTotal      int64
-	numRes         int64
-	output         string
+	// reporter writes the output of the run.
+	reporter Reporter
+
+	errorDist       map[string]int
+	statusCodeDist  map[int]int
+	tlsVersionDist  map[string]int
+	cipherSuiteDist map[string]int
+	alpnDist        map[string]int
+	serverNameDist  map[string]int
+	grpcStatusDist  map[string]int
+	encodingDist    map[string]int
+	lats            []float64
+	sizeTotal       int64
+	numRes          int64
+	numReused       int64
+	numTruncated    int64
+	numCompressed   int64
+	wireTotal       int64 // response body bytes read from the wire
+	decodedTotal    int64 // response body bytes after decoding
+
+	prewarmed   int // connections established before the run
+	prewarmUsed int // prewarmed connections used by the transport
+
+	// h2Conns are the connections of H2Conns.
+	h2Conns []h2Conn
+
+	// replayed is the number of targets made replayFactor requests each,
+	// with ReplayFactor.
+	replayFactor int
+	replayed     int64
+
+	// pipeline are the batches of PipelineDepth.
+	pipeline *pipelineStats
+
+	// connsCycled is the number of connections closed for being older
+	// than maxConnDuration.
+	maxConnDuration time.Duration
+	connsCycled     int64
+
+	// crossOrigin and downgrades are the number of redirects to another
+	// origin and from https to http.
+	crossOrigin int64
+	downgrades  int64
+
+	// apdexTarget is the ApdexTarget of the run, if any.
+	apdexTarget time.Duration
+
+	// dns are the DNS lookups of the run.
+	dns *DNSStats
+
+	// bandwidthBytes is the number of bytes read and written by the
+	// connections of a MaxBandwidth run.
+	maxBandwidth   int
+	bandwidthBytes int64
+
+	// fallbacks is the number of requests sent again uncompressed, with
+	// FallbackUncompressed.
+	fallbacks int64
+
+	// digestChallenges is the number of extra round trips made to answer
+	// Digest challenges.
+	digestChallenges int64
 
-	w io.Writer
+	// ntlmHandshakes is the number of NTLM handshakes made, and
+	// ntlmFailures the number the server rejected.
+	ntlm           bool
+	ntlmHandshakes int64
+	ntlmFailures   int64
+
+	// numDeadline is the number of requests that exceeded the deadline
+	// of their DeadlineHeader.
+	numDeadline int64
+
+	// drainCancels is the number of requests canceled by DrainTimeout.
+	drainCancels int64
+
+	// slowCaptures is the number of requests slower than slowThreshold
+	// that were captured.
+	slowThreshold time.Duration
+	slowCaptures  int64
+
+	// revalidate reports the share of 304 responses, with Revalidate.
+	revalidate bool
+
+	// tokenRefreshes is the number of OAuth2 tokens fetched after the
+	// first.
+	oauth2         bool
+	tokenRefreshes int
+
+	// maxInFlight is the most requests in flight at once, under the
+	// inFlightCap of MaxInFlight, and inFlightDropped the requests dropped
+	// at the cap.
+	maxInFlight     int64
+	inFlightCap     int
+	inFlightDropped int64
+
+	// ipFamilyDist is the number of connections made with each IP
+	// version, reported with IPVersion.
+	ipVersion    bool
+	ipFamilyDist map[string]int
+
+	// roundRobin counts the requests answered by each address of a
+	// DNSRoundRobin run in remoteIPDist, and resolved are its addresses,
+	// with the connections dialed to each in resolvedConns.
+	roundRobin    bool
+	remoteIPDist  map[string]int
+	resolved      []string
+	resolvedConns map[string]int
+
+	// sourceDist is the number of connections made from each of
+	// LocalAddrs.
+	sourceDist map[string]int
+
+	// WebSocket connections that failed their handshake or were dropped,
+	// and the round trips of their messages.
+	websocket    bool
+	wsFailed     int64
+	wsDropped    int64
+	wsRoundTrips []float64
+
+	// Server-sent events received, the times to the first event of each
+	// stream and the gaps between events, with SSE.
+	sse            bool
+	numEvents      int64
+	firstEventLats []float64
+	eventGaps      []float64
+
+	// Chunked uploads of a ChunkSize run, and the durations of those
+	// cut off before the whole body was sent.
+	chunked    bool
+	numUploads int64
+	numCutOff  int64
+	cutOffLats []float64
+
+	// breaker is the CircuitBreaker of the run, if any, observing the
+	// results as they are recorded.
+	breaker *circuitBreaker
+
+	// failures stops the run after MaxConsecutiveFailures, if set.
+	failures *failureStreak
+
+	// slowestRes and fastestRes keep the results of ShowSlowest and
+	// ShowFastest.
+	slowestRes *extremes
+	fastestRes *extremes
+
+	// abortedBy is the first result for which AbortOnResponse stopped the
+	// run, after abortAt results.
+	abortedBy *Result
+	abortAt   int64
+
+	// tags are the Tags of the run, for the machine-readable output.
+	tags map[string]string
+
+	// handshake leaves out the request details of a HandshakeOnly run.
+	handshake bool
+
+	// grpcWeb counts the frames of the responses of a GRPCWeb run: their
+	// messages, and the responses with a trailer frame.
+	grpcWeb          bool
+	grpcWebResponses int64
+	grpcWebMessages  int64
+	grpcWebTrailers  int64
+
+	// acc is the accumulator of reducer, set by the reporter goroutine
+	// under mu.
+	reducer func(acc interface{}, res Result) interface{}
+	acc     interface{}
+
+	// stream receives every result, for Work.Results, until the run is
+	// stopped or canceled by streamStop or streamCtx, after which results
+	// that do not fit its buffer are counted in dropped.
+	stream     chan<- Result
+	streamStop <-chan struct{}
+	streamCtx  <-chan struct{}
+	dropped    int
+
+	// targets are the results of each target of a Targets run, by name,
+	// and targetNames their names in order.
+	targets     map[string]*targetStats
+	targetNames []string
+
+	// metrics are the values ExtractMetric returned, and metricErrors the
+	// number of responses it failed on.
+	metric       bool
+	metrics      []float64
+	metricErrors int64
+
+	// concurrency is the trajectory of an adaptive run, if any.
+	concurrency []concurrencyStep
+
+	start          time.Time
+	end            time.Time // set before results is closed
+	interval       time.Duration
+	intervalFormat string
+	window         *window
+
+	w         io.Writer // where the summary is written
+	rowWriter io.Writer // where rows are written as the run progresses
 }
 
-func newReport(w io.Writer, results chan *result, output string, n int) *report {
-	cap := min(n, maxRes)
+// newReport returns the report of a run of n requests. Runs of up to
+// maxRes requests get the storage of all their results at once, longer
+// ones, such as those of a duration, grow it as results come instead of
+// reserving maxRes of each.
+func newReport(w io.Writer, results chan *Result, n int) *report {
+	cap := n
+	if n > maxRes {
+		cap = 0
+	}
 	return &report{
-		output:         output,
-		results:        results,
-		done:           make(chan bool, 1),
-		statusCodeDist: make(map[int]int),
-		errorDist:      make(map[string]int),
-		w:              w,
-		connLats:       make([]float64, 0, cap),
-		dnsLats:        make([]float64, 0, cap),
-		reqLats:        make([]float64, 0, cap),
-		resLats:        make([]float64, 0, cap),
-		delayLats:      make([]float64, 0, cap),
-		lats:           make([]float64, 0, cap),
+		results:         results,
+		done:            make(chan bool, 1),
+		statusCodeDist:  make(map[int]int),
+		tlsVersionDist:  make(map[string]int),
+		cipherSuiteDist: make(map[string]int),
+		alpnDist:        make(map[string]int),
+		serverNameDist:  make(map[string]int),
+		grpcStatusDist:  make(map[string]int),
+		encodingDist:    make(map[string]int),
+		ipFamilyDist:    make(map[string]int),
+		remoteIPDist:    make(map[string]int),
+		errorDist:       make(map[string]int),
+		w:               w,
+		connLats:        make([]float64, 0, cap),
+		dnsLats:         make([]float64, 0, cap),
+		reqLats:         make([]float64, 0, cap),
+		resLats:         make([]float64, 0, cap),
+		delayLats:       make([]float64, 0, cap),
+		ttfbLats:        make([]float64, 0, cap),
+		tlsLats:         make([]float64, 0, cap),
+		lats:            make([]float64, 0, cap),
+		headerBytes:     make([]float64, 0, cap),
+		headerFields:    make([]float64, 0, cap),
 	}
 }
 
 func runReporter(r *report) {
+	var tick <-chan time.Time
+	if r.interval > 0 {
+		r.window = &window{}
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
 	// Loop will continue until channel is closed
-	for res := range r.results {
-		r.numRes++
-		if res.err != nil {
-			r.errorDist[res.err.Error()]++
-		} else {
-			r.avgTotal += res.duration.Seconds()
-			r.avgConn += res.connDuration.Seconds()
-			r.avgDelay += res.delayDuration.Seconds()
-			r.avgDNS += res.dnsDuration.Seconds()
-			r.avgReq += res.reqDuration.Seconds()
-			r.avgRes += res.resDuration.Seconds()
-			if len(r.resLats) < maxRes {
-				r.lats = append(r.lats, res.duration.Seconds())
-				r.connLats = append(r.connLats, res.connDuration.Seconds())
-				r.dnsLats = append(r.dnsLats, res.dnsDuration.Seconds())
-				r.reqLats = append(r.reqLats, res.reqDuration.Seconds())
-				r.delayLats = append(r.delayLats, res.delayDuration.Seconds())
-				r.resLats = append(r.resLats, res.resDuration.Seconds())
+	for {
+		select {
+		case res, ok := <-r.results:
+			if !ok {
+				if r.window != nil {
+					r.flushWindows(r.end, true)
+				}
+				// Signal reporter is done.
+				r.done <- true
+				return
+			}
+			r.record(res)
+			r.reporter.Record(*res)
+			if r.reducer != nil {
+				r.reduce(res)
+			}
+			if r.breaker != nil {
+				r.breaker.observe(res)
+			}
+			if r.failures != nil {
+				r.failures.observe(res)
 			}
-			r.statusCodeDist[res.statusCode]++
-			if res.contentLength > 0 {
-				r.sizeTotal += res.contentLength
+			if r.stream != nil {
+				r.send(res)
 			}
+		case now := <-tick:
+			r.flushWindows(now, false)
 		}
 	}
-	// Signal reporter is done.
-	r.done <- true
 }
 
-func (r *report) finalize(total time.Duration) {
-	r.total = total
-	r.rps = float64(r.numRes) / r.total.Seconds()
-	r.average = r.avgTotal / float64(len(r.lats))
-	r.avgConn = r.avgConn / float64(len(r.lats))
-	r.avgDelay = r.avgDelay / float64(len(r.lats))
-	r.avgDNS = r.avgDNS / float64(len(r.lats))
-	r.avgReq = r.avgReq / float64(len(r.lats))
-	r.avgRes = r.avgRes / float64(len(r.lats))
-	r.print()
+func (r *report) record(res *Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.window != nil {
+		r.flushWindows(res.Start.Add(res.Duration), false)
+		r.window.count++
+	}
+	r.numRes++
+	if r.roundRobin && res.RemoteIP != "" {
+		r.remoteIPDist[res.RemoteIP]++
+	}
+	if r.targets != nil {
+		r.recordTarget(res)
+	}
+	if res.DeadlineExceeded {
+		r.numDeadline++
+	}
+	if res.Aborted && r.abortedBy == nil {
+		r.abortedBy, r.abortAt = res, r.numRes
+	}
+	if r.chunked {
+		r.numUploads++
+		if res.UploadCutOff {
+			r.numCutOff++
+			if len(r.cutOffLats) < maxRes {
+				r.cutOffLats = append(r.cutOffLats, res.Duration.Seconds())
+			}
+		}
+	}
+	if res.Err != nil {
+		r.errorDist[errorKey(res.Err)]++
+		if r.websocket {
+			r.wsFailed++
+		}
+		if r.window != nil {
+			r.window.errors++
+		}
+	} else {
+		r.avgTotal += res.Duration.Seconds()
+		r.avgConn += res.ConnDuration.Seconds()
+		r.avgDelay += res.DelayDuration.Seconds()
+		r.avgDNS += res.DNSDuration.Seconds()
+		r.avgReq += res.ReqDuration.Seconds()
+		r.avgRes += res.ResDuration.Seconds()
+		r.avgTTFB += res.TTFBDuration.Seconds()
+		r.avgTLS += res.TLSDuration.Seconds()
+		if res.ContinueDuration > 0 {
+			r.avgContinue += res.ContinueDuration.Seconds()
+		}
+		if r.window != nil {
+			r.window.lats = append(r.window.lats, res.Duration.Seconds())
+		}
+		if r.slowestRes != nil {
+			r.slowestRes.add(res)
+		}
+		if r.fastestRes != nil {
+			r.fastestRes.add(res)
+		}
+		if len(r.resLats) < maxRes {
+			r.lats = append(r.lats, res.Duration.Seconds())
+			r.connLats = append(r.connLats, res.ConnDuration.Seconds())
+			r.dnsLats = append(r.dnsLats, res.DNSDuration.Seconds())
+			r.reqLats = append(r.reqLats, res.ReqDuration.Seconds())
+			r.delayLats = append(r.delayLats, res.DelayDuration.Seconds())
+			r.resLats = append(r.resLats, res.ResDuration.Seconds())
+			r.ttfbLats = append(r.ttfbLats, res.TTFBDuration.Seconds())
+			r.tlsLats = append(r.tlsLats, res.TLSDuration.Seconds())
+			if res.StatusCode != 0 {
+				r.headerBytes = append(r.headerBytes, float64(res.HeaderBytes))
+				r.headerFields = append(r.headerFields, float64(res.HeaderFields))
+			}
+			if res.ContinueDuration > 0 {
+				r.continueLats = append(r.continueLats, res.ContinueDuration.Seconds())
+			}
+			if r.openModel {
+				r.correctedLats = append(r.correctedLats, (res.QueueDuration + res.Duration).Seconds())
+			} else if r.expectedInterval > 0 {
+				r.recordCorrected(res.Duration.Seconds())
+			}
+			if r.replay {
+				r.scheduleLags = append(r.scheduleLags, res.QueueDuration.Seconds())
+			}
+		}
+		r.statusCodeDist[res.StatusCode]++
+		if res.GRPCStatus != "" {
+			r.grpcStatusDist[res.GRPCStatus]++
+		}
+		if r.metric {
+			if res.MetricErr != nil {
+				r.metricErrors++
+			} else if len(r.metrics) < maxRes {
+				r.metrics = append(r.metrics, res.Metric)
+			}
+		}
+		if r.grpcWeb {
+			r.grpcWebResponses++
+			r.grpcWebMessages += int64(res.GRPCWebMessages)
+			if res.GRPCWebTrailers {
+				r.grpcWebTrailers++
+			}
+		}
+		if res.Encoding != "" {
+			r.encodingDist[res.Encoding]++
+		}
+		if res.TLSVersion != 0 {
+			r.tlsVersionDist[tlsVersionName(res.TLSVersion)]++
+			r.cipherSuiteDist[tls.CipherSuiteName(res.CipherSuite)]++
+			if res.ALPN == "" {
+				r.alpnDist["none"]++
+			} else {
+				r.alpnDist[res.ALPN]++
+			}
+			if res.ServerName == "" {
+				r.serverNameDist["none"]++
+			} else {
+				r.serverNameDist[res.ServerName]++
+			}
+		}
+		if res.ConnReused {
+			r.numReused++
+		} else if res.IPFamily != "" {
+			r.ipFamilyDist[res.IPFamily]++
+		}
+		if res.WSDropped {
+			r.wsDropped++
+		}
+		if res.Events > 0 {
+			r.numEvents += int64(res.Events)
+			if len(r.firstEventLats) < maxRes {
+				r.firstEventLats = append(r.firstEventLats, res.FirstEventDuration.Seconds())
+			}
+			for _, gap := range res.EventGaps {
+				if len(r.eventGaps) < maxRes {
+					r.eventGaps = append(r.eventGaps, gap.Seconds())
+				}
+			}
+		}
+		for _, rtt := range res.WSRoundTrips {
+			if len(r.wsRoundTrips) < maxRes {
+				r.wsRoundTrips = append(r.wsRoundTrips, rtt.Seconds())
+			}
+		}
+		if res.Truncated {
+			r.numTruncated++
+		}
+		if res.Compressed {
+			r.numCompressed++
+		}
+		r.wireTotal += res.WireSize
+		r.decodedTotal += res.BodySize
+		if res.ContentLength > 0 {
+			r.sizeTotal += res.ContentLength
+		}
+	}
 }
 
-func (r *report) printCSV() {
-	r.printf("response-time,DNS+dialup,DNS,Request-write,Response-delay,Response-read\n")
-	for i, val := range r.lats {
-		r.printf("%4.4f,%4.4f,%4.4f,%4.4f,%4.4f,%4.4f\n",
-			val, r.connLats[i], r.dnsLats[i], r.reqLats[i], r.delayLats[i], r.resLats[i])
+func (r *report) finalize(total time.Duration) {
+	r.mu.Lock()
+	r.total = total
+	if total > 0 {
+		r.rps = float64(r.numRes) / r.total.Seconds()
+	}
+	// Without successful requests, leave the averages at zero rather
+	// than NaN.
+	if n := float64(len(r.lats)); n > 0 {
+		r.average = r.avgTotal / n
+		r.avgConn = r.avgConn / n
+		r.avgDelay = r.avgDelay / n
+		r.avgDNS = r.avgDNS / n
+		r.avgReq = r.avgReq / n
+		r.avgRes = r.avgRes / n
+		r.avgTTFB = r.avgTTFB / n
+		r.avgTLS = r.avgTLS / n
+	}
+	if n := float64(len(r.continueLats)); n > 0 {
+		r.avgContinue = r.avgContinue / n
 	}
+	r.mu.Unlock()
+	r.reporter.Finalize(total)
 }
 
 func (r *report) print() {
-	if r.output == "csv" {
-		r.printCSV()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.numRes == 0 {
+		r.printf("No results collected.\n")
 		return
 	}
-
 	if len(r.lats) > 0 {
 		sort.Float64s(r.lats)
 		r.fastest = r.lats[0]
@@ -146,22 +609,175 @@ func (r *report) print() {
 		r.printf("  Fastest:\t%4.4f secs\n", r.fastest)
 		r.printf("  Average:\t%4.4f secs\n", r.average)
 		r.printf("  Requests/sec:\t%4.4f\n", r.rps)
+		if r.apdexTarget > 0 {
+			r.printApdex()
+		}
+		if !r.handshake {
+			r.printf("  Success rate:\t%4.1f%% (2xx and 3xx)\n", r.successRate())
+			r.printf("  Reused conns:\t%d requests\n", r.numReused)
+		}
+		if r.prewarmed > 0 {
+			r.printf("  Prewarmed:\t%d of %d connections used\n", r.prewarmUsed, r.prewarmed)
+		}
+		if r.replayFactor > 0 {
+			r.printf("  Replayed:\t%d targets, %d times each\n", r.replayed, r.replayFactor)
+		}
+		if r.maxConnDuration > 0 {
+			r.printf("  Conns cycled:\t%d after %v\n", r.connsCycled, r.maxConnDuration)
+		}
+		if r.maxBandwidth > 0 {
+			r.printf("  Bandwidth:\t%.0f bytes/sec of %d allowed\n", float64(r.bandwidthBytes)/r.total.Seconds(), r.maxBandwidth)
+		}
+		if r.crossOrigin > 0 || r.downgrades > 0 {
+			r.printf("  Redirects:\t%d cross-origin, %d from https to http\n", r.crossOrigin, r.downgrades)
+		}
+		if r.fallbacks > 0 {
+			r.printf("  Uncompressed fallbacks:\t%d requests\n", r.fallbacks)
+		}
+		if r.digestChallenges > 0 {
+			r.printf("  Digest challenges:\t%d extra round trips\n", r.digestChallenges)
+		}
+		if r.ntlm {
+			r.printf("  NTLM handshakes:\t%d, %d rejected\n", r.ntlmHandshakes, r.ntlmFailures)
+		}
+		if r.revalidate {
+			notModified := r.statusCodeDist[http.StatusNotModified]
+			if n := notModified + r.statusCodeDist[http.StatusOK]; n > 0 {
+				r.printf("  Not modified:\t%4.1f%% (%d of %d 200 and 304 responses)\n", 100*float64(notModified)/float64(n), notModified, n)
+			}
+		}
+		if r.oauth2 {
+			r.printf("  Token refreshes:\t%d\n", r.tokenRefreshes)
+		}
+		if r.inFlightCap > 0 {
+			r.printf("  In flight:\t%d max of %d allowed\n", r.maxInFlight, r.inFlightCap)
+		}
+		if r.inFlightDropped > 0 {
+			r.printf("  Dropped:\t%d requests over the in-flight cap\n", r.inFlightDropped)
+		}
 		if r.sizeTotal > 0 {
 			r.printf("  Total data:\t%d bytes\n", r.sizeTotal)
 			r.printf("  Size/request:\t%d bytes\n", r.sizeTotal/int64(len(r.lats)))
 		}
+		if r.numCompressed > 0 {
+			r.printf("  Wire data:\t%d bytes\n", r.wireTotal)
+			r.printf("  Decoded data:\t%d bytes\n", r.decodedTotal)
+		}
+		if r.numDeadline > 0 {
+			r.printf("  Deadline exceeded:\t%d requests\n", r.numDeadline)
+		}
+		if r.drainCancels > 0 {
+			r.printf("  Drain canceled:\t%d requests in flight\n", r.drainCancels)
+		}
+		if r.slowThreshold > 0 {
+			r.printf("  Slow captures:\t%d requests over %v\n", r.slowCaptures, r.slowThreshold)
+		}
+		if r.numTruncated > 0 {
+			r.printf("  Truncated:\t%d responses\n", r.numTruncated)
+		}
 		if r.numRes > maxRes {
 			r.printf("\nNote:  Distributions are for first %d results.", len(r.lats))
 		}
 		r.printHistogram()
 		r.printLatencies()
+		if len(r.correctedLats) > 0 {
+			r.printCorrected()
+		}
+		if len(r.scheduleLags) > 0 {
+			r.printReplay()
+		}
 		r.printf("\nDetails (average, fastest, slowest):")
 		r.printSection("DNS+dialup", r.avgConn, r.connLats)
 		r.printSection("DNS-lookup", r.avgDNS, r.dnsLats)
-		r.printSection("req write", r.avgReq, r.reqLats)
-		r.printSection("resp wait", r.avgDelay, r.delayLats)
-		r.printSection("resp read", r.avgRes, r.resLats)
-		r.printStatusCodes()
+		if r.avgTLS > 0 {
+			r.printSection("TLS handshake", r.avgTLS, r.tlsLats)
+		}
+		if !r.handshake {
+			r.printSection("req write", r.avgReq, r.reqLats)
+			if len(r.continueLats) > 0 {
+				r.printSection("100-continue", r.avgContinue, r.continueLats)
+			}
+			r.printSection("resp wait", r.avgDelay, r.delayLats)
+			r.printSection("resp read", r.avgRes, r.resLats)
+			r.printSection("TTFB", r.avgTTFB, r.ttfbLats)
+			r.printDistribution("TTFB", r.ttfbLats)
+		}
+		if r.avgTLS > 0 {
+			r.printDistribution("TLS handshake", r.tlsLats)
+		}
+		if !r.handshake {
+			r.printStatusCodes()
+			r.printStatusClasses()
+		}
+		if len(r.headerBytes) > 0 {
+			r.printHeaderSizes()
+		}
+		if r.dns != nil && r.dns.Lookups > 0 {
+			r.printDNS()
+		}
+		if len(r.metrics) > 0 || r.metricErrors > 0 {
+			r.printMetric()
+		}
+		if r.slowestRes != nil {
+			r.printExtremes(r.slowestRes)
+		}
+		if r.fastestRes != nil {
+			r.printExtremes(r.fastestRes)
+		}
+		if len(r.grpcStatusDist) > 0 {
+			r.printGRPCStatus()
+		}
+		if r.grpcWebResponses > 0 {
+			r.printGRPCWeb()
+		}
+		if n := len(r.encodingDist); n > 1 || (n == 1 && r.encodingDist["identity"] == 0) {
+			r.printEncodings()
+		}
+		if len(r.tlsVersionDist) > 0 {
+			r.printTLS()
+		}
+		if len(r.sourceDist) > 0 {
+			r.printSources()
+		}
+		if len(r.targets) > 0 {
+			r.printTargets()
+		}
+		if len(r.h2Conns) > 0 {
+			r.printH2Conns()
+		}
+		if r.pipeline != nil {
+			r.printPipeline()
+		}
+		if len(r.resolved) > 0 {
+			r.printResolved()
+		}
+		if r.ipVersion && len(r.ipFamilyDist) > 0 {
+			r.printIPFamilies()
+		}
+	}
+	if r.sse && len(r.lats) > 0 {
+		r.printEvents()
+	}
+	if r.websocket && r.numRes > 0 {
+		r.printWebSocket()
+	}
+	if r.numUploads > 0 {
+		r.printUploads()
+	}
+	if r.handshake {
+		r.printHandshakes()
+	}
+	if r.breaker != nil && r.breaker.broken() {
+		r.printBreaker()
+	}
+	if r.failures != nil && r.failures.stopped() {
+		r.printFailureStreak()
+	}
+	if r.abortedBy != nil {
+		r.printAbort()
+	}
+	if len(r.concurrency) > 0 {
+		r.printConcurrency()
 	}
 	if len(r.errorDist) > 0 {
 		r.printErrors()
@@ -179,7 +795,7 @@ func (r *report) printSection(tag string, avg float64, lats []float64) {
 
 // printLatencies prints percentile latencies.
 func (r *report) printLatencies() {
-	pctls := []int{10, 25, 50, 75, 90, 95, 99}
+	pctls := pctlsReported
 	data := make([]float64, len(pctls))
 	j := 0
 	for i := 0; i < len(r.lats) && j < len(pctls); i++ {
@@ -197,15 +813,28 @@ func (r *report) printLatencies() {
 	}
 }
 
-func (r *report) printHistogram() {
-	bc := 10
-	buckets := make([]float64, bc+1)
-	counts := make([]int, bc+1)
-	bs := (r.slowest - r.fastest) / float64(bc)
-	for i := 0; i < bc; i++ {
-		buckets[i] = r.fastest + bs*float64(i)
+// printCorrected prints percentile latencies corrected for coordinated
+// omission.
+func (r *report) printCorrected() {
+	sort.Float64s(r.correctedLats)
+	r.printf("\nCorrected latency distribution (coordinated omission):\n")
+	for _, p := range pctlsReported {
+		r.printf("  %v%% in %4.4f secs\n", p, percentile(r.correctedLats, float64(p)))
 	}
-	buckets[bc] = r.slowest
+}
+
+// printDistribution prints percentiles of the http-trace field lats. It
+// expects lats to be sorted.
+func (r *report) printDistribution(tag string, lats []float64) {
+	r.printf("\n\n%s distribution:", tag)
+	for _, p := range pctlsReported {
+		r.printf("\n  %v%% in %4.4f secs", p, percentile(lats, float64(p)))
+	}
+}
+
+func (r *report) printHistogram() {
+	buckets := r.histogramBuckets()
+	counts := make([]int, len(buckets))
 	var bi int
 	var max int
 	for i := 0; i < len(r.lats); {
@@ -219,6 +848,11 @@ func (r *report) printHistogram() {
 			bi++
 		}
 	}
+	format := "  %4.3f [%v]\t|%v\n"
+	if !r.linearBuckets || len(r.histBuckets) > 0 {
+		// Short latencies need more digits to tell buckets apart.
+		format = "  %4.4f [%v]\t|%v\n"
+	}
 	r.printf("\nResponse time histogram:\n")
 	for i := 0; i < len(buckets); i++ {
 		// Normalize bar lengths.
@@ -226,10 +860,41 @@ func (r *report) printHistogram() {
 		if max > 0 {
 			barLen = (counts[i]*40 + max/2) / max
 		}
-		r.printf("  %4.3f [%v]\t|%v\n", buckets[i], counts[i], strings.Repeat(barChar, barLen))
+		r.printf(format, buckets[i], counts[i], strings.Repeat(barChar, barLen))
 	}
 }
 
+// histogramBuckets returns the upper bounds of the histogram buckets, in
+// seconds: histBuckets, with one more up to the slowest latency if it is
+// above them, or 11 bounds from the fastest to the slowest latency, at
+// even ratios or, with linearBuckets, at even intervals. The last bound
+// is never below the slowest latency.
+func (r *report) histogramBuckets() []float64 {
+	if len(r.histBuckets) > 0 {
+		buckets := append([]float64(nil), r.histBuckets...)
+		if last := buckets[len(buckets)-1]; r.slowest > last {
+			buckets = append(buckets, r.slowest)
+		}
+		return buckets
+	}
+	bc := 10
+	buckets := make([]float64, bc+1)
+	fastest := r.fastest
+	if !r.linearBuckets && fastest <= 0 {
+		// Ratios need a positive start.
+		fastest = math.Min(minLogBucket, r.slowest)
+	}
+	for i := 0; i < bc; i++ {
+		if !r.linearBuckets && fastest > 0 {
+			buckets[i] = fastest * math.Pow(r.slowest/fastest, float64(i)/float64(bc))
+		} else {
+			buckets[i] = r.fastest + (r.slowest-r.fastest)/float64(bc)*float64(i)
+		}
+	}
+	buckets[bc] = r.slowest
+	return buckets
+}
+
 // printStatusCodes prints status code distribution.
 func (r *report) printStatusCodes() {
 	r.printf("\n\nStatus code distribution:\n")
@@ -238,11 +903,161 @@ func (r *report) printStatusCodes() {
 	}
 }
 
+// printEncodings prints the content coding distribution.
+func (r *report) printEncodings() {
+	r.printf("\nContent encoding distribution:\n")
+	for e, num := range r.encodingDist {
+		r.printf("  [%s]\t%d responses\n", e, num)
+	}
+}
+
+// printGRPCStatus prints the gRPC status distribution.
+func (r *report) printGRPCStatus() {
+	r.printf("\ngRPC status distribution:\n")
+	for s, num := range r.grpcStatusDist {
+		r.printf("  [%s]\t%d responses\n", s, num)
+	}
+}
+
+// printIPFamilies prints the number of connections made with each IP
+// version.
+func (r *report) printIPFamilies() {
+	r.printf("\nIP version distribution:\n")
+	for f, num := range r.ipFamilyDist {
+		r.printf("  [%s]\t%d connections\n", f, num)
+	}
+}
+
+// printSources prints the number of connections made from each local
+// address.
+func (r *report) printSources() {
+	r.printf("\nSource address distribution:\n")
+	for a, num := range r.sourceDist {
+		r.printf("  [%s]\t%d connections\n", a, num)
+	}
+}
+
+// statusClassDist returns the number of responses by status class, such
+// as "2xx".
+func (r *report) statusClassDist() map[string]int {
+	dist := make(map[string]int)
+	for code, num := range r.statusCodeDist {
+		dist[fmt.Sprintf("%dxx", code/100)] += num
+	}
+	return dist
+}
+
+// successRate returns the percentage of requests that got a 2xx or 3xx
+// response.
+func (r *report) successRate() float64 {
+	if r.numRes == 0 {
+		return 0
+	}
+	dist := r.statusClassDist()
+	return 100 * float64(dist["2xx"]+dist["3xx"]) / float64(r.numRes)
+}
+
+// printStatusClasses prints the status class distribution.
+func (r *report) printStatusClasses() {
+	dist := r.statusClassDist()
+	classes := make([]string, 0, len(dist))
+	for c := range dist {
+		classes = append(classes, c)
+	}
+	sort.Strings(classes)
+	r.printf("\nStatus class distribution:\n")
+	for _, c := range classes {
+		r.printf("  [%s]\t%d responses\n", c, dist[c])
+	}
+}
+
+// printTLS prints the negotiated TLS version, cipher suite and ALPN
+// protocol distributions.
+func (r *report) printTLS() {
+	r.printf("\nTLS version distribution:\n")
+	for v, num := range r.tlsVersionDist {
+		r.printf("  [%s]\t%d responses\n", v, num)
+	}
+	r.printf("\nCipher suite distribution:\n")
+	for c, num := range r.cipherSuiteDist {
+		r.printf("  [%s]\t%d responses\n", c, num)
+	}
+	r.printf("\nALPN protocol distribution:\n")
+	for p, num := range r.alpnDist {
+		r.printf("  [%s]\t%d responses\n", p, num)
+	}
+	r.printf("\nServer name (SNI) distribution:\n")
+	for n, num := range r.serverNameDist {
+		r.printf("  [%s]\t%d responses\n", n, num)
+	}
+}
+
+// tlsVersionName returns the name of a TLS version.
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04X", v)
+}
+
+// printEvents prints the server-sent events received.
+func (r *report) printEvents() {
+	r.printf("\nServer-sent events:\n")
+	r.printf("  Events:\t%d\n", r.numEvents)
+	r.printf("  Events/sec:\t%4.4f\n", float64(r.numEvents)/r.total.Seconds())
+	r.printf("  Streams without events:\t%d\n", len(r.lats)-len(r.firstEventLats))
+	if len(r.firstEventLats) > 0 {
+		sort.Float64s(r.firstEventLats)
+		r.printDistribution("Time to first event", r.firstEventLats)
+	}
+	if len(r.eventGaps) > 0 {
+		sort.Float64s(r.eventGaps)
+		r.printDistribution("Event gap", r.eventGaps)
+		r.printf("\n  Longest gap:\t%4.4f secs", r.eventGaps[len(r.eventGaps)-1])
+	}
+	r.printf("\n")
+}
+
+// printWebSocket prints the outcome of WebSocket connections.
+func (r *report) printWebSocket() {
+	established := r.numRes - r.wsFailed
+	r.printf("\nWebSocket connections:\n")
+	r.printf("  Established:\t%d of %d (%4.1f%%)\n", established, r.numRes, 100*float64(established)/float64(r.numRes))
+	r.printf("  Handshake failures:\t%d\n", r.wsFailed)
+	r.printf("  Dropped:\t%d\n", r.wsDropped)
+	if len(r.wsRoundTrips) > 0 {
+		sort.Float64s(r.wsRoundTrips)
+		r.printf("  Messages:\t%d round trips", len(r.wsRoundTrips))
+		r.printDistribution("Message round trip", r.wsRoundTrips)
+		r.printf("\n")
+	}
+}
+
+// printConcurrency prints the concurrency trajectory of an adaptive run.
+func (r *report) printConcurrency() {
+	r.printf("\nConcurrency (adaptive):\n")
+	for _, s := range r.concurrency {
+		r.printf("  %4.4f secs\t%d workers\n", s.offset.Seconds(), s.c)
+	}
+}
+
 func (r *report) printErrors() {
 	r.printf("\nError distribution:\n")
 	for err, num := range r.errorDist {
 		r.printf("  [%d]\t%s\n", num, err)
 	}
+	if r.errorDist[portExhaustion] > 0 {
+		r.printf("\nThe client ran out of local ports, these are not server errors.\n")
+		r.printf("Keep connections alive, lower the concurrency, dial from more local\n")
+		r.printf("addresses or widen the ephemeral port range of the host.\n")
+	}
 }
 
 func (r *report) printf(s string, v ...interface{}) {
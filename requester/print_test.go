@@ -0,0 +1,159 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// heavyTail returns n sorted latencies, in seconds, from a Pareto
+// distribution starting at 1ms.
+func heavyTail(n int) []float64 {
+	lats := make([]float64, n)
+	for i := range lats {
+		// Quantiles of the distribution, in order.
+		q := float64(i) / float64(n)
+		lats[i] = 0.001 / math.Pow(1-q, 1/1.2)
+	}
+	return lats
+}
+
+func histogramCounts(r *report) []int {
+	buckets := r.histogramBuckets()
+	counts := make([]int, len(buckets))
+	bi := 0
+	for _, l := range r.lats {
+		for l > buckets[bi] {
+			bi++
+		}
+		counts[bi]++
+	}
+	return counts
+}
+
+func TestLogBuckets(t *testing.T) {
+	r := &report{lats: heavyTail(1000)}
+	r.fastest, r.slowest = r.lats[0], r.lats[len(r.lats)-1]
+	used := func(counts []int) int {
+		n := 0
+		for _, c := range counts {
+			if c > 0 {
+				n++
+			}
+		}
+		return n
+	}
+	r.linearBuckets = true
+	linear := histogramCounts(r)
+	if linear[1] < 950 {
+		t.Errorf("Expected linear buckets to lump the head together, found %v", linear)
+	}
+	r.linearBuckets = false
+	buckets := r.histogramBuckets()
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			t.Fatalf("Expected increasing buckets, found %v", buckets)
+		}
+	}
+	if buckets[len(buckets)-1] != r.slowest {
+		t.Errorf("Expected the last bucket at the slowest latency, found %v", buckets)
+	}
+	if logarithmic := histogramCounts(r); used(logarithmic) < 9 {
+		t.Errorf("Expected logarithmic buckets to spread the latencies, found %v", logarithmic)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	r := &report{lats: []float64{0.001, 0.002, 0.02, 0.03, 0.5}, histBuckets: []float64{0.005, 0.05}}
+	r.fastest, r.slowest = 0.001, 0.5
+	buckets := r.histogramBuckets()
+	if len(buckets) != 3 || buckets[2] != 0.5 {
+		t.Errorf("Expected a last bucket up to the slowest latency, found %v", buckets)
+	}
+	if counts := histogramCounts(r); counts[0] != 2 || counts[1] != 2 || counts[2] != 1 {
+		t.Errorf("Expected 2, 2 and 1 latencies in the buckets, found %v", counts)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:          req,
+		N:                10,
+		C:                1,
+		HistogramBuckets: []time.Duration{time.Minute, time.Hour},
+		Writer:           &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "60.0000 [10]") {
+		t.Errorf("Expected all responses in the first bucket, found %v", out.String())
+	}
+}
+
+// benchmarkRecord records a million results in a report of n requests.
+func benchmarkRecord(b *testing.B, n int) {
+	res := &Result{StatusCode: 200, Duration: time.Millisecond, ConnDuration: time.Microsecond}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r := newReport(ioutil.Discard, nil, n)
+		for j := 0; j < 1000000; j++ {
+			r.record(res)
+		}
+	}
+}
+
+func BenchmarkRecordKnownN(b *testing.B)   { benchmarkRecord(b, 1000000) }
+func BenchmarkRecordDuration(b *testing.B) { benchmarkRecord(b, math.MaxInt32) }
+
+// exhaustedTransport fails every request as if no local port were left.
+type exhaustedTransport struct{}
+
+func (exhaustedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.EADDRNOTAVAIL)}
+}
+
+func TestPortExhaustion(t *testing.T) {
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", "http://127.0.0.1", nil)
+	w := &Work{
+		Request:   req,
+		N:         3,
+		C:         1,
+		Writer:    &out,
+		Transport: exhaustedTransport{},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.report.errorDist[portExhaustion]; got != 3 {
+		t.Errorf("Expected 3 local port exhaustion errors, found %v", w.report.errorDist)
+	}
+	if !strings.Contains(out.String(), "ran out of local ports") {
+		t.Errorf("Expected guidance in the output, found %v", out.String())
+	}
+}
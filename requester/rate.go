@@ -0,0 +1,122 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RatePoint is a point of a rate schedule: the request rate, in requests
+// per second, at an offset from the start of the run.
+type RatePoint struct {
+	Offset time.Duration
+	QPS    float64
+}
+
+// LoadRateSchedule reads a rate schedule from a file of "offset,qps"
+// lines, such as "90s,250". Offsets are durations or a number of
+// seconds. Blank lines and lines starting with '#' are ignored.
+func LoadRateSchedule(path string) ([]RatePoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var points []RatePoint
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseRatePoint(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		points = append(points, p)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := validateRateSchedule(points); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return points, nil
+}
+
+func parseRatePoint(line string) (RatePoint, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) != 2 {
+		return RatePoint{}, fmt.Errorf("expected offset,qps in %q", line)
+	}
+	offset, err := time.ParseDuration(strings.TrimSpace(fields[0]))
+	if err != nil {
+		secs, serr := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+		if serr != nil {
+			return RatePoint{}, fmt.Errorf("invalid offset %q", fields[0])
+		}
+		offset = time.Duration(secs * float64(time.Second))
+	}
+	qps, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil {
+		return RatePoint{}, fmt.Errorf("invalid qps %q", fields[1])
+	}
+	return RatePoint{Offset: offset, QPS: qps}, nil
+}
+
+// validateRateSchedule checks that offsets are not negative and do not
+// decrease, and that rates are not negative with at least one positive.
+func validateRateSchedule(points []RatePoint) error {
+	positive := false
+	for i, p := range points {
+		if p.Offset < 0 || p.QPS < 0 {
+			return errors.New("rate schedule offsets and rates cannot be negative")
+		}
+		if i > 0 && p.Offset < points[i-1].Offset {
+			return errors.New("rate schedule offsets must be in increasing order")
+		}
+		positive = positive || p.QPS > 0
+	}
+	if !positive {
+		return errors.New("rate schedule has no positive rate")
+	}
+	return nil
+}
+
+// rateAt returns the rate of the schedule at offset, interpolated
+// linearly between points. The first rate holds before the first point,
+// and the last one after the last point. Two points at the same offset
+// make a step.
+func rateAt(points []RatePoint, offset time.Duration) float64 {
+	i := 0
+	for i < len(points) && points[i].Offset <= offset {
+		i++
+	}
+	if i == 0 {
+		return points[0].QPS
+	}
+	if i == len(points) {
+		return points[i-1].QPS
+	}
+	prev, next := points[i-1], points[i]
+	frac := float64(offset-prev.Offset) / float64(next.Offset-prev.Offset)
+	return prev.QPS + frac*(next.QPS-prev.QPS)
+}
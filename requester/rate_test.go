@@ -0,0 +1,108 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateAt(t *testing.T) {
+	points := []RatePoint{
+		{0, 10},
+		{time.Second, 20},
+		{time.Second, 40},
+		{3 * time.Second, 0},
+	}
+	tests := []struct {
+		offset time.Duration
+		want   float64
+	}{
+		{0, 10},
+		{500 * time.Millisecond, 15},
+		{time.Second, 40},
+		{2 * time.Second, 20},
+		{5 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		if got := rateAt(points, tt.offset); got != tt.want {
+			t.Errorf("%v: expected %v, found %v", tt.offset, tt.want, got)
+		}
+	}
+}
+
+func TestLoadRateSchedule(t *testing.T) {
+	path := writeTempFile(t, "# morning ramp\n0,10\n\n1m30s, 250\n120,0\n")
+	points, err := LoadRateSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RatePoint{{0, 10}, {90 * time.Second, 250}, {120 * time.Second, 0}}
+	if len(points) != len(want) {
+		t.Fatalf("Expected %v, found %v", want, points)
+	}
+	for i := range want {
+		if points[i] != want[i] {
+			t.Errorf("Expected %v, found %v", want[i], points[i])
+		}
+	}
+	for _, content := range []string{"10\n", "x,10\n", "0,x\n", "2s,1\n1s,1\n", "0,0\n"} {
+		if _, err := LoadRateSchedule(writeTempFile(t, content)); err == nil {
+			t.Errorf("%q: expected an error, found none", content)
+		}
+	}
+}
+
+func TestRateSchedule(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// 100 requests per second for 300ms, then 400 until the run ends.
+	rep := &recordingReporter{}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       150,
+		C:       4,
+		RateSchedule: []RatePoint{
+			{0, 100},
+			{300 * time.Millisecond, 100},
+			{300 * time.Millisecond, 400},
+		},
+		Reporter: rep,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.results) != 150 {
+		t.Fatalf("Expected 150 results, found %v", len(rep.results))
+	}
+	var slow, fast int
+	for _, res := range rep.results {
+		if res.Start.Sub(w.start) < 300*time.Millisecond {
+			slow++
+		} else if res.Start.Sub(w.start) < 600*time.Millisecond {
+			fast++
+		}
+	}
+	if slow < 25 || slow > 35 {
+		t.Errorf("Expected about 30 requests in the first 300ms, found %v", slow)
+	}
+	if fast < 105 {
+		t.Errorf("Expected about 120 requests in the next 300ms, found %v", fast)
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+)
+
+// rawClient makes the requests of RawMode: it writes the same request,
+// serialized once, to kept-alive connections, and reads only the status
+// and the framing of the responses.
+type rawClient struct {
+	addr    string
+	tls     *tls.Config // nil for http URLs
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	req     []byte // the serialized request
+	batch   []byte // PipelineDepth copies of req
+	head    bool   // whether responses have no body
+	close   bool   // whether to close connections after each request
+	timeout time.Duration
+	idle    chan *rawConn
+}
+
+// rawConn is a connection of a rawClient.
+type rawConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// errRawResponse is the error of a response RawMode cannot parse.
+var errRawResponse = errors.New("malformed HTTP response")
+
+// newRawClient serializes the request and returns the client of
+// RawMode.
+func (b *Work) newRawClient() (*rawClient, error) {
+	req, err := b.newRequest(nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", b.userAgent())
+	}
+	req.Close = b.DisableKeepAlives
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		return nil, fmt.Errorf("requester: %v", err)
+	}
+	c := &rawClient{
+		addr:    hostPort(req.URL),
+		dial:    b.dialContext(),
+		req:     buf.Bytes(),
+		head:    req.Method == "HEAD",
+		close:   b.DisableKeepAlives,
+		timeout: time.Duration(b.Timeout) * time.Second,
+		idle:    make(chan *rawConn, b.C),
+	}
+	if b.PipelineDepth > 1 {
+		c.batch = bytes.Repeat(c.req, b.PipelineDepth)
+	}
+	if req.URL.Scheme == "https" {
+		c.tls = b.tlsConfig()
+		c.tls.NextProtos = []string{"http/1.1"}
+		if c.tls.ServerName == "" {
+			c.tls.ServerName = req.URL.Hostname()
+		}
+	}
+	return c, nil
+}
+
+// do makes a request, on an idle connection if there is one, and
+// returns the status and body size of the response.
+func (c *rawClient) do(ctx context.Context) (code int, size int64, reused bool, err error) {
+	conn, reused, err := c.get(ctx)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	keep := false
+	defer func() { c.put(conn, keep) }()
+	if _, err = conn.Write(c.req); err != nil {
+		return 0, 0, reused, err
+	}
+	code, size, keep, err = c.readResponse(conn.r)
+	return code, size, reused, err
+}
+
+// get returns an idle connection, or a new one, with the deadline of a
+// request.
+func (c *rawClient) get(ctx context.Context) (conn *rawConn, reused bool, err error) {
+	select {
+	case conn = <-c.idle:
+		reused = true
+	default:
+		if conn, err = c.connect(ctx); err != nil {
+			return nil, false, err
+		}
+	}
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return conn, reused, nil
+}
+
+// put makes conn idle if keep is set and there is room, and closes it
+// otherwise.
+func (c *rawClient) put(conn *rawConn, keep bool) {
+	if keep && !c.close {
+		select {
+		case c.idle <- conn:
+			return
+		default:
+		}
+	}
+	conn.Close()
+}
+
+func (c *rawClient) connect(ctx context.Context) (*rawConn, error) {
+	conn, err := c.dial(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.tls != nil {
+		tc := tls.Client(conn, c.tls)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	return &rawConn{Conn: conn, r: bufio.NewReaderSize(conn, 16<<10)}, nil
+}
+
+// readResponse reads a response, skipping interim 1xx ones, and returns
+// its status, its body size and whether the connection can be reused.
+func (c *rawClient) readResponse(r *bufio.Reader) (code int, size int64, keep bool, err error) {
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return 0, 0, false, err
+		}
+		// "HTTP/1.1 200 OK\r\n"
+		if len(line) < 12 || !bytes.HasPrefix(line, []byte("HTTP/1.")) {
+			return 0, 0, false, errRawResponse
+		}
+		if code, err = strconv.Atoi(string(line[9:12])); err != nil {
+			return 0, 0, false, errRawResponse
+		}
+		keep = line[7] == '1'
+		length, chunked := int64(-1), false
+		for {
+			line, err := r.ReadSlice('\n')
+			if err != nil {
+				return code, 0, false, err
+			}
+			if len(line) <= 2 {
+				break
+			}
+			name, value := headerLine(line)
+			switch {
+			case asciiEqualFold(name, "Content-Length"):
+				if length, err = strconv.ParseInt(string(value), 10, 64); err != nil || length < 0 {
+					return code, 0, false, errRawResponse
+				}
+			case asciiEqualFold(name, "Transfer-Encoding"):
+				chunked = asciiEqualFold(value, "chunked")
+			case asciiEqualFold(name, "Connection"):
+				if asciiEqualFold(value, "close") {
+					keep = false
+				} else if asciiEqualFold(value, "keep-alive") {
+					keep = true
+				}
+			}
+		}
+		if code >= 100 && code < 200 && code != 101 {
+			continue
+		}
+		switch {
+		case c.head || code == 204 || code == 304 || code == 101:
+			return code, 0, keep && code != 101, nil
+		case chunked:
+			size, err = discardChunked(r)
+		case length >= 0:
+			var n int
+			n, err = r.Discard(int(length))
+			size = int64(n)
+		default:
+			// The body lasts until the server closes the connection.
+			size, err = io.Copy(ioutil.Discard, r)
+			keep = false
+		}
+		if err != nil {
+			return code, size, false, &bodyError{err: err, timeout: isTimeout(err)}
+		}
+		return code, size, keep, nil
+	}
+}
+
+// discardChunked reads a chunked body and its trailers, and returns the
+// size of the body.
+func discardChunked(r *bufio.Reader) (int64, error) {
+	var size int64
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return size, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if i := bytes.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		n, err := strconv.ParseInt(string(bytes.TrimSpace(line)), 16, 64)
+		if err != nil || n < 0 {
+			return size, errRawResponse
+		}
+		if n == 0 {
+			break
+		}
+		d, err := r.Discard(int(n))
+		size += int64(d)
+		if err != nil {
+			return size, err
+		}
+		if _, err := r.Discard(2); err != nil {
+			return size, err
+		}
+	}
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return size, err
+		}
+		if len(line) <= 2 {
+			return size, nil
+		}
+	}
+}
+
+// headerLine splits a header line into its name and value.
+func headerLine(line []byte) (name, value []byte) {
+	i := bytes.IndexByte(line, ':')
+	if i < 0 {
+		return nil, nil
+	}
+	return line[:i], bytes.TrimSpace(line[i+1:])
+}
+
+func asciiEqualFold(b []byte, s string) bool {
+	return len(b) == len(s) && bytes.EqualFold(b, []byte(s))
+}
+
+// makeRawRequest makes a request of RawMode and sends its result to the
+// reporter.
+func (b *Work) makeRawRequest() {
+	s := time.Now()
+	code, size, reused, err := b.raw.do(b.ctx)
+	if err != nil && b.ctx.Err() != nil {
+		// The run was canceled, not the request failed.
+		b.canceled()
+		return
+	}
+	b.results <- b.rawResult(s, time.Now(), code, size, reused, err)
+}
+
+// rawResult returns the result of a request of RawMode.
+func (b *Work) rawResult(start, end time.Time, code int, size int64, reused bool, err error) *Result {
+	res := &Result{
+		URL:        b.Request.URL.String(),
+		Start:      start,
+		Duration:   end.Sub(start),
+		Err:        err,
+		ConnReused: reused,
+	}
+	if code != 0 {
+		res.StatusCode, res.BodySize, res.WireSize = code, size, size
+		if err == nil {
+			res.ContentLength = size
+		}
+	}
+	return res
+}
+
+// rawUnsupported returns the first option set that RawMode does not
+// support, or "". Keep the list in the RawMode doc in sync.
+func (b *Work) rawUnsupported() string {
+	for _, o := range []struct {
+		name string
+		set  bool
+	}{
+		{"H2", b.H2},
+		{"HTTP10", b.HTTP10},
+		{"ProxyAddr", b.ProxyAddr != nil},
+		{"Transport", b.Transport != nil},
+		{"PrewarmConns", b.PrewarmConns > 0},
+		{"URLFile", b.URLFile != ""},
+		{"HARFile", b.HARFile != ""},
+		{"BodyFunc", b.BodyFunc != nil},
+		{"Multipart", len(b.Multipart) > 0},
+		{"GRPCMethod", b.GRPCMethod != ""},
+		{"WebSocket", b.WebSocket != nil},
+		{"SSE", b.SSE},
+		{"HandshakeOnly", b.HandshakeOnly},
+		{"CacheBust", b.CacheBust},
+		{"Revalidate", b.Revalidate},
+		{"DigestAuthUser", b.DigestAuthUser != ""},
+		{"NTLMAuth", b.NTLMAuth != nil},
+		{"OAuth2", b.OAuth2 != nil},
+		{"ChunkSize", b.ChunkSize > 0},
+		{"ForceChunked", b.ForceChunked},
+		{"CompressRequestBody", b.CompressRequestBody},
+		{"Expect100Continue", b.Expect100Continue},
+		{"DeadlineHeader", b.DeadlineHeader != ""},
+		{"MaxConnDuration", b.MaxConnDuration > 0},
+		{"MaxBodyBytes", b.MaxBodyBytes > 0},
+		{"OutputErrorsOnly", b.OutputErrorsOnly},
+		{"SlowThreshold", b.SlowThreshold > 0},
+		{"AbortOnResponse", b.AbortOnResponse != nil},
+		{"ExtractMetric", b.ExtractMetric != nil},
+		{"RequestIDHeader", b.RequestIDHeader != ""},
+		{"DumpSequenceFile", b.DumpSequenceFile != ""},
+	} {
+		if o.set {
+			return o.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRawMode(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	rr := &recordingReporter{}
+	w := &Work{Request: req, RequestBody: []byte("payload"), N: 20, C: 2, RawMode: true, Reporter: rr}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rr.results) != 20 {
+		t.Fatalf("Expected 20 results, found %v", len(rr.results))
+	}
+	reused := 0
+	for _, res := range rr.results {
+		if res.Err != nil {
+			t.Fatalf("Expected no error, found %v", res.Err)
+		}
+		if res.StatusCode != http.StatusCreated || res.BodySize != 5 {
+			t.Errorf("Expected a 201 with a 5 byte body, found %v with %v bytes", res.StatusCode, res.BodySize)
+		}
+		if res.ConnReused {
+			reused++
+		}
+	}
+	if reused < 18 {
+		t.Errorf("Expected at least 18 requests on reused connections, found %v", reused)
+	}
+	for i, body := range bodies {
+		if string(body) != "payload" {
+			t.Errorf("Expected the server to receive payload, found %q", body)
+		}
+		if agents[i] == "" {
+			t.Errorf("Expected a User-Agent header")
+		}
+	}
+}
+
+func TestRawModeChunked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			w.Write(bytes.Repeat([]byte("x"), 1000))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	rr := &recordingReporter{}
+	w := &Work{Request: req, N: 10, C: 1, RawMode: true, Reporter: rr}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range rr.results {
+		if res.Err != nil || res.BodySize != 3000 {
+			t.Fatalf("Expected a 3000 byte body, found %v bytes and error %v", res.BodySize, res.Err)
+		}
+		if i > 0 && !res.ConnReused {
+			t.Errorf("Expected the connection to be reused after a chunked response")
+		}
+	}
+}
+
+func TestRawModeConnectionClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var mu sync.Mutex
+	conns := 0
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns++
+			mu.Unlock()
+			go func() {
+				defer c.Close()
+				c.Read(make([]byte, 4096))
+				// A response without framing lasts until the connection is closed.
+				fmt.Fprint(c, "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nbody")
+			}()
+		}
+	}()
+
+	req, _ := http.NewRequest("GET", "http://"+ln.Addr().String(), nil)
+	rr := &recordingReporter{}
+	w := &Work{Request: req, N: 5, C: 1, RawMode: true, Reporter: rr}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range rr.results {
+		if res.Err != nil || res.StatusCode != 200 || res.BodySize != 4 || res.ConnReused {
+			t.Errorf("Expected a 4 byte body on a new connection, found %+v", res)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 5 {
+		t.Errorf("Expected 5 connections, found %v", conns)
+	}
+}
+
+func TestRawModeHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("HEAD", server.URL, nil)
+	rr := &recordingReporter{}
+	w := &Work{Request: req, N: 4, C: 2, RawMode: true, Reporter: rr}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range rr.results {
+		if res.Err != nil || res.StatusCode != 200 || res.BodySize != 0 {
+			t.Errorf("Expected an empty 200 response, found %v bytes, status %v and error %v", res.BodySize, res.StatusCode, res.Err)
+		}
+	}
+}
+
+func benchmarkRawMode(b *testing.B, raw bool) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	w := &Work{Request: req, N: b.N, C: 1, RawMode: raw, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkRawMode(b *testing.B)        { benchmarkRawMode(b, true) }
+func BenchmarkStandardClient(b *testing.B) { benchmarkRawMode(b, false) }
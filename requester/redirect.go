@@ -0,0 +1,63 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// errDowngradeRedirect is the error of requests redirected from https to
+// http with NoDowngradeRedirects.
+var errDowngradeRedirect = errors.New("requester: redirect from https to http")
+
+// maxRedirects is the number of redirects followed, as by default.
+const maxRedirects = 10
+
+// checkRedirect counts the redirects of req that leave the origin of the
+// request or downgrade it from https to http, and applies
+// NoDowngradeRedirects and StripCrossOriginAuth to them.
+func (b *Work) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme == "http" {
+		atomic.AddInt64(&b.downgrades, 1)
+		if b.NoDowngradeRedirects {
+			return errDowngradeRedirect
+		}
+	}
+	// The client copies the headers of the first request to every
+	// redirect, so the origin is that of the first.
+	if origin(req.URL) != origin(via[0].URL) {
+		atomic.AddInt64(&b.crossOrigin, 1)
+		if b.StripCrossOriginAuth {
+			req.Header.Del("Authorization")
+		}
+	}
+	return nil
+}
+
+// origin returns the scheme, host and port of u, its origin as browsers
+// tell apart.
+func origin(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	return u.Scheme + "://" + u.Hostname() + ":" + port
+}
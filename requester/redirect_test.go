@@ -0,0 +1,94 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRedirects(t *testing.T) {
+	var withAuth, withoutAuth int64
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			atomic.AddInt64(&withAuth, 1)
+		} else {
+			atomic.AddInt64(&withoutAuth, 1)
+		}
+	}))
+	defer plain.Close()
+	// Redirects to the plain server, the same host on another port and
+	// scheme, which the client still sends the Authorization to.
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL+"/landing", http.StatusFound)
+	}))
+	defer secure.Close()
+
+	req, _ := http.NewRequest("GET", secure.URL, nil)
+	req.SetBasicAuth("user", "secret")
+	var out bytes.Buffer
+	w := &Work{Request: req, N: 10, C: 1, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if withAuth != 10 || w.report.crossOrigin != 10 || w.report.downgrades != 10 {
+		t.Errorf("Expected 10 downgrades across origins keeping the Authorization, found %v, %v and %v", withAuth, w.report.crossOrigin, w.report.downgrades)
+	}
+	if !strings.Contains(out.String(), "Redirects:\t10 cross-origin, 10 from https to http") {
+		t.Errorf("Expected the redirects in the summary, found %q", out.String())
+	}
+
+	withAuth = 0
+	w = &Work{Request: req, N: 10, C: 1, Writer: ioutil.Discard, StripCrossOriginAuth: true}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if withAuth != 0 || withoutAuth != 10 {
+		t.Errorf("Expected the Authorization stripped, found it in %v requests", withAuth)
+	}
+
+	withoutAuth = 0
+	w = &Work{Request: req, N: 10, C: 1, Writer: ioutil.Discard, NoDowngradeRedirects: true}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if withoutAuth+withAuth != 0 || w.report.errorDist[errDowngradeRedirect.Error()] != 10 {
+		t.Errorf("Expected 10 downgrades to fail, found %v", w.report.errorDist)
+	}
+}
+
+func TestRedirectsSameOrigin(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, server.URL+"/landing", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 10, C: 1, Writer: ioutil.Discard, NoDowngradeRedirects: true}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.report.crossOrigin != 0 || w.report.downgrades != 0 || w.report.statusCodeDist[http.StatusOK] != 10 {
+		t.Errorf("Expected 10 redirects within the origin, found %v, %v and %v", w.report.crossOrigin, w.report.downgrades, w.report.statusCodeDist)
+	}
+}
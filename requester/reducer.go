@@ -0,0 +1,39 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+// reduce folds res into the accumulator of the Reducer. Only the
+// reporter goroutine writes acc, so it reads it without the lock.
+func (r *report) reduce(res *Result) {
+	acc := r.reducer(r.acc, *res)
+	r.mu.Lock()
+	r.acc = acc
+	r.mu.Unlock()
+}
+
+// ReducerResult returns the accumulator of the Reducer: the final one
+// once Run has returned, or the one so far while it runs. It returns nil
+// before Run or without a Reducer.
+func (b *Work) ReducerResult() interface{} {
+	b.mu.Lock()
+	r := b.report
+	b.mu.Unlock()
+	if r == nil || r.reducer == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.acc
+}
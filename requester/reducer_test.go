@@ -0,0 +1,67 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReducer(t *testing.T) {
+	var n int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&n, 1)%4 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	type tally struct {
+		requests, unavailable int
+		bytes                 int64
+	}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       100,
+		C:       4,
+		Writer:  ioutil.Discard,
+		Reducer: func(acc interface{}, res Result) interface{} {
+			// Calls are serial, so the accumulator is changed in place.
+			t := acc.(*tally)
+			t.requests++
+			if res.StatusCode == http.StatusServiceUnavailable {
+				t.unavailable++
+			}
+			t.bytes += res.BodySize
+			return t
+		},
+		ReducerInit: &tally{},
+	}
+	if w.ReducerResult() != nil {
+		t.Error("Expected no result before Run")
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	got := w.ReducerResult().(*tally)
+	if got.requests != 100 || got.unavailable != 25 || got.bytes != 400 {
+		t.Errorf("Expected 100 requests, 25 unavailable and 400 bytes, found %+v", got)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"sort"
+	"time"
+)
+
+// replayTolerance is how far behind schedule a replayed request may be
+// sent and still count as on schedule.
+const replayTolerance = 10 * time.Millisecond
+
+// dispatchReplay sends the N requests of a PreserveTiming run to
+// schedule, each with its target, as long after the previous one as
+// recorded, scaled by TimeScale, and closes it when done or stopped.
+// Start times follow from the start of the run, so they do not drift when
+// workers fall behind.
+func (b *Work) dispatchReplay(schedule chan<- scheduled) {
+	defer close(schedule)
+	scale := b.TimeScale
+	if scale == 0 {
+		scale = 1
+	}
+	at := b.start
+	for i := 0; i < b.N; i++ {
+		t, err := b.targets.next()
+		if err != nil {
+			b.results <- &Result{Err: err, Start: time.Now()}
+			continue
+		}
+		at = at.Add(time.Duration(float64(t.wait) * scale))
+		if d := at.Sub(time.Now()); d > 0 {
+			select {
+			case <-b.stopCh:
+				return
+			case <-time.After(d):
+			}
+		}
+		select {
+		case <-b.stopCh:
+			return
+		case schedule <- scheduled{at: at, target: t}:
+		}
+	}
+}
+
+// printReplay prints how far behind the recorded schedule the requests
+// of a PreserveTiming run were sent.
+func (r *report) printReplay() {
+	lags := r.scheduleLags
+	sort.Float64s(lags)
+	var sum float64
+	for _, l := range lags {
+		sum += l
+	}
+	onTime := sort.SearchFloat64s(lags, replayTolerance.Seconds())
+	r.printf("\nReplay schedule:\n")
+	r.printf("  On schedule:\t%4.1f%% of requests within %v\n", 100*float64(onTime)/float64(len(lags)), replayTolerance)
+	r.printf("  Average lag:\t%4.4f secs\n", sum/float64(len(lags)))
+	r.printf("  Slowest lag:\t%4.4f secs\n", lags[len(lags)-1])
+}
@@ -0,0 +1,142 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPreserveTiming(t *testing.T) {
+	var mu sync.Mutex
+	arrived := make(map[string]time.Time)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrived[r.URL.Path] = time.Now()
+		mu.Unlock()
+		// Slower than the schedule, which must not hold it back.
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	path := writeTempFile(t, fmt.Sprintf("@0s %[1]s/a\n@200ms %[1]s/b\n# comment\n@600ms POST %[1]s/c body\n", server.URL))
+	defer os.Remove(path)
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:        req,
+		N:              3,
+		C:              3,
+		URLFile:        path,
+		PreserveTiming: true,
+		TimeScale:      0.5,
+		Writer:         &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]time.Duration{"/b": 100 * time.Millisecond, "/c": 300 * time.Millisecond} {
+		got := arrived[path].Sub(arrived["/a"])
+		if got < want-10*time.Millisecond || got > want+50*time.Millisecond {
+			t.Errorf("Expected %s %v after /a, found %v", path, want, got)
+		}
+	}
+	if !strings.Contains(out.String(), "Replay schedule:") {
+		t.Errorf("Expected the replay schedule in the output, found %v", out.String())
+	}
+}
+
+func TestURLFileOffsets(t *testing.T) {
+	path := writeTempFile(t, "@1s http://a.com/1\nhttp://a.com/2\n@1.5s http://a.com/3\n@1s http://a.com/4\n")
+	defer os.Remove(path)
+	s, err := newTargetSource(path, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	for _, want := range []time.Duration{time.Second, 0, 500 * time.Millisecond, 0} {
+		tg, err := s.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tg.wait != want {
+			t.Errorf("%v: expected a wait of %v, found %v", tg.url, want, tg.wait)
+		}
+	}
+
+	for _, content := range []string{"@x http://a.com/\n", "@-1s http://a.com/\n", "@1s\n"} {
+		path := writeTempFile(t, content)
+		defer os.Remove(path)
+		if _, err := newTargetSource(path, false, 0); err == nil {
+			t.Errorf("%q: expected an error, found none", content)
+		}
+	}
+}
+
+func TestReplayFactor(t *testing.T) {
+	var mu sync.Mutex
+	arrived := make(map[string][]time.Time)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrived[r.URL.Path] = append(arrived[r.URL.Path], time.Now())
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	path := writeTempFile(t, fmt.Sprintf("@0s %[1]s/a\n@100ms %[1]s/b\n", server.URL))
+	defer os.Remove(path)
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:        req,
+		N:              6,
+		C:              3,
+		URLFile:        path,
+		PreserveTiming: true,
+		ReplayFactor:   3,
+		Writer:         &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	// Each target is made three times, the copies right along with it.
+	for _, p := range []string{"/a", "/b"} {
+		if len(arrived[p]) != 3 {
+			t.Fatalf("Expected 3 requests to %s, found %v", p, len(arrived[p]))
+		}
+		for _, at := range arrived[p] {
+			if d := at.Sub(arrived[p][0]); d < -20*time.Millisecond || d > 20*time.Millisecond {
+				t.Errorf("Expected the copies of %s together, found one %v apart", p, d)
+			}
+		}
+	}
+	if d := arrived["/b"][0].Sub(arrived["/a"][0]); d < 90*time.Millisecond {
+		t.Errorf("Expected /b 100ms after /a, found %v", d)
+	}
+	for _, want := range []string{"Replayed:\t2 targets, 3 times each", "[200]\t6 responses"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, found %v", want, out.String())
+		}
+	}
+}
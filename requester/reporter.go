@@ -0,0 +1,301 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// DefaultSummaryTemplate is a summary template, for Work.SummaryTemplate,
+// in the format of the text output.
+const DefaultSummaryTemplate = `Summary:
+  Total:	{{printf "%4.4f" .Elapsed.Seconds}} secs
+  Slowest:	{{printf "%4.4f" .Slowest.Seconds}} secs
+  Fastest:	{{printf "%4.4f" .Fastest.Seconds}} secs
+  Average:	{{printf "%4.4f" .Average.Seconds}} secs
+  Requests/sec:	{{printf "%4.4f" .RPS}}
+{{if .Latencies}}
+Latency distribution:
+{{range $p, $l := .Latencies}}  {{$p}}% in {{printf "%4.4f" $l.Seconds}} secs
+{{end}}{{end}}
+Status code distribution:
+{{range $code, $n := .StatusCodes}}  [{{$code}}]	{{$n}} responses
+{{end}}{{if .Errors}}
+Errors:	{{.Errors}} requests
+{{end}}`
+
+// Reporter receives the results of a run and writes its output.
+type Reporter interface {
+	// Record is called with each result as it completes. Calls are made
+	// from a single goroutine.
+	Record(res Result)
+
+	// Finalize is called once all results are recorded, with the total
+	// duration of the run.
+	Finalize(total time.Duration)
+}
+
+// newReporter returns the built-in reporter for the output type.
+func newReporter(r *report, output string) Reporter {
+	switch output {
+	case "csv":
+		return &csvReporter{w: r.rowWriter}
+	case "json":
+		return &jsonReporter{r: r}
+	}
+	return &textReporter{r: r}
+}
+
+// textReporter prints the summary, histogram and distributions of the
+// run once it is finished.
+type textReporter struct {
+	r *report
+}
+
+func (t *textReporter) Record(res Result) {}
+
+func (t *textReporter) Finalize(total time.Duration) {
+	t.r.print()
+}
+
+// parseSummaryTemplate parses a summary template and checks that it can
+// be executed. It returns nil for an empty template.
+func parseSummaryTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("summary").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("requester: invalid summary template: %v", err)
+	}
+	if err := tmpl.Execute(ioutil.Discard, RunStats{}); err != nil {
+		return nil, fmt.Errorf("requester: invalid summary template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// templateReporter writes the summary of the run with a template once it
+// is finished.
+type templateReporter struct {
+	r    *report
+	tmpl *template.Template
+}
+
+func (t *templateReporter) Record(res Result) {}
+
+func (t *templateReporter) Finalize(total time.Duration) {
+	if err := t.tmpl.Execute(t.r.w, t.r.snapshot()); err != nil {
+		fmt.Fprintf(t.r.w, "summary template: %v\n", err)
+	}
+}
+
+// csvReporter writes a row for each successful request as it completes.
+type csvReporter struct {
+	w       io.Writer
+	started bool
+}
+
+func (c *csvReporter) header() {
+	if !c.started {
+		fmt.Fprintf(c.w, "response-time,DNS+dialup,DNS,Request-write,Response-delay,Response-read\n")
+		c.started = true
+	}
+}
+
+func (c *csvReporter) Record(res Result) {
+	if res.Err != nil {
+		return
+	}
+	c.header()
+	fmt.Fprintf(c.w, "%4.4f,%4.4f,%4.4f,%4.4f,%4.4f,%4.4f\n",
+		res.Duration.Seconds(), res.ConnDuration.Seconds(), res.DNSDuration.Seconds(),
+		res.ReqDuration.Seconds(), res.DelayDuration.Seconds(), res.ResDuration.Seconds())
+}
+
+func (c *csvReporter) Finalize(total time.Duration) {
+	c.header()
+}
+
+// JSONSchemaVersion is the version of JSONSummary. It is bumped whenever
+// a field is renamed, removed or changes meaning, but not when one is
+// added.
+const JSONSchemaVersion = 1
+
+// JSONSummary is the summary written with Output "json", and read back
+// by BaselineFile. Durations are in seconds. Its fields are stable within
+// a SchemaVersion.
+type JSONSummary struct {
+	// SchemaVersion is JSONSchemaVersion, or 0 for summaries written
+	// before it was introduced, which have the fields of version 1.
+	SchemaVersion int `json:"schema_version"`
+
+	Total       float64            `json:"total"`            // duration of the run
+	Requests    int64              `json:"requests"`         // requests made, including the failed ones
+	RPS         float64            `json:"rps"`              // requests per second
+	Average     float64            `json:"average"`          // average latency of the successful requests
+	Fastest     float64            `json:"fastest"`          // lowest latency
+	Slowest     float64            `json:"slowest"`          // highest latency
+	Latencies   map[string]float64 `json:"latencies"`        // latency by percentile, "p10" to "p99"
+	StatusCodes map[int]int        `json:"status_codes"`     // responses by status code
+	Errors      map[string]int     `json:"errors,omitempty"` // failed requests by error
+	Tags        map[string]string  `json:"tags,omitempty"`   // Work.Tags
+
+	// CircuitBroken is set if CircuitBreaker stopped the run early.
+	CircuitBroken bool `json:"circuit_broken,omitempty"`
+
+	// Aborted is set if AbortOnResponse stopped the run early.
+	Aborted bool `json:"aborted,omitempty"`
+
+	// ConsecutiveFailures is set if MaxConsecutiveFailures stopped the
+	// run early.
+	ConsecutiveFailures bool `json:"consecutive_failures,omitempty"`
+
+	// Apdex is the Apdex score of the run, with ApdexTarget.
+	Apdex float64 `json:"apdex,omitempty"`
+}
+
+// jsonReporter writes the summary of the run as a JSON object once it is
+// finished.
+type jsonReporter struct {
+	r *report
+}
+
+func (j *jsonReporter) Record(res Result) {}
+
+func (j *jsonReporter) Finalize(total time.Duration) {
+	s := j.r.snapshot()
+	sum := JSONSummary{
+		SchemaVersion: JSONSchemaVersion,
+		Total:         total.Seconds(),
+		Requests:      s.Requests,
+		RPS:           s.RPS,
+		Latencies:     make(map[string]float64, len(s.Latencies)),
+		StatusCodes:   s.StatusCodes,
+		Tags:          s.Tags,
+	}
+	if b := j.r.breaker; b != nil {
+		sum.CircuitBroken = b.broken()
+	}
+	if f := j.r.failures; f != nil {
+		sum.ConsecutiveFailures = f.stopped()
+	}
+	for _, p := range pctlsReported {
+		sum.Latencies[fmt.Sprintf("p%d", p)] = s.Latencies[p].Seconds()
+	}
+	r := j.r
+	r.mu.Lock()
+	sum.Aborted = r.abortedBy != nil
+	if r.apdexTarget > 0 {
+		sum.Apdex = r.apdex(r.apdexTarget).score()
+	}
+	if len(r.lats) > 0 {
+		sum.Average = r.average
+		sum.Fastest, sum.Slowest = r.lats[0], r.lats[0]
+		for _, l := range r.lats {
+			sum.Fastest = math.Min(sum.Fastest, l)
+			sum.Slowest = math.Max(sum.Slowest, l)
+		}
+	}
+	if len(r.errorDist) > 0 {
+		sum.Errors = make(map[string]int, len(r.errorDist))
+		for err, n := range r.errorDist {
+			sum.Errors[err] = n
+		}
+	}
+	r.mu.Unlock()
+	b, _ := json.MarshalIndent(sum, "", "  ")
+	fmt.Fprintf(r.w, "%s\n", b)
+}
+
+// errorRow is a row of the errors only output.
+type errorRow struct {
+	Start  time.Time `json:"start"`
+	URL    string    `json:"url"`
+	Status int       `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Body   string    `json:"body,omitempty"`
+	ID     string    `json:"request_id,omitempty"`
+
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// errorsReporter writes a row for each request that failed or got a 4xx
+// or 5xx response as it completes, in csv or as JSON lines.
+type errorsReporter struct {
+	w       io.Writer
+	json    bool
+	tags    map[string]string // added to the json rows
+	ids     bool              // whether to add the request IDs to the csv rows
+	csv     *csv.Writer
+	started bool
+}
+
+func (e *errorsReporter) Record(res Result) {
+	if res.Err == nil && res.StatusCode < 400 {
+		return
+	}
+	row := errorRow{
+		Start:  res.Start,
+		URL:    res.URL,
+		Status: res.StatusCode,
+		Body:   string(res.BodySnippet),
+		ID:     res.RequestID,
+		Tags:   e.tags,
+	}
+	if res.Err != nil {
+		row.Error = res.Err.Error()
+	}
+	if e.json {
+		b, _ := json.Marshal(row)
+		fmt.Fprintf(e.w, "%s\n", b)
+		return
+	}
+	e.header()
+	fields := []string{
+		row.Start.Format(time.RFC3339Nano), row.URL, strconv.Itoa(row.Status), row.Error, row.Body,
+	}
+	if e.ids {
+		fields = append(fields, row.ID)
+	}
+	e.csv.Write(fields)
+	e.csv.Flush()
+}
+
+func (e *errorsReporter) header() {
+	if !e.started {
+		e.csv = csv.NewWriter(e.w)
+		fields := []string{"start", "url", "status", "error", "body"}
+		if e.ids {
+			fields = append(fields, "request_id")
+		}
+		e.csv.Write(fields)
+		e.started = true
+	}
+}
+
+func (e *errorsReporter) Finalize(total time.Duration) {
+	if !e.json {
+		e.header()
+		e.csv.Flush()
+	}
+}
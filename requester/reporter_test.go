@@ -0,0 +1,331 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type recordingReporter struct {
+	results   []Result
+	finalized int
+	total     time.Duration
+}
+
+func (r *recordingReporter) Record(res Result) {
+	r.results = append(r.results, res)
+}
+
+func (r *recordingReporter) Finalize(total time.Duration) {
+	r.finalized++
+	r.total = total
+}
+
+func TestCustomReporter(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var out bytes.Buffer
+	rep := &recordingReporter{}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:  req,
+		N:        10,
+		C:        2,
+		Reporter: rep,
+		Writer:   &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.results) != 10 {
+		t.Errorf("Expected 10 results, found %v", len(rep.results))
+	}
+	for _, res := range rep.results {
+		if res.StatusCode != http.StatusAccepted || res.Err != nil {
+			t.Errorf("Unexpected result %+v", res)
+		}
+	}
+	if rep.finalized != 1 || rep.total <= 0 {
+		t.Errorf("Expected a single Finalize with the total, found %v calls with %v", rep.finalized, rep.total)
+	}
+	if out.Len() > 0 {
+		t.Errorf("Expected no output from the built-in reporter, found %q", out.String())
+	}
+	if s := w.Snapshot(); s.Requests != 10 {
+		t.Errorf("Expected stats for 10 requests, found %v", s.Requests)
+	}
+}
+
+func TestCSVReporter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 5, C: 1, Output: "csv", Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("Expected a header and 5 rows, found %q", out.String())
+	}
+	if !strings.HasPrefix(lines[0], "response-time,") {
+		t.Errorf("Expected the csv header, found %q", lines[0])
+	}
+	for _, l := range lines[1:] {
+		if n := len(strings.Split(l, ",")); n != 6 {
+			t.Errorf("Expected 6 columns, found %v in %q", n, l)
+		}
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 5, C: 1, Output: "json", Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var sum JSONSummary
+	if err := json.Unmarshal(out.Bytes(), &sum); err != nil {
+		t.Fatalf("Invalid JSON output %q: %v", out.String(), err)
+	}
+	if sum.SchemaVersion != JSONSchemaVersion {
+		t.Errorf("Expected schema version %v, found %v", JSONSchemaVersion, sum.SchemaVersion)
+	}
+	if sum.Requests != 5 || sum.StatusCodes[200] != 5 {
+		t.Errorf("Expected 5 OK requests, found %+v", sum)
+	}
+	if sum.Fastest <= 0 || sum.Fastest > sum.Slowest || sum.Latencies["p50"] <= 0 {
+		t.Errorf("Unexpected latencies in %+v", sum)
+	}
+}
+
+func TestTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	tags := map[string]string{"env": "staging", "build": "abc123"}
+
+	var rows, summary bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:        req,
+		N:              10,
+		C:              1,
+		Output:         "json",
+		Interval:       10 * time.Millisecond,
+		IntervalFormat: "json",
+		Tags:           tags,
+		ResultWriter:   &rows,
+		SummaryWriter:  &summary,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var sum JSONSummary
+	if err := json.Unmarshal(summary.Bytes(), &sum); err != nil {
+		t.Fatalf("Invalid JSON output %q: %v", summary.String(), err)
+	}
+	if !reflect.DeepEqual(sum.Tags, tags) {
+		t.Errorf("Expected tags %v in the summary, found %v", tags, sum.Tags)
+	}
+	for _, row := range intervalRows(t, rows.String()) {
+		if !reflect.DeepEqual(row.Tags, tags) {
+			t.Errorf("Expected tags %v in the interval rows, found %v", tags, row.Tags)
+		}
+	}
+	if s := w.Snapshot(); !reflect.DeepEqual(s.Tags, tags) {
+		t.Errorf("Expected tags %v in the run statistics, found %v", tags, s.Tags)
+	}
+
+	rows.Reset()
+	req, _ = http.NewRequest("GET", server.URL+"/missing", nil)
+	w = &Work{Request: req, N: 2, C: 1, Output: "json", OutputErrorsOnly: true, Tags: tags, Writer: &rows}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rows.String(), `"tags":{"build":"abc123","env":"staging"}`) {
+		t.Errorf("Expected tags in the error rows, found %v", rows.String())
+	}
+
+	// The text summary is unchanged.
+	summary.Reset()
+	w = &Work{Request: req, N: 2, C: 1, Tags: tags, Writer: &summary}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(summary.String(), "staging") {
+		t.Errorf("Expected no tags in the text summary, found %v", summary.String())
+	}
+}
+
+func TestSeparateWriters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	var out, rows, summary bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:       req,
+		N:             10,
+		C:             1,
+		Interval:      10 * time.Millisecond,
+		Writer:        &out,
+		ResultWriter:  &rows,
+		SummaryWriter: &summary,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("Expected nothing written to Writer, found %q", out.String())
+	}
+	if !strings.HasPrefix(rows.String(), "offset,") || strings.Contains(rows.String(), "Summary:") {
+		t.Errorf("Expected only interval rows, found %q", rows.String())
+	}
+	if !strings.Contains(summary.String(), "Summary:") || strings.Contains(summary.String(), "offset,") {
+		t.Errorf("Expected only the summary, found %q", summary.String())
+	}
+
+	// The csv rows go to ResultWriter too.
+	rows.Reset()
+	w = &Work{Request: req, N: 2, C: 1, Output: "csv", Writer: &out, ResultWriter: &rows}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() > 0 || !strings.HasPrefix(rows.String(), "response-time,") {
+		t.Errorf("Expected the csv output in ResultWriter, found %q and %q", out.String(), rows.String())
+	}
+}
+
+func TestErrorsReporter(t *testing.T) {
+	var count int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&count, 1)%3 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(strings.Repeat("boom", 100)))
+		}
+	}))
+	defer server.Close()
+
+	for _, output := range []string{"", "json"} {
+		count = 0
+		var out bytes.Buffer
+		req, _ := http.NewRequest("GET", server.URL+"/path", nil)
+		w := &Work{Request: req, N: 9, C: 1, Output: output, OutputErrorsOnly: true, Writer: &out}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		var rows []errorRow
+		if output == "json" {
+			for _, l := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				var row errorRow
+				if err := json.Unmarshal([]byte(l), &row); err != nil {
+					t.Fatalf("Invalid JSON line %q: %v", l, err)
+				}
+				rows = append(rows, row)
+			}
+		} else {
+			records, err := csv.NewReader(&out).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) == 0 || records[0][0] != "start" {
+				t.Fatalf("Expected the csv header, found %v", records)
+			}
+			for _, r := range records[1:] {
+				status, _ := strconv.Atoi(r[2])
+				rows = append(rows, errorRow{URL: r[1], Status: status, Error: r[3], Body: r[4]})
+			}
+		}
+		if len(rows) != 3 {
+			t.Fatalf("%q: expected 3 rows, found %+v", output, rows)
+		}
+		for _, row := range rows {
+			if row.URL != server.URL+"/path" || row.Status != 500 {
+				t.Errorf("%q: unexpected row %+v", output, row)
+			}
+			if len(row.Body) != maxSnippet || !strings.HasPrefix(row.Body, "boom") {
+				t.Errorf("%q: expected a %v byte body snippet, found %q", output, maxSnippet, row.Body)
+			}
+		}
+	}
+}
+
+func TestSummaryTemplate(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"{{.Requests}} requests, {{index .StatusCodes 200}} OK\n", "10 requests, 10 OK\n"},
+		{DefaultSummaryTemplate, "  [200]\t10 responses\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{Request: req, N: 10, C: 2, SummaryTemplate: tt.tmpl, Writer: &out}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), tt.want) {
+			t.Errorf("Expected %q in the summary, found %q", tt.want, out.String())
+		}
+	}
+
+	count = 0
+	for _, tmpl := range []string{"{{.Requests", "{{.Missing}}"} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{Request: req, N: 1, C: 1, SummaryTemplate: tmpl, Writer: ioutil.Discard}
+		if err := w.Run(); err == nil || !strings.Contains(err.Error(), "invalid summary template") {
+			t.Errorf("%q: expected an invalid template error, found %v", tmpl, err)
+		}
+	}
+	if count != 0 {
+		t.Errorf("Expected no requests with an invalid template, found %v", count)
+	}
+}
@@ -17,14 +17,21 @@ package requester
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -34,214 +41,2556 @@ import (
 const maxResult = 1000000
 const maxIdleConn = 500
 
-type result struct {
-	err           error
-	statusCode    int
-	duration      time.Duration
-	connDuration  time.Duration // connection setup(DNS lookup + Dial up) duration
-	dnsDuration   time.Duration // dns lookup duration
-	reqDuration   time.Duration // request "write" duration
-	resDuration   time.Duration // response "read" duration
-	delayDuration time.Duration // delay between response and request
-	contentLength int64
+// expectContinueTimeout is how long requests with Expect100Continue wait
+// for the 100 Continue response before sending their body anyway.
+const expectContinueTimeout = time.Second
+
+// DefaultUserAgent is the User-Agent sent when neither Work.UserAgent
+// nor the request headers provide one.
+const DefaultUserAgent = "hey/0.0.1"
+
+// DefaultCacheBustParam is the query parameter used by Work.CacheBust
+// when Work.CacheBustParam is empty.
+const DefaultCacheBustParam = "_cb"
+
+// Result is the outcome of a single request.
+type Result struct {
+	URL           string
+	Err           error // set if the request failed, or its response body was cut short
+	StatusCode    int
+	Start         time.Time
+	Duration      time.Duration
+	ConnDuration  time.Duration // connection setup(DNS lookup + Dial up) duration
+	DNSDuration   time.Duration // dns lookup duration
+	TLSDuration   time.Duration // tls handshake duration
+	ReqDuration   time.Duration // request "write" duration
+	ResDuration   time.Duration // response "read" duration
+	DelayDuration time.Duration // delay between response and request
+	TTFBDuration  time.Duration // time from request write start to first response byte
+	QueueDuration time.Duration // time the request started behind schedule, in the open model
+	ContentLength int64
+	BodySize      int64  // bytes of the response body actually read, decoded
+	WireSize      int64  // bytes of the response body read from the wire
+	HeaderBytes   int    // size of the response headers, as written in HTTP/1.1
+	HeaderFields  int    // number of response header fields, once per value
+	Compressed    bool   // whether the response body was encoded, and decoded to measure it
+	Encoding      string // content coding of the response, such as "gzip" or "identity"
+	Truncated     bool   // whether the body was cut off at MaxBodyBytes
+	ConnReused    bool   // whether the request reused a kept-alive connection
+	TLSVersion    uint16 // negotiated TLS version, zero for plaintext HTTP
+	CipherSuite   uint16 // negotiated TLS cipher suite, zero for plaintext HTTP
+	ALPN          string // protocol negotiated with ALPN, if any
+	IPFamily      string // IP version of the connection, "IPv4" or "IPv6"
+	RemoteIP      string // IP address of the server of the connection
+	BodySnippet   []byte // start of the body of failed responses, with OutputErrorsOnly
+	RequestID     string // ID sent in the RequestIDHeader, if set
+	GRPCStatus    string // gRPC status of the call, such as "OK" or "NotFound", with GRPCMethod
+	UploadCutOff  bool   // whether the response or an error came before the whole body was sent, with ChunkSize
+	Aborted       bool   // whether AbortOnResponse returned true for the response, stopping the run
+
+	// DeadlineExceeded is whether the request did not complete within
+	// the deadline of its DeadlineHeader.
+	DeadlineExceeded bool
+
+	// ContinueDuration is the time from writing the request headers to
+	// the 100 Continue response, with Expect100Continue. Zero if the
+	// server did not send one.
+	ContinueDuration time.Duration
+
+	// GRPCWebMessages is the number of message frames of a GRPCWeb
+	// response, and GRPCWebTrailers whether it ended with a trailer frame
+	// rather than carry its status in its headers.
+	GRPCWebMessages int
+	GRPCWebTrailers bool
+
+	// ServerName is the server name sent with TLS (SNI), if any.
+	ServerName string
+
+	// Target is the name of the Target of the request, with Targets.
+	Target string
+
+	// Metric is the value ExtractMetric returned for the body of the
+	// response, unless MetricErr is set. Both are unset for requests that
+	// failed.
+	Metric    float64
+	MetricErr error
+
+	WSRoundTrips []time.Duration // round trips of the messages of a WebSocket connection
+	WSDropped    bool            // whether the server closed a WebSocket connection before its Hold
+
+	Events             int             // server-sent events received, with SSE
+	FirstEventDuration time.Duration   // time from the request start to the first server-sent event
+	EventGaps          []time.Duration // time between consecutive server-sent events
 }
 
 type Work struct {
-	// Request is the request to be made.
+	// Request is the request to be made. Its URL must be absolute unless
+	// URLFile, HARFile or Targets is set.
 	Request *http.Request
 
 	RequestBody []byte
 
-	// N is the total number of requests to make.
+	// HeaderFile is the path of a file of headers to send with every
+	// request, one "Name: Value" per line, with blank lines and lines
+	// starting with # skipped. A name on several lines is sent with each
+	// of its values. The headers of Request, and of URLFile and HARFile
+	// targets, take precedence. Run fails if it cannot be read or has a
+	// malformed line. Optional.
+	HeaderFile string
+
+	// ContentType is the Content-Type of requests with a body that do not
+	// have one, from the headers of Request, a target or BodyFunc. If
+	// empty, such requests are sent without a Content-Type. Optional.
+	ContentType string
+
+	// BodyFunc, if set, returns the body of each request and, if not
+	// empty, its Content-Type, overriding RequestBody and the bodies of
+	// URLFile and HARFile targets. reqNum numbers the calls from 0 across
+	// all workers, in the order requests are prepared, which is not
+	// necessarily the order they are sent in. BodyFunc is called
+	// concurrently from the workers and must be safe for it.
+	BodyFunc func(reqNum int) (body []byte, contentType string)
+
+	// Multipart, if set, makes the body of each request a
+	// multipart/form-data form of these parts, overriding RequestBody and
+	// the Content-Type header. Files are streamed from disk as each
+	// request is sent rather than held in memory. Cannot be combined with
+	// BodyFunc, URLFile, HARFile, GRPCMethod or WebSocket. Run fails if a
+	// file cannot be read. Optional.
+	Multipart []MultipartPart
+
+	// ChunkSize, if positive, streams the body of each request with
+	// chunked transfer encoding in chunks of at most ChunkSize bytes,
+	// ChunkDelay apart, to test how servers handle slow uploads. The
+	// summary then reports the uploads cut off by a response or an error
+	// before the whole body was sent. Cannot be combined with Multipart,
+	// GRPCMethod, WebSocket or HTTP10. They must not be negative. Optional.
+	ChunkSize  int
+	ChunkDelay time.Duration
+
+	// ForceContentLength sends request bodies with a Content-Length, even
+	// the slow ones of ChunkSize, which are then trickled without chunked
+	// transfer encoding. ForceChunked sends them with chunked transfer
+	// encoding instead, even when their length is known. By default,
+	// bodies are sent with a Content-Length unless ChunkSize is set. These
+	// are for servers that treat the two differently. At most one of them
+	// may be set, and ForceChunked cannot be combined with HTTP10.
+	ForceContentLength bool
+	ForceChunked       bool
+
+	// CompressRequestBody sends request bodies compressed with gzip, with
+	// a Content-Encoding header, unless they already have one. The
+	// compression counts towards the latency of the request. Cannot be
+	// combined with ChunkSize, GRPCMethod, WebSocket or HandshakeOnly.
+	CompressRequestBody bool
+
+	// FallbackUncompressed sends a request once more, uncompressed, if
+	// the server answered its compressed body with 415 Unsupported Media
+	// Type, for fleets where only some servers accept them. Both round
+	// trips count towards the latency of the request, and the fallbacks
+	// are reported. Requires CompressRequestBody.
+	FallbackUncompressed bool
+
+	// N is the total number of requests to make. It must be positive and no
+	// smaller than C.
 	N int
 
 	// C is the concurrency level, the number of concurrent workers to run.
+	// It must be positive.
 	C int
 
 	// H2 is an option to make HTTP/2 requests
 	H2 bool
 
-	// Timeout in seconds.
+	// H2Conns, with H2, is the number of HTTP/2 connections the requests
+	// are spread over, each request going to the connection with the
+	// fewest streams open, and H2MaxConcurrentStreams the most streams
+	// of each, beyond which requests wait for a stream to complete. Zero
+	// H2Conns is one connection if H2MaxConcurrentStreams is set, and
+	// zero H2MaxConcurrentStreams is as many as the server allows. The
+	// requests and peak streams of each connection are reported. http
+	// URLs are then sent over HTTP/2 without TLS. Excludes ProxyAddr,
+	// PrewarmConns, Transport, GRPCMethod and WebSocket. They must not be
+	// negative.
+	H2Conns                int
+	H2MaxConcurrentStreams int
+
+	// HTTP10 is an option to make HTTP/1.0 requests, for testing legacy
+	// servers. Each request then uses a new connection and bodies are
+	// never sent chunked. Cannot be combined with H2, ProxyAddr,
+	// PrewarmConns or Transport.
+	HTTP10 bool
+
+	// Timeout in seconds of each request, including the read of the
+	// response body. Bodies cut short by it are reported as body read
+	// timeouts. Must not be negative.
 	Timeout int
 
-	// Qps is the rate limit in queries per second.
+	// DeadlineHeader is the name of a request header, such as
+	// grpc-timeout or X-Deadline, that sets the deadline of each request
+	// that has it, so that the client gives up when the server expects
+	// it to. grpc-timeout is in the gRPC format, such as "500m" for 500
+	// milliseconds, other headers are durations, such as "500ms". The
+	// requests that exceed their deadline fail and are counted apart.
+	// Timeout still applies. Excludes SSE, WebSocket and HandshakeOnly. Its
+	// value in the headers of Request must be valid.
+	DeadlineHeader string
+
+	// Expect100Continue sends the requests with a body with an
+	// "Expect: 100-continue" header, so that their body is sent only once
+	// the server responds with 100 Continue, or after a second without a
+	// response. The round trip to the 100 Continue response is reported
+	// in the details. Excludes HTTP10, GRPCMethod, WebSocket and
+	// HandshakeOnly.
+	Expect100Continue bool
+
+	// MaxConnDuration, if positive, closes the connections older than
+	// this before their next request, which is then sent on a new
+	// connection, to model load balancers that limit the age of
+	// connections. The number of connections cycled is reported. Excludes
+	// DisableKeepAlives, H2, HTTP10, PrewarmConns, Transport, NTLMAuth,
+	// GRPCMethod, WebSocket, HandshakeOnly and Expect100Continue. Must not
+	// be negative.
+	MaxConnDuration time.Duration
+
+	// AbortOnResponse, if set, is called with every response, and stops
+	// the run as Stop does once it returns true, such as for a body
+	// telling the service is degraded. Run then returns ErrAborted. The
+	// body of the response is the first megabyte of it, already read, and
+	// it is empty with DiscardBodyImmediately. AbortOnResponse is called
+	// concurrently from the workers and must be safe for it.
+	AbortOnResponse func(resp *http.Response) bool
+
+	// ExtractMetric, if set, is called with the body of every response
+	// that did not fail, its first megabyte, and returns a number it
+	// carries, such as the processing time reported by the server. The
+	// distribution of the numbers is reported along with the latencies,
+	// and the responses it returned an error for are counted.
+	// ExtractMetric is called concurrently from the workers and must be
+	// safe for it. Excludes DiscardBodyImmediately, SSE, WebSocket and
+	// HandshakeOnly.
+	ExtractMetric func(body []byte) (float64, error)
+
+	// DrainTimeout is how long Stop waits for the requests in flight to
+	// complete, so that they are reported, before canceling them. The
+	// canceled requests are only counted. Zero waits for them to complete
+	// or time out. Canceling the context of RunContext cancels them at once.
+	// Must not be negative.
+	DrainTimeout time.Duration
+
+	// Qps is the rate limit in queries per second. Must not be negative.
 	QPS float64
 
 	// DisableCompression is an option to disable compression in response
 	DisableCompression bool
 
+	// AcceptEncoding is the Accept-Encoding header sent with each request,
+	// unless Request already sets one. If empty, "gzip" is sent unless
+	// DisableCompression is set. Responses encoded with gzip, deflate,
+	// Brotli ("br") or zstd are decoded so that both their size on the
+	// wire and decoded size are reported, and the distribution of the
+	// content codings of the responses is reported.
+	AcceptEncoding string
+
 	// DisableKeepAlives is an option to prevents re-use of TCP connections between different HTTP requests
 	DisableKeepAlives bool
 
 	// DisableRedirects is an option to prevent the following of HTTP redirects
 	DisableRedirects bool
 
+	// NoDowngradeRedirects fails the requests redirected from https
+	// to http, rather than following them into plaintext.
+	// StripCrossOriginAuth removes the Authorization header from the
+	// redirects to another scheme, host or port, as browsers do, where
+	// the client only does for other domains. The redirects across
+	// origins and from https to http are counted either way. Cannot be
+	// combined with DisableRedirects.
+	NoDowngradeRedirects bool
+	StripCrossOriginAuth bool
+
+	// ReadBufferSize and WriteBufferSize are the sizes of the buffers the
+	// transport reads responses through and writes requests through on
+	// each HTTP/1.x connection. If zero, they are 4KB. Larger buffers
+	// make fewer system calls for large bodies, which matters at
+	// multi-gigabit rates, at the cost of memory for every connection: C
+	// connections use C times both sizes. They have no effect with H2,
+	// HTTP10 or Transport. They must not be negative.
+	ReadBufferSize  int
+	WriteBufferSize int
+
 	// Output represents the output type. If "csv" is provided, the
-	// output will be dumped as a csv stream.
+	// output will be dumped as a csv stream. If "json" is provided, the
+	// summary is written as a JSON object. Ignored if Reporter is set. Must
+	// be empty, "csv" or "json".
 	Output string
 
-	// ProxyAddr is the address of HTTP proxy server in the format on "host:port".
-	// Optional.
+	// SummaryTemplate, if set, is a text/template that writes the summary
+	// of the run instead of Output, executed with its RunStats once it is
+	// finished. DefaultSummaryTemplate is a starting point. Ignored if
+	// Reporter or OutputErrorsOnly is set. Run fails if it cannot be parsed.
+	SummaryTemplate string
+
+	// Tags are key/value pairs describing the run, such as its
+	// environment or build, added to the machine-readable output: the
+	// json summary, the json rows of OutputErrorsOnly and IntervalFormat,
+	// and the RunStats of SummaryTemplate. They do not appear in the text
+	// summary. Optional.
+	Tags map[string]string
+
+	// CircuitBreaker, if set, stops the run early once the share of
+	// requests that failed or got a 5xx over its rolling window exceeds
+	// its ErrorRate. The results so far are reported, with the break, and
+	// Run returns ErrCircuitBroken. Its Window must be positive and its
+	// ErrorRate at least 0 and below 1. Optional.
+	CircuitBreaker *CircuitBreaker
+
+	// MaxConsecutiveFailures, if positive, stops the run early once this
+	// many requests in a row failed or got a 5xx, as when the service is
+	// down, while tolerating sporadic failures. Any other response resets
+	// the count. The results so far are reported, with the reason, and
+	// Run returns ErrConsecutiveFailures. Must not be negative.
+	MaxConsecutiveFailures int
+
+	// Reporter receives the results of the run and writes its output.
+	// If nil, the reporter for Output is used.
+	Reporter Reporter
+
+	// Reducer, if set, folds every result into an accumulator, starting
+	// from ReducerInit, for custom aggregations that do not keep the
+	// results around. It is called with the accumulator and each result
+	// and returns the new accumulator, which ReducerResult returns. Calls
+	// are made one at a time, in the order the results are reported, by
+	// the goroutine of the Reporter, so Reducer needs no locking, but it
+	// should return quickly, as it holds back the results after it.
+	Reducer     func(acc interface{}, res Result) interface{}
+	ReducerInit interface{}
+
+	// SlowThreshold, if positive, captures the requests that took longer,
+	// with the status, headers and first megabyte of the body of their
+	// response, each to a file of SlowDumpDir, to debug tail latencies.
+	// The number of captures is reported. SlowDumpDir is created if needed,
+	// and Run fails if it cannot be. Must not be negative.
+	SlowThreshold time.Duration
+	SlowDumpDir   string
+
+	// OutputErrorsOnly replaces the output with a row for each request
+	// that failed or got a 4xx or 5xx response, written as it completes:
+	// its URL, status code, error and the start of the response body. Rows
+	// are csv, or JSON objects, one per line, if Output is "json". Ignored
+	// if Reporter is set.
+	OutputErrorsOnly bool
+
+	// ProxyAddr is the address of HTTP proxy server in the format on
+	// "host:port". It must have a host. Optional.
 	ProxyAddr *url.URL
 
 	// Writer is where results will be written. If nil, results are written to stdout.
 	Writer io.Writer
 
-	results chan *result
-	stopCh  chan struct{}
+	// ResultWriter is where the rows written while the run progresses,
+	// the csv output and the Interval rows, are written. If nil, Writer
+	// is used.
+	ResultWriter io.Writer
+
+	// SummaryWriter is where the summary of the run, the text or json
+	// output, is written. If nil, Writer is used.
+	SummaryWriter io.Writer
+
+	// URLFile is the path of a file of targets, one per line, in the form
+	// "[@OFFSET] [METHOD] URL [BODY]". Blank lines and lines starting with
+	// '#' are ignored. When set, each request goes to the next target in
+	// the file, starting over at the end, and Request only supplies the
+	// headers and the method and body for lines that omit them. OFFSET is
+	// the time the request was recorded at, as a duration from the start
+	// of the capture such as "@1.5s", for PreserveTiming. Run fails if a
+	// line is malformed. Optional.
+	URLFile string
+
+	// URLFileRandom picks targets from URLFile at random rather than in
+	// order. The whole file is loaded into memory in this mode.
+	URLFileRandom bool
+
+	// Seed seeds the random choices of the run, the targets picked by
+	// URLFileRandom, so that with a C of 1 the requests are made in the
+	// same order by every run with the same Seed. If zero, each run is
+	// seeded differently.
+	Seed int64
+
+	// DumpSequenceFile is the path of a file to write the requests of the
+	// run to, in the order they are prepared, in the URL file format so
+	// that the sequence can be replayed with URLFile. Their method, URL,
+	// including CacheBust parameters, and body are written, but not their
+	// headers, and requests with bodies spanning lines are only written as
+	// comments. Cannot be combined with Multipart, GRPCMethod, WebSocket or
+	// HandshakeOnly. Run fails if it cannot be created or written. Optional.
+	DumpSequenceFile string
+
+	// HARFile is the path of an HTTP Archive to replay. Its entries are
+	// requested in order, starting over at the end, with the recorded
+	// method, URL, headers and body. Headers from Request are sent too
+	// unless the entry overrides them. Cannot be combined with URLFile. Run
+	// fails if it cannot be read or has a malformed entry. Optional.
+	HARFile string
+
+	// HARThinkTime makes each worker wait, before replaying an entry,
+	// for the time that separated it from the previous entry when it was
+	// recorded. Otherwise entries are sent as fast as QPS allows.
+	HARThinkTime bool
+
+	// PreserveTiming replays the targets of URLFile or HARFile on their
+	// recorded schedule: each request is sent as long after the previous
+	// one as when it was recorded, regardless of response times, and
+	// queued when all C workers are busy, as in the open model. Latencies
+	// are also reported from the scheduled start of the requests, along
+	// with how far behind schedule they were sent. Requires URLFile or
+	// HARFile, and cannot be combined with URLFileRandom, HARThinkTime, QPS,
+	// RateSchedule, OpenModel or Adaptive.
+	PreserveTiming bool
+
+	// ReplayFactor, if above 1, makes each target of URLFile or HARFile
+	// that many requests in a row, the copies sent right along with it,
+	// to scale a recorded workload up, such as with PreserveTiming, which
+	// then replays it at ReplayFactor times its rate. N counts all the
+	// requests, so a URL file or HAR of L targets is replayed once by
+	// L*ReplayFactor requests. The number of targets replayed is reported.
+	// Must not be negative, and requires URLFile or HARFile if above 1.
+	ReplayFactor int
+
+	// DigestAuthUser and DigestAuthPassword, if DigestAuthUser is set,
+	// authenticate requests with HTTP Digest authentication: a request
+	// answered with a 401 and a Digest challenge is sent again with the
+	// response to the challenge, which is reused by the next requests of
+	// the worker until the server challenges again. Both round trips count
+	// towards the latency of the request, and the extra ones are reported.
+	// Cannot be combined with WebSocket.
+	DigestAuthUser     string
+	DigestAuthPassword string
+
+	// NTLMAuth, if set, authenticates the connections of the requests
+	// with NTLM. The handshake counts towards the latency of the request
+	// that makes it, and the handshakes and those the server rejected are
+	// reported. It must have a User. Requires keep-alives, and cannot be
+	// combined with H2, HTTP10, Transport, GRPCMethod, WebSocket,
+	// HandshakeOnly, DigestAuthUser or OAuth2. Optional.
+	NTLMAuth *NTLMAuth
+
+	// OAuth2, if set, authorizes each request with a bearer token from
+	// the OAuth2 client credentials grant, in the Authorization header.
+	// It must have an absolute TokenURL and a ClientID, and Run fails if the
+	// first token cannot be fetched. The number of token refreshes is
+	// reported. Cannot be combined with WebSocket. Optional.
+	OAuth2 *OAuth2
+
+	// MaxInFlight, if positive, caps the number of requests in flight at
+	// once, below C, as a safety valve when the server stalls. Requests
+	// over the cap wait for one to finish, or are dropped and counted if
+	// MaxInFlightDrop is set. The most requests in flight at once is
+	// reported. Must not be negative. Optional.
+	MaxInFlight int
+
+	// MaxBandwidth, if positive, caps the bytes per second read and
+	// written by the connections of all the workers together, to simulate
+	// a slow link on the client side, unlike QPS which caps requests. The
+	// bandwidth achieved is reported. Excludes Transport, PrewarmConns and
+	// WebSocket.
+	MaxBandwidth int
+
+	// MaxInFlightDrop drops requests over MaxInFlight rather than queuing
+	// them. Dropped requests are not made and have no result.
+	MaxInFlightDrop bool
+
+	// TimeScale multiplies the recorded delays between requests with
+	// PreserveTiming: 0.5 replays twice as fast. Defaults to 1. Must not be
+	// negative.
+	TimeScale float64
+
+	// HistogramBuckets are the upper bounds of the buckets of the response
+	// time histogram, in increasing order. A last bucket up to the slowest
+	// response is added if it is above them. If empty, 11 buckets span the
+	// fastest to the slowest response. They must be positive, and cannot be
+	// combined with LinearBuckets. Optional.
+	HistogramBuckets []time.Duration
+
+	// LinearBuckets spaces the automatic histogram buckets at even
+	// intervals. By default they are spaced logarithmically, each bound a
+	// constant multiple of the previous one, for more resolution where
+	// latencies are concentrated ahead of a long tail.
+	LinearBuckets bool
+
+	// Interval, if positive, makes the reporter write a row of statistics
+	// for each interval of the run as it progresses: the requests completed
+	// in the interval, their rate and error rate, and their 50th and 99th
+	// percentile latencies. Each row only accounts for the requests that
+	// completed within its interval. Intervals are aligned on the start of
+	// the run and the last, partial one is written at the end. Must not be
+	// negative.
+	Interval time.Duration
+
+	// IntervalFormat is the format of the interval rows, "csv" (the
+	// default) or "json" for one JSON object per line.
+	IntervalFormat string
+
+	// WorkStealing makes workers take requests from a shared count of N
+	// rather than each making N/C of them, so that workers getting fast
+	// responses pick up the slack of slower ones. Adaptive runs always
+	// work this way.
+	WorkStealing bool
+
+	// Targets, if set, splits the workers between several endpoints,
+	// each with its own concurrency, to model distinct classes of traffic
+	// to the same service, such as 10 workers writing and 40 reading.
+	// Each target is a variation of Request, and C must be the sum of
+	// their C. Workers still make N/C requests each, so that each target
+	// gets a share of N in proportion to its C. QPS still limits each
+	// worker, so that a target is sent at most QPS times its C requests
+	// per second, whatever the others do. The requests, errors and
+	// latencies of each target are reported separately, and are available
+	// from TargetStats.
+	Targets []Target
+
+	// ShowSlowest and ShowFastest print that many of the slowest and
+	// fastest successful requests in the summary, with their URL, status
+	// and timing breakdown, to investigate the tail. They must not be
+	// negative. Optional.
+	ShowSlowest int
+	ShowFastest int
+
+	// ApdexTarget, if positive, is the latency T of the Apdex score of
+	// the run, reported in the summary and by Apdex: the share of the
+	// requests within T, plus half the share of those within 4T, failed
+	// requests counting as slower. ApdexTarget must not be negative.
+	ApdexTarget time.Duration
+
+	// StartupStagger delays the start of each worker by this much after
+	// the one before, so that the C workers do not all connect at once.
+	// Excludes OpenModel, RateSchedule and PreserveTiming, whose workers
+	// follow a schedule. Must not be negative. Optional.
+	StartupStagger time.Duration
+
+	// OpenModel sends requests on a fixed schedule, at QPS*C requests per
+	// second, instead of each worker waiting for a response before sending
+	// the next request. Scheduled requests are picked up by the first of
+	// the C workers available, queuing when they are all busy, so that the
+	// arrival rate does not depend on the server latency. Latencies
+	// measured from the scheduled start are reported as well, corrected
+	// for coordinated omission. Requires QPS, or RateSchedule, and cannot
+	// be combined with Adaptive.
+	OpenModel bool
+
+	// RateSchedule makes the request rate follow a curve over the run,
+	// for example to replay a production traffic pattern. Requests are
+	// dispatched to the workers as in the open model, at the rate of the
+	// schedule interpolated linearly between its points. The rate holds
+	// after the last point, and the run ends there if it is zero. Its
+	// offsets and rates must not be negative, its offsets must be in
+	// increasing order and it must have a positive rate. Cannot be combined
+	// with QPS or Adaptive. Optional.
+	RateSchedule []RatePoint
+
+	// CorrectOmission reports latencies corrected for coordinated
+	// omission in addition to the measured ones. A worker waits for each
+	// response before sending its next request, so when the server stalls
+	// the requests that would have been sent meanwhile are never made and
+	// the stall only counts once. As HdrHistogram does, each latency L
+	// longer than the interval between requests of a worker, I = 1/QPS,
+	// is recorded along with L-I, L-2I, ... down to I: the latencies the
+	// omitted requests would have seen from their intended send times.
+	// Requires QPS. The open model needs no correction and ignores it.
+	CorrectOmission bool
+
+	// Adaptive enables adaptive concurrency, with C as the maximum number
+	// of concurrent workers. Its TargetLatency, MaxErrorRate and Interval
+	// must not be negative, MaxErrorRate must be at most 1, and
+	// TargetLatency or MaxErrorRate must be set. Cannot be combined with
+	// OpenModel or RateSchedule. Optional.
+	Adaptive *Adaptive
+
+	// MaxBodyBytes caps the number of bytes read from each response body.
+	// Longer bodies are truncated, which is recorded, and their connection
+	// is closed rather than reused. If zero, bodies are read fully. Must not
+	// be negative.
+	MaxBodyBytes int64
+
+	// DiscardBodyImmediately closes each response body without reading
+	// it, so that only the time to the response headers is measured. The
+	// response size and throughput are not reported in this mode, and
+	// connections are not reused since their bodies are left unread.
+	DiscardBodyImmediately bool
+
+	// CheckFDLimit makes Run fail, before any request is made, if C and
+	// PrewarmConns call for more connections than the file descriptor
+	// limit of the process allows, rather than the run failing with
+	// errors that look like the server's. The hey command enables it by
+	// default.
+	CheckFDLimit bool
+
+	// PrewarmConns is the number of connections to establish to the host
+	// of Request, including the TLS handshake for https, before the run
+	// starts. The transport uses them instead of dialing, so that pool
+	// growth does not add connection setup to the measured latencies.
+	// Must not be negative, requires an absolute request URL and cannot be
+	// combined with ProxyAddr or Transport. Optional.
+	PrewarmConns int
+
+	// LocalAddrs are the local IP addresses to make connections from,
+	// each in turn, to spread them over source addresses or bind them to
+	// an interface. The number of connections made from each is
+	// reported. Run fails if one cannot be bound. Cannot be combined with
+	// Transport. Optional.
+	LocalAddrs []string
+
+	// ReuseAddr sets SO_REUSEADDR on the sockets of the connections, on
+	// Unix systems, so that local addresses in TIME_WAIT can be bound
+	// again. Together with keep-alive and LocalAddrs, it helps runs of
+	// short connections that exhaust the ephemeral ports of the host,
+	// whose failures are reported as "local port exhaustion". Cannot be
+	// combined with Transport.
+	ReuseAddr bool
+
+	// IPVersion restricts connections to one IP version on dual-stack
+	// hosts: "4" for IPv4 or "6" for IPv6. Run fails if the host of
+	// Request has no address of the version. The IP versions of the
+	// connections are reported, without restricting them with "auto".
+	// Must be empty, "auto", "4" or "6". Cannot be combined with Transport.
+	// Optional.
+	IPVersion string
+
+	// DNSRoundRobin resolves the host of Request once, before the run,
+	// and dials its connections to each of its addresses in turn, of
+	// IPVersion if set, so that the load spreads over all of them rather
+	// than going to the first that answers. The requests and connections
+	// of each address are reported, to catch uneven balancing at the DNS
+	// layer. Excludes URLFile, HARFile, Targets, ProxyAddr, Transport and
+	// PrewarmConns. Run fails if the host does not resolve.
+	DNSRoundRobin bool
+
+	// CacheBust makes each request unique so that caches in front of the
+	// target miss and the origin is measured: a query parameter named
+	// CacheBustParam with a value unique to the request is appended to
+	// the URL, after any existing ones, and a "Cache-Control: no-cache"
+	// header is sent unless Request sets Cache-Control.
+	CacheBust bool
+
+	// CacheBustParam is the name of the CacheBust query parameter.
+	// Defaults to DefaultCacheBustParam.
+	CacheBustParam string
+
+	// RequestIDHeader, if set, is a header, such as X-Request-ID, sent
+	// with a unique ID in each request, to find the requests in the logs
+	// and traces of the server. The ID is kept in the RequestID of the
+	// result, and written with the failures of OutputErrorsOnly. IDs are
+	// made of the start of the run, the worker and a count, unless
+	// RequestIDFunc is set. Excludes WebSocket and HandshakeOnly.
+	RequestIDHeader string
+
+	// RequestIDFunc, if set, returns the ID of request n of worker for
+	// RequestIDHeader, such as a UUID. It is called concurrently from the
+	// workers and must be safe for it.
+	RequestIDFunc func(worker, n int) string
+
+	// Revalidate makes requests conditional, to measure cache
+	// revalidation rather than full responses: each worker keeps the ETag
+	// and Last-Modified validators of the 200 responses it got, by URL, and
+	// sends them as If-None-Match and If-Modified-Since with its next
+	// requests to the URL. The share of 304 Not Modified responses is
+	// reported. Cannot be combined with CacheBust or WebSocket.
+	Revalidate bool
+
+	// GRPCMethod, if set, makes each request a gRPC unary call of the
+	// method, in the form "package.Service/Method", to the host of
+	// Request, over HTTP/2 with TLS for https URLs and without for http
+	// ones. The request message is RequestBody, or the body of BodyFunc,
+	// in the JSON mapping of protocol buffers. The gRPC status of each
+	// call is reported along with the HTTP one, if the response body was
+	// read. Cannot be combined with URLFile, HARFile, HTTP10, ProxyAddr or
+	// PrewarmConns. Request must have an http or https URL, and Run fails if
+	// the method is not found or not unary, or if the request message is not
+	// valid.
+	GRPCMethod string
+
+	// GRPCProtoset is the path of a FileDescriptorSet, as written by
+	// protoc with --include_imports and --descriptor_set_out, that
+	// defines GRPCMethod. If empty, the method is looked up with server
+	// reflection.
+	GRPCProtoset string
+
+	// GRPCWeb, if set, makes the calls of GRPCMethod gRPC-Web ones, as
+	// browsers make to proxies such as Envoy, over the HTTP/1.1 or, with
+	// H2, HTTP/2 transport of the other requests. It is "binary" for
+	// application/grpc-web+proto messages or "text" for base64 encoded
+	// application/grpc-web-text ones. The message and trailer frames of
+	// the responses are reported. Requires GRPCMethod.
+	GRPCWeb string
+
+	// WebSocket, if set, makes each request a WebSocket connection held
+	// as configured, with the request headers sent with the handshake.
+	// The handshake is reported as the request, with a 101 status code if
+	// it succeeded, and the connections dropped and the message round
+	// trips are reported as well. Cannot be combined with URLFile,
+	// HARFile, GRPCMethod, HTTP10, ProxyAddr or PrewarmConns. Request must
+	// have an http, https, ws or wss URL, and Hold and Interval must not be
+	// negative. Optional.
+	WebSocket *WebSocket
+
+	// HandshakeOnly makes each request only connect to the request URL,
+	// completing the TLS handshake of https URLs, and close the connection,
+	// without sending an HTTP request, to tell connection setup costs from
+	// request processing. The connections are reported as the requests,
+	// with the TCP connect and TLS handshake durations, and the handshake
+	// rate and failure rate are reported. Requires an http or https request
+	// URL, and cannot be combined with URLFile, HARFile, GRPCMethod,
+	// WebSocket, HTTP10, ProxyAddr, PrewarmConns, Transport or Adaptive.
+	HandshakeOnly bool
+
+	// RawMode makes the requests without net/http, to measure servers
+	// faster than its client: the request is serialized once and written
+	// as is to kept-alive connections, and only the status line and the
+	// framing of each response are parsed, its body being discarded. No
+	// redirect is followed, no cookie is kept, and the response bodies,
+	// headers and traces are not available, so the reports that need them
+	// are empty. Request must have an http or https URL, and https
+	// certificates are not verified. Cannot be combined with the options
+	// that need net/http: H2, HTTP10, ProxyAddr, Transport, PrewarmConns,
+	// URLFile, HARFile, BodyFunc, Multipart, GRPCMethod, WebSocket, SSE,
+	// HandshakeOnly, CacheBust, Revalidate, DigestAuthUser, NTLMAuth,
+	// OAuth2, ChunkSize, ForceChunked, CompressRequestBody,
+	// Expect100Continue, DeadlineHeader, MaxConnDuration, MaxBodyBytes,
+	// OutputErrorsOnly, SlowThreshold, AbortOnResponse, ExtractMetric,
+	// RequestIDHeader and DumpSequenceFile.
+	RawMode bool
+
+	// PipelineDepth, if above 1, makes each worker of RawMode write this
+	// many requests at once on a connection, without waiting for their
+	// responses (HTTP/1.1 pipelining), and then read the responses. Each
+	// request lasts from the start of its batch to its response, and the
+	// speedup of the batches over serial requests is reported, estimated
+	// from the time to their first response. Requests the server closed
+	// the connection before answering fail. Experimental. Requires
+	// RawMode and excludes DisableKeepAlives, QPS, RateSchedule,
+	// OpenModel, PreserveTiming, Adaptive, WorkStealing and MaxInFlight.
+	PipelineDepth int
+
+	// SSE makes each request read its response as a stream of
+	// server-sent events, until the server closes it, SSEMaxDuration has
+	// passed or the run is stopped, rather than as a single body. The time
+	// to the first event, the gaps between events and the event rate are
+	// reported. Timeout then only bounds the wait for the response
+	// headers. Cannot be combined with DiscardBodyImmediately, GRPCMethod
+	// or WebSocket.
+	SSE bool
+
+	// SSEMaxDuration, if positive, is the longest each SSE stream is read.
+	// Must not be negative.
+	SSEMaxDuration time.Duration
+
+	// UserAgent is the User-Agent header sent with each request. A
+	// User-Agent already set on Request takes precedence. If empty,
+	// DefaultUserAgent is used.
+	UserAgent string
+
+	// Logger, if set, is called at key points of each request, with a
+	// level, "debug" or "error", a message and fields such as "url":
+	// when a new connection is established, when the request is sent,
+	// when the response is received and when the request fails. It is
+	// called concurrently, from the workers and the transport, and is
+	// timed along with the requests, so it should return quickly.
+	// Optional.
+	Logger func(level, msg string, fields map[string]interface{})
+
+	// Debug writes the Logger messages to stderr, away from the output,
+	// when Logger is not set.
+	Debug bool
+
+	// BaselineFile is the path of the json output of an earlier run to
+	// compare this one to. The differences are written after the text
+	// summary, or to stderr with the other outputs, and Run returns
+	// ErrRegression if the rate of requests dropped, or the p50, p90 or p99
+	// latency rose, by more than BaselineTolerance, or if the share of
+	// requests that failed or got a 5xx rose by more than one percentage
+	// point. Run fails if it is not the json output of a run with requests.
+	// Optional.
+	BaselineFile string
+
+	// BaselineTolerance is the relative change of the rate of requests and
+	// latencies allowed by BaselineFile, such as 0.1 for 10%. Defaults to
+	// DefaultBaselineTolerance. Must not be negative.
+	BaselineTolerance float64
+
+	// Transport is the round tripper used to make requests. If nil, a
+	// transport is built from the options above. Optional.
+	Transport http.RoundTripper
+
+	// ContextValues are set on the context of every request, so that
+	// Transport, or a tracer it wraps, can read per-run data such as
+	// correlation IDs with Request.Context().Value. As with
+	// context.WithValue, keys should be of an unexported type of the
+	// caller's own package rather than strings or other built-in types,
+	// which could collide with the keys of other packages, and must be
+	// comparable and not nil. The values are shared by all requests and
+	// must be safe for concurrent use. Optional.
+	ContextValues map[interface{}]interface{}
+
+	// CAFile is the path of a PEM bundle of the root certificates to
+	// verify the certificates of https servers with, such as those of an
+	// internal CA. If empty, certificates are not verified. Run fails if it
+	// cannot be read or has no certificate. Optional.
+	CAFile string
+
+	// ServerName, if set, is the server name sent with TLS (SNI) instead
+	// of the host of the request URL, and the name certificates are
+	// verified for with CAFile. The URL still sets where to connect and,
+	// unless the Host of Request is set, the Host header, so that the
+	// three can differ to test SNI routing and certificate selection.
+	// The server names sent are reported. Optional.
+	ServerName string
+
+	ctx     context.Context // canceled with the run context, or by DrainTimeout
+	results chan *Result
+	stopCh  chan struct{} // closed by Stop
+	startCh chan struct{} // closed when the run starts
 	start   time.Time
+	targets targetSource
+
+	grpc      *grpcCall
+	multipart *multipartBody
+	logger    func(level, msg string, fields map[string]interface{}) // Logger, or the Debug one
+	adaptive  *adaptiveController
+	prewarm   *prewarmPool
+	inFlight  *inFlightLimiter
+	digest    *digestTransport
+	compress  *compressTransport
+	pool      *poolTracker
+	dns       *dnsTracker
+	rrDialer  *roundRobinDialer
+	bandwidth *bandwidthLimiter
+	stream    chan Result // of Results, for the next run
+	ntlm      *ntlmTransport
+	cycler    *connCycler
+	h2pool    *h2Pool
+	raw       *rawClient
+	repeat    *repeatTargets
+	pipeline  *pipelineStats
+	oauth2    *tokenSource
+	baseline  *JSONSummary
+	rootCAs   *x509.CertPool // from CAFile
+	sequence  *sequenceFile
+	header    http.Header   // from HeaderFile
+	source    *sourceDialer // dials from LocalAddrs, with ReuseAddr
+	remaining int64         // requests left to take with WorkStealing
 
+	workerTargets []*target // target of each worker, by id, with Targets
+
+	cacheBustSeq int64 // last CacheBust value
+	drained      int32 // set once DrainTimeout canceled the requests
+	aborted      int32 // set once AbortOnResponse stopped the run
+	drainCancels int64 // requests canceled by DrainTimeout
+	slowSeq      int64 // last SlowThreshold capture number
+	slowCaptures int64 // SlowThreshold captures written
+	crossOrigin  int64 // redirects to another origin
+	downgrades   int64 // redirects from https to http
+	bodySeq      int64 // number of BodyFunc calls
+
+	mu     sync.Mutex // guards report and stopCh, used by Snapshot and Stop
 	report *report
+	ran    bool // a run finished, so that its Stop does not carry over
+}
+
+func (b *Work) writer() io.Writer {
+	if b.Writer == nil {
+		return os.Stdout
+	}
+	return b.Writer
+}
+
+func (b *Work) resultWriter() io.Writer {
+	if b.ResultWriter == nil {
+		return b.writer()
+	}
+	return b.ResultWriter
+}
+
+func (b *Work) summaryWriter() io.Writer {
+	if b.SummaryWriter == nil {
+		return b.writer()
+	}
+	return b.SummaryWriter
+}
+
+// Run makes all the requests, prints the summary. It blocks until
+// all work is done.
+//
+// Run validates the configuration first and returns an error describing
+// the first invalid or conflicting option; see the documentation of each
+// field.
+func (b *Work) Run() error {
+	return b.RunContext(context.Background())
+}
+
+// RunContext is like Run, but stops the run when ctx is done: workers
+// stop picking up new requests, in-flight requests are canceled and
+// left out of the results, and the report of the requests completed so
+// far is written. It returns ctx.Err() in that case. Requests are made
+// with ctx rather than the context of Request.
+func (b *Work) RunContext(ctx context.Context) error {
+	stream := b.takeStream()
+	if stream != nil {
+		// Run only returns once the reporter is done sending.
+		defer close(stream)
+	}
+	b.resetChans()
+	defer func() {
+		b.mu.Lock()
+		b.ran = true
+		b.mu.Unlock()
+	}()
+	if err := b.validate(); err != nil {
+		return err
+	}
+	if b.CheckFDLimit {
+		if err := b.checkFDLimit(); err != nil {
+			return err
+		}
+	}
+	b.logger = b.Logger
+	if b.logger == nil && b.Debug {
+		b.logger = writerLogger(os.Stderr)
+	}
+	summary, err := parseSummaryTemplate(b.SummaryTemplate)
+	if err != nil {
+		return err
+	}
+	if b.MaxBandwidth > 0 {
+		b.bandwidth = &bandwidthLimiter{rate: int64(b.MaxBandwidth)}
+	}
+	if b.DNSRoundRobin {
+		if b.rrDialer, err = newRoundRobinDialer(ctx, b.Request.URL.Hostname(), b.IPVersion); err != nil {
+			return err
+		}
+	}
+	client, err := b.newClient()
+	if err != nil {
+		return err
+	}
+	if b.URLFile == "" && b.HARFile == "" && len(b.Targets) == 0 && b.ProxyAddr == nil {
+		if err := checkIPVersion(ctx, b.Request.URL.Hostname(), b.IPVersion); err != nil {
+			return err
+		}
+	}
+	if b.GRPCMethod != "" {
+		if b.grpc, err = b.resolveGRPC(ctx, client); err != nil {
+			return err
+		}
+	}
+	if b.HeaderFile != "" {
+		if b.header, err = loadHeaderFile(b.HeaderFile); err != nil {
+			return err
+		}
+	}
+	if b.RawMode {
+		if b.raw, err = b.newRawClient(); err != nil {
+			return err
+		}
+		if b.PipelineDepth > 1 {
+			b.pipeline = &pipelineStats{depth: b.PipelineDepth}
+		}
+	}
+	if b.URLFile != "" {
+		if b.targets, err = newTargetSource(b.URLFile, b.URLFileRandom, b.Seed); err != nil {
+			return err
+		}
+	}
+	if b.HARFile != "" {
+		targets, err := loadHAR(b.HARFile)
+		if err != nil {
+			return err
+		}
+		b.targets = &listTargets{targets: targets}
+	}
+	if len(b.Targets) > 0 {
+		b.workerTargets = b.assignTargets()
+	}
+	if b.ReplayFactor > 1 {
+		b.repeat = &repeatTargets{src: b.targets, factor: b.ReplayFactor}
+		b.targets = b.repeat
+	}
+	if len(b.Multipart) > 0 {
+		if b.multipart, err = newMultipartBody(b.Multipart); err != nil {
+			return err
+		}
+	}
+	if b.BaselineFile != "" {
+		if b.baseline, err = loadBaseline(b.BaselineFile); err != nil {
+			return err
+		}
+	}
+	if b.OAuth2 != nil {
+		b.oauth2 = newTokenSource(*b.OAuth2, b.rootCAs, b.ProxyAddr, b.logger)
+		if err := b.oauth2.fetch(ctx); err != nil {
+			return err
+		}
+	}
+	if b.MaxInFlight > 0 {
+		b.inFlight = newInFlightLimiter(b.MaxInFlight, b.MaxInFlightDrop)
+	}
+	if b.Adaptive != nil {
+		b.adaptive = newAdaptiveController(*b.Adaptive, b.N, b.C)
+	}
+	if b.prewarm != nil {
+		if err := b.prewarm.fill(b.Request.URL, b.PrewarmConns); err != nil {
+			return err
+		}
+	}
+	if b.SlowThreshold > 0 {
+		if err := os.MkdirAll(b.SlowDumpDir, 0755); err != nil {
+			return fmt.Errorf("requester: %v", err)
+		}
+	}
+	if b.DumpSequenceFile != "" {
+		if b.sequence, err = newSequenceFile(b.DumpSequenceFile); err != nil {
+			return err
+		}
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	b.ctx = withValues(reqCtx, b.ContextValues)
+	b.results = make(chan *Result, min(min(b.C*1000, b.N), maxResult))
+	stop := b.stopChan()
+	b.start = time.Now()
+	report := newReport(b.summaryWriter(), b.results, b.N)
+	report.rowWriter = b.resultWriter()
+	report.reporter = b.Reporter
+	if report.reporter == nil && b.OutputErrorsOnly {
+		report.reporter = &errorsReporter{w: report.rowWriter, json: b.Output == "json", tags: b.Tags, ids: b.RequestIDHeader != ""}
+	}
+	if report.reporter == nil && summary != nil {
+		report.reporter = &templateReporter{r: report, tmpl: summary}
+	}
+	if report.reporter == nil {
+		report.reporter = newReporter(report, b.Output)
+	}
+	report.start = b.start
+	report.interval = b.Interval
+	report.intervalFormat = b.IntervalFormat
+	report.openModel = b.OpenModel || len(b.RateSchedule) > 0 || b.PreserveTiming
+	report.replay = b.PreserveTiming
+	report.websocket = b.WebSocket != nil
+	report.sse = b.SSE
+	report.revalidate = b.Revalidate
+	report.linearBuckets = b.LinearBuckets
+	report.chunked = b.ChunkSize > 0
+	report.handshake = b.HandshakeOnly
+	report.grpcWeb = b.GRPCWeb != ""
+	report.metric = b.ExtractMetric != nil
+	report.apdexTarget = b.ApdexTarget
+	report.reducer, report.acc = b.Reducer, b.ReducerInit
+	report.stream, report.streamStop, report.streamCtx = stream, stop, b.ctx.Done()
+	if len(b.Targets) > 0 {
+		report.targets = make(map[string]*targetStats, len(b.Targets))
+		for _, t := range b.Targets {
+			report.targets[t.name()] = &targetStats{statusCodeDist: make(map[int]int)}
+			report.targetNames = append(report.targetNames, t.name())
+		}
+	}
+	report.tags = b.Tags
+	if b.ShowSlowest > 0 {
+		report.slowestRes = newExtremes(b.ShowSlowest, true)
+	}
+	if b.ShowFastest > 0 {
+		report.fastestRes = newExtremes(b.ShowFastest, false)
+	}
+	if b.CircuitBreaker != nil {
+		report.breaker = newCircuitBreaker(*b.CircuitBreaker, b.Stop)
+	}
+	if b.MaxConsecutiveFailures > 0 {
+		report.failures = &failureStreak{max: b.MaxConsecutiveFailures, stop: b.Stop}
+	}
+	report.ipVersion = b.IPVersion != ""
+	report.roundRobin = b.DNSRoundRobin
+	for _, d := range b.HistogramBuckets {
+		report.histBuckets = append(report.histBuckets, d.Seconds())
+	}
+	if b.CorrectOmission && !b.OpenModel {
+		report.expectedInterval = 1 / b.QPS
+	}
+	b.mu.Lock()
+	b.report = report
+	b.pool = &poolTracker{}
+	b.dns = &dnsTracker{}
+	b.mu.Unlock()
+	// Run the reporter first, it polls the result channel until it is closed.
+	go func() {
+		runReporter(b.report)
+	}()
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.Stop()
+		case <-stop:
+			b.drain(cancel, done)
+		case <-done:
+		}
+	}()
+	b.runWorkers(client)
+	close(done)
+	b.Finish()
+	if b.sequence != nil {
+		if err := b.sequence.close(); err != nil {
+			return fmt.Errorf("requester: cannot write %s: %v", b.DumpSequenceFile, err)
+		}
+	}
+	if report.breaker != nil && report.breaker.broken() {
+		return ErrCircuitBroken
+	}
+	if report.failures != nil && report.failures.stopped() {
+		return ErrConsecutiveFailures
+	}
+	if atomic.LoadInt32(&b.aborted) == 1 {
+		return ErrAborted
+	}
+	if b.baseline != nil && b.compareBaseline() > 0 && ctx.Err() == nil {
+		return ErrRegression
+	}
+	return ctx.Err()
+}
+
+// validate checks the configuration, so that setup problems are reported
+// by Run instead of surfacing as failures inside the workers.
+func (b *Work) validate() error {
+	if b.Request == nil {
+		return errors.New("requester: Request is required")
+	}
+	if b.URLFile != "" && b.HARFile != "" {
+		return errors.New("requester: URLFile and HARFile cannot both be set")
+	}
+	if b.URLFile == "" && b.HARFile == "" && len(b.Targets) == 0 && (b.Request.URL == nil || !b.Request.URL.IsAbs() || b.Request.URL.Host == "") {
+		return fmt.Errorf("requester: invalid request URL %q", b.Request.URL)
+	}
+	if b.N <= 0 || b.C <= 0 {
+		return errors.New("requester: N and C cannot be smaller than 1")
+	}
+	if b.N < b.C {
+		return errors.New("requester: N cannot be less than C")
+	}
+	if len(b.Targets) > 0 {
+		if err := b.validateTargets(); err != nil {
+			return err
+		}
+	}
+	if b.QPS < 0 {
+		return errors.New("requester: QPS cannot be negative")
+	}
+	if len(b.RateSchedule) > 0 {
+		if b.QPS > 0 || b.Adaptive != nil {
+			return errors.New("requester: RateSchedule cannot be used with QPS or Adaptive")
+		}
+		if err := validateRateSchedule(b.RateSchedule); err != nil {
+			return fmt.Errorf("requester: %v", err)
+		}
+	}
+	if b.CorrectOmission && b.QPS == 0 {
+		return errors.New("requester: CorrectOmission requires QPS")
+	}
+	if b.OpenModel && ((b.QPS == 0 && len(b.RateSchedule) == 0) || b.Adaptive != nil) {
+		return errors.New("requester: OpenModel requires QPS or RateSchedule and cannot be used with Adaptive")
+	}
+	if b.PreserveTiming {
+		if b.URLFile == "" && b.HARFile == "" {
+			return errors.New("requester: PreserveTiming requires URLFile or HARFile")
+		}
+		if b.URLFileRandom || b.HARThinkTime || b.QPS > 0 || len(b.RateSchedule) > 0 || b.OpenModel || b.Adaptive != nil {
+			return errors.New("requester: PreserveTiming cannot be used with URLFileRandom, HARThinkTime, QPS, RateSchedule, OpenModel or Adaptive")
+		}
+	}
+	if b.DigestAuthUser != "" && b.WebSocket != nil {
+		return errors.New("requester: DigestAuthUser cannot be used with WebSocket")
+	}
+	if o := b.OAuth2; o != nil {
+		if b.WebSocket != nil {
+			return errors.New("requester: OAuth2 cannot be used with WebSocket")
+		}
+		if u, err := url.Parse(o.TokenURL); err != nil || !u.IsAbs() || u.Host == "" || o.ClientID == "" {
+			return errors.New("requester: OAuth2 requires a TokenURL and a ClientID")
+		}
+	}
+	if b.Revalidate && (b.CacheBust || b.WebSocket != nil) {
+		return errors.New("requester: Revalidate cannot be used with CacheBust or WebSocket")
+	}
+	for i, d := range b.HistogramBuckets {
+		if d <= 0 || (i > 0 && d <= b.HistogramBuckets[i-1]) || b.LinearBuckets {
+			return errors.New("requester: HistogramBuckets must be positive and increasing, without LinearBuckets")
+		}
+	}
+	if b.CompressRequestBody && (b.ChunkSize > 0 || b.GRPCMethod != "" || b.WebSocket != nil || b.HandshakeOnly) {
+		return errors.New("requester: CompressRequestBody cannot be used with ChunkSize, GRPCMethod, WebSocket or HandshakeOnly")
+	}
+	if b.FallbackUncompressed && !b.CompressRequestBody {
+		return errors.New("requester: FallbackUncompressed requires CompressRequestBody")
+	}
+	if b.ChunkSize < 0 || b.ChunkDelay < 0 {
+		return errors.New("requester: ChunkSize and ChunkDelay cannot be negative")
+	}
+	if b.ChunkSize > 0 && (len(b.Multipart) > 0 || b.GRPCMethod != "" || b.WebSocket != nil || b.HTTP10) {
+		return errors.New("requester: ChunkSize cannot be used with Multipart, GRPCMethod, WebSocket or HTTP10")
+	}
+	if a := b.NTLMAuth; a != nil {
+		if b.DisableKeepAlives || b.H2 || b.HTTP10 || b.Transport != nil || b.GRPCMethod != "" || b.WebSocket != nil || b.HandshakeOnly || b.DigestAuthUser != "" || b.OAuth2 != nil {
+			return errors.New("requester: NTLMAuth cannot be used with DisableKeepAlives, H2, HTTP10, Transport, GRPCMethod, WebSocket, HandshakeOnly, DigestAuthUser or OAuth2")
+		}
+		if a.User == "" {
+			return errors.New("requester: NTLMAuth requires a User")
+		}
+	}
+	if b.Expect100Continue && (b.HTTP10 || b.GRPCMethod != "" || b.WebSocket != nil || b.HandshakeOnly) {
+		return errors.New("requester: Expect100Continue cannot be combined with HTTP10, GRPCMethod, WebSocket or HandshakeOnly")
+	}
+	if b.H2Conns < 0 || b.H2MaxConcurrentStreams < 0 {
+		return errors.New("requester: H2Conns and H2MaxConcurrentStreams cannot be negative")
+	}
+	if b.H2Conns > 0 || b.H2MaxConcurrentStreams > 0 {
+		if !b.H2 {
+			return errors.New("requester: H2Conns and H2MaxConcurrentStreams require H2")
+		}
+		if b.ProxyAddr != nil || b.PrewarmConns > 0 || b.Transport != nil || b.GRPCMethod != "" || b.WebSocket != nil {
+			return errors.New("requester: H2Conns and H2MaxConcurrentStreams cannot be combined with ProxyAddr, PrewarmConns, Transport, GRPCMethod or WebSocket")
+		}
+	}
+	if b.ShowSlowest < 0 || b.ShowFastest < 0 {
+		return errors.New("requester: ShowSlowest and ShowFastest cannot be negative")
+	}
+	if b.DeadlineHeader != "" {
+		if b.SSE || b.WebSocket != nil || b.HandshakeOnly {
+			return errors.New("requester: DeadlineHeader cannot be combined with SSE, WebSocket or HandshakeOnly")
+		}
+		if _, err := headerDeadline(b.Request.Header, b.DeadlineHeader); err != nil {
+			return err
+		}
+	}
+	if b.StartupStagger < 0 {
+		return errors.New("requester: StartupStagger cannot be negative")
+	}
+	if b.StartupStagger > 0 && (b.OpenModel || len(b.RateSchedule) > 0 || b.PreserveTiming) {
+		return errors.New("requester: StartupStagger cannot be combined with OpenModel, RateSchedule or PreserveTiming")
+	}
+	if b.MaxConnDuration < 0 {
+		return errors.New("requester: MaxConnDuration cannot be negative")
+	}
+	if b.MaxConnDuration > 0 && (b.DisableKeepAlives || b.H2 || b.HTTP10 || b.PrewarmConns > 0 || b.Transport != nil ||
+		b.NTLMAuth != nil || b.GRPCMethod != "" || b.WebSocket != nil || b.HandshakeOnly || b.Expect100Continue) {
+		return errors.New("requester: MaxConnDuration cannot be combined with DisableKeepAlives, H2, HTTP10, PrewarmConns, Transport, NTLMAuth, GRPCMethod, WebSocket, HandshakeOnly or Expect100Continue")
+	}
+	if b.DrainTimeout < 0 {
+		return errors.New("requester: DrainTimeout cannot be negative")
+	}
+	if b.SlowThreshold < 0 {
+		return errors.New("requester: SlowThreshold cannot be negative")
+	}
+	if b.SlowThreshold > 0 && b.SlowDumpDir == "" {
+		return errors.New("requester: SlowThreshold requires SlowDumpDir")
+	}
+	if b.DumpSequenceFile != "" && (len(b.Multipart) > 0 || b.GRPCMethod != "" || b.WebSocket != nil || b.HandshakeOnly) {
+		return errors.New("requester: DumpSequenceFile cannot be used with Multipart, GRPCMethod, WebSocket or HandshakeOnly")
+	}
+	if cb := b.CircuitBreaker; cb != nil && (cb.Window <= 0 || cb.ErrorRate < 0 || cb.ErrorRate >= 1) {
+		return errors.New("requester: CircuitBreaker requires a positive Window and an ErrorRate from 0 to 1")
+	}
+	if b.ReadBufferSize < 0 || b.WriteBufferSize < 0 {
+		return errors.New("requester: ReadBufferSize and WriteBufferSize cannot be negative")
+	}
+	if b.ReplayFactor < 0 {
+		return errors.New("requester: ReplayFactor cannot be negative")
+	}
+	if b.ReplayFactor > 1 && b.URLFile == "" && b.HARFile == "" {
+		return errors.New("requester: ReplayFactor requires URLFile or HARFile")
+	}
+	if b.MaxConsecutiveFailures < 0 {
+		return errors.New("requester: MaxConsecutiveFailures cannot be negative")
+	}
+	if b.ForceContentLength && b.ForceChunked {
+		return errors.New("requester: ForceContentLength and ForceChunked cannot both be set")
+	}
+	if b.ForceChunked && b.HTTP10 {
+		return errors.New("requester: ForceChunked cannot be used with HTTP10")
+	}
+	if b.RawMode {
+		if o := b.rawUnsupported(); o != "" {
+			return fmt.Errorf("requester: RawMode cannot be combined with %s", o)
+		}
+		if s := b.Request.URL.Scheme; s != "http" && s != "https" {
+			return fmt.Errorf("requester: invalid RawMode URL %q", b.Request.URL)
+		}
+	}
+	if b.PipelineDepth < 0 {
+		return errors.New("requester: PipelineDepth cannot be negative")
+	}
+	if b.PipelineDepth > 1 {
+		if !b.RawMode {
+			return errors.New("requester: PipelineDepth requires RawMode")
+		}
+		if b.DisableKeepAlives || b.QPS > 0 || len(b.RateSchedule) > 0 || b.OpenModel || b.PreserveTiming || b.Adaptive != nil || b.WorkStealing || b.MaxInFlight > 0 {
+			return errors.New("requester: PipelineDepth cannot be combined with DisableKeepAlives, QPS, RateSchedule, OpenModel, PreserveTiming, Adaptive, WorkStealing or MaxInFlight")
+		}
+	}
+	if b.HandshakeOnly {
+		if b.URLFile != "" || b.HARFile != "" || b.GRPCMethod != "" || b.WebSocket != nil || b.HTTP10 || b.ProxyAddr != nil || b.PrewarmConns > 0 || b.Transport != nil || b.Adaptive != nil {
+			return errors.New("requester: HandshakeOnly cannot be used with URLFile, HARFile, GRPCMethod, WebSocket, HTTP10, ProxyAddr, PrewarmConns, Transport or Adaptive")
+		}
+		if s := b.Request.URL.Scheme; s != "http" && s != "https" {
+			return fmt.Errorf("requester: invalid HandshakeOnly URL %q", b.Request.URL)
+		}
+	}
+	if b.BaselineTolerance < 0 {
+		return errors.New("requester: BaselineTolerance cannot be negative")
+	}
+	if b.MaxInFlight < 0 {
+		return errors.New("requester: MaxInFlight cannot be negative")
+	}
+	if b.TimeScale < 0 {
+		return errors.New("requester: TimeScale cannot be negative")
+	}
+	if b.Timeout < 0 {
+		return errors.New("requester: Timeout cannot be negative")
+	}
+	if b.Reporter == nil && b.Output != "" && b.Output != "csv" && b.Output != "json" {
+		return fmt.Errorf("requester: invalid output type %q", b.Output)
+	}
+	if b.Interval < 0 {
+		return errors.New("requester: Interval cannot be negative")
+	}
+	if b.IntervalFormat != "" && b.IntervalFormat != "csv" && b.IntervalFormat != "json" {
+		return fmt.Errorf("requester: invalid interval format %q", b.IntervalFormat)
+	}
+	if b.ProxyAddr != nil && b.ProxyAddr.Host == "" {
+		return fmt.Errorf("requester: invalid proxy address %q", b.ProxyAddr)
+	}
+	if b.HTTP10 && (b.H2 || b.ProxyAddr != nil || b.PrewarmConns > 0 || b.Transport != nil) {
+		return errors.New("requester: HTTP10 cannot be used with H2, ProxyAddr, PrewarmConns or Transport")
+	}
+	if b.GRPCMethod != "" {
+		if b.URLFile != "" || b.HARFile != "" || b.HTTP10 || b.ProxyAddr != nil || b.PrewarmConns > 0 {
+			return errors.New("requester: GRPCMethod cannot be used with URLFile, HARFile, HTTP10, ProxyAddr or PrewarmConns")
+		}
+		if s := b.Request.URL.Scheme; s != "http" && s != "https" {
+			return fmt.Errorf("requester: invalid gRPC URL %q", b.Request.URL)
+		}
+	}
+	if b.GRPCWeb != "" {
+		if _, ok := grpcWebContentTypes[b.GRPCWeb]; !ok {
+			return fmt.Errorf("requester: invalid GRPCWeb %q, expected binary or text", b.GRPCWeb)
+		}
+		if b.GRPCMethod == "" {
+			return errors.New("requester: GRPCWeb requires GRPCMethod")
+		}
+	}
+	if ws := b.WebSocket; ws != nil {
+		if b.URLFile != "" || b.HARFile != "" || b.GRPCMethod != "" || b.HTTP10 || b.ProxyAddr != nil || b.PrewarmConns > 0 {
+			return errors.New("requester: WebSocket cannot be used with URLFile, HARFile, GRPCMethod, HTTP10, ProxyAddr or PrewarmConns")
+		}
+		if _, err := wsURL(b.Request.URL); err != nil {
+			return err
+		}
+		if ws.Hold < 0 || ws.Interval < 0 {
+			return errors.New("requester: invalid WebSocket configuration")
+		}
+	}
+	if len(b.Multipart) > 0 && (b.BodyFunc != nil || b.URLFile != "" || b.HARFile != "" || b.GRPCMethod != "" || b.WebSocket != nil) {
+		return errors.New("requester: Multipart cannot be used with BodyFunc, URLFile, HARFile, GRPCMethod or WebSocket")
+	}
+	if b.SSE && (b.DiscardBodyImmediately || b.GRPCMethod != "" || b.WebSocket != nil) {
+		return errors.New("requester: SSE cannot be used with DiscardBodyImmediately, GRPCMethod or WebSocket")
+	}
+	if (b.NoDowngradeRedirects || b.StripCrossOriginAuth) && b.DisableRedirects {
+		return errors.New("requester: NoDowngradeRedirects and StripCrossOriginAuth cannot be used with DisableRedirects")
+	}
+	if b.RequestIDHeader != "" && (b.WebSocket != nil || b.HandshakeOnly) {
+		return errors.New("requester: RequestIDHeader cannot be used with WebSocket or HandshakeOnly")
+	}
+	if b.ExtractMetric != nil && (b.DiscardBodyImmediately || b.SSE || b.WebSocket != nil || b.HandshakeOnly) {
+		return errors.New("requester: ExtractMetric cannot be used with DiscardBodyImmediately, SSE, WebSocket or HandshakeOnly")
+	}
+	if b.SSEMaxDuration < 0 {
+		return errors.New("requester: SSEMaxDuration cannot be negative")
+	}
+	if b.MaxBodyBytes < 0 {
+		return errors.New("requester: MaxBodyBytes cannot be negative")
+	}
+	if b.PrewarmConns < 0 {
+		return errors.New("requester: PrewarmConns cannot be negative")
+	}
+	if b.PrewarmConns > 0 {
+		if b.ProxyAddr != nil || b.Transport != nil {
+			return errors.New("requester: PrewarmConns cannot be used with ProxyAddr or Transport")
+		}
+		if b.Request.URL == nil || !b.Request.URL.IsAbs() || b.Request.URL.Host == "" {
+			return errors.New("requester: PrewarmConns requires an absolute request URL")
+		}
+	}
+	if (len(b.LocalAddrs) > 0 || b.ReuseAddr) && b.Transport != nil {
+		return errors.New("requester: LocalAddrs and ReuseAddr cannot be used with Transport")
+	}
+	switch b.IPVersion {
+	case "", "auto", "4", "6":
+	default:
+		return fmt.Errorf("requester: invalid IP version %q", b.IPVersion)
+	}
+	if b.IPVersion != "" && b.Transport != nil {
+		return errors.New("requester: IPVersion cannot be used with Transport")
+	}
+	if b.ApdexTarget < 0 {
+		return errors.New("requester: ApdexTarget cannot be negative")
+	}
+	if _, ok := b.ContextValues[nil]; ok {
+		return errors.New("requester: ContextValues cannot have a nil key")
+	}
+	if b.MaxBandwidth < 0 {
+		return errors.New("requester: MaxBandwidth cannot be negative")
+	}
+	if b.MaxBandwidth > 0 && (b.Transport != nil || b.PrewarmConns > 0 || b.WebSocket != nil) {
+		return errors.New("requester: MaxBandwidth cannot be used with Transport, PrewarmConns or WebSocket")
+	}
+	if b.DNSRoundRobin && (b.URLFile != "" || b.HARFile != "" || len(b.Targets) > 0 || b.ProxyAddr != nil || b.Transport != nil || b.PrewarmConns > 0) {
+		return errors.New("requester: DNSRoundRobin cannot be used with URLFile, HARFile, Targets, ProxyAddr, Transport or PrewarmConns")
+	}
+	if a := b.Adaptive; a != nil {
+		if a.TargetLatency < 0 || a.MaxErrorRate < 0 || a.MaxErrorRate > 1 || a.Interval < 0 {
+			return errors.New("requester: invalid Adaptive configuration")
+		}
+		if a.TargetLatency == 0 && a.MaxErrorRate == 0 {
+			return errors.New("requester: Adaptive requires a TargetLatency or MaxErrorRate")
+		}
+	}
+	return nil
+}
+
+// Stop stops the run: workers finish their current request and exit. It
+// never blocks and may be called any number of times, from any goroutine,
+// including once the run is finished, which does not stop the next run
+// of the Work. Called before Run, it stops the run as soon as it starts.
+func (b *Work) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopCh == nil {
+		b.stopCh = make(chan struct{})
+	}
+	// Close the stop channel so that workers can stop gracefully.
+	select {
+	case <-b.stopCh:
+	default:
+		close(b.stopCh)
+	}
+}
+
+// drain cancels the requests in flight once DrainTimeout has passed
+// since Stop, unless the workers are done before.
+func (b *Work) drain(cancel context.CancelFunc, done <-chan struct{}) {
+	if b.DrainTimeout <= 0 {
+		return
+	}
+	t := time.NewTimer(b.DrainTimeout)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		atomic.StoreInt32(&b.drained, 1)
+		cancel()
+	case <-done:
+	}
+}
+
+// canceled records a request dropped because the run was canceled,
+// counting those canceled by DrainTimeout.
+func (b *Work) canceled() {
+	if atomic.LoadInt32(&b.drained) == 1 {
+		atomic.AddInt64(&b.drainCancels, 1)
+	}
+}
+
+// stopChan returns the channel closed by Stop, creating it if needed.
+func (b *Work) stopChan() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopCh == nil {
+		b.stopCh = make(chan struct{})
+	}
+	return b.stopCh
+}
+
+func (b *Work) Finish() {
+	total := time.Now().Sub(b.start)
+	b.report.end = b.start.Add(total)
+	close(b.results)
+	// Wait until the reporter is done.
+	<-b.report.done
+	if b.adaptive != nil {
+		b.report.concurrency = b.adaptive.trajectory()
+	}
+	if b.prewarm != nil {
+		b.prewarm.close()
+		b.report.prewarmed, b.report.prewarmUsed = b.prewarm.dialed, b.prewarm.used
+	}
+	if b.source != nil {
+		b.report.sourceDist = b.source.dist()
+	}
+	b.report.dns = b.dns.snapshot()
+	b.report.crossOrigin, b.report.downgrades = b.crossOrigin, b.downgrades
+	if b.bandwidth != nil {
+		b.report.maxBandwidth, b.report.bandwidthBytes = b.MaxBandwidth, b.bandwidth.bytes
+	}
+	if b.rrDialer != nil {
+		b.report.resolved, b.report.resolvedConns = b.rrDialer.addrs, b.rrDialer.dist()
+	}
+	if b.h2pool != nil {
+		b.report.h2Conns = b.h2pool.stats()
+	}
+	if b.repeat != nil {
+		b.report.replayFactor, b.report.replayed = b.ReplayFactor, b.repeat.drawn
+	}
+	b.report.pipeline = b.pipeline
+	if b.cycler != nil {
+		b.report.maxConnDuration, b.report.connsCycled = b.MaxConnDuration, b.cycler.cycled
+	}
+	if b.compress != nil {
+		b.report.fallbacks = b.compress.fallbacks
+	}
+	if b.digest != nil {
+		b.report.digestChallenges = b.digest.challenges
+	}
+	if b.ntlm != nil {
+		b.report.ntlm = true
+		b.report.ntlmHandshakes, b.report.ntlmFailures = b.ntlm.handshakes, b.ntlm.failures
+	}
+	if b.oauth2 != nil {
+		b.report.oauth2 = true
+		b.report.tokenRefreshes = b.oauth2.refreshes
+	}
+	b.report.drainCancels = b.drainCancels
+	if b.SlowThreshold > 0 {
+		b.report.slowThreshold, b.report.slowCaptures = b.SlowThreshold, b.slowCaptures
+	}
+	if b.inFlight != nil {
+		b.report.maxInFlight, b.report.inFlightCap = b.inFlight.max, b.MaxInFlight
+		b.report.inFlightDropped = b.inFlight.dropped
+	}
+	b.report.finalize(total)
+	if b.targets != nil {
+		b.targets.close()
+	}
 }
 
-func (b *Work) writer() io.Writer {
-	if b.Writer == nil {
-		return os.Stdout
+// errStopped is the error of a request not made for the run being
+// stopped.
+var errStopped = errors.New("requester: run stopped")
+
+// newRequest returns the next request to make: a clone of Request,
+// pointed at t, or at the next target if t is nil and URLFile or HARFile
+// is set, with the body from BodyFunc if set and made unique with
+// CacheBust. It is recorded in DumpSequenceFile. With HARThinkTime, it
+// first waits for the next target's recorded think time, and returns
+// errStopped if the run is stopped meanwhile.
+func (b *Work) newRequest(t *target) (*http.Request, error) {
+	if t == nil && b.targets != nil {
+		var err error
+		if t, err = b.targets.next(); err != nil {
+			return nil, err
+		}
+		if b.HARThinkTime && t.wait > 0 {
+			timer := time.NewTimer(t.wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-b.stopCh:
+				return nil, errStopped
+			case <-b.ctx.Done():
+				return nil, errStopped
+			}
+		}
 	}
-	return b.Writer
+	body := b.RequestBody
+	if t != nil && t.body != nil {
+		body = t.body
+	}
+	var contentType string
+	if b.BodyFunc != nil {
+		body, contentType = b.BodyFunc(int(atomic.AddInt64(&b.bodySeq, 1) - 1))
+	}
+	if b.grpc != nil {
+		var err error
+		if body, err = b.grpc.encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req := cloneRequest(b.Request, body)
+	for k, v := range b.header {
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = append([]string(nil), v...)
+		}
+	}
+	if b.BodyFunc != nil {
+		if len(body) == 0 {
+			req.Body = nil
+		}
+		req.ContentLength = int64(len(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+	if b.grpc != nil {
+		b.grpc.prepare(req)
+	}
+	if b.multipart != nil {
+		req.Body = b.multipart.reader()
+		req.ContentLength = b.multipart.length
+		req.Header.Set("Content-Type", b.multipart.contentType())
+	}
+	if t != nil {
+		if t.method != "" {
+			req.Method = t.method
+		}
+		u := *t.url
+		req.URL = &u
+		for k, v := range t.header {
+			if k == "Content-Type" && contentType != "" {
+				continue
+			}
+			req.Header[k] = append([]string(nil), v...)
+		}
+		req.ContentLength = int64(len(body))
+		// Keep an explicit Host override, otherwise use the target's host.
+		if b.Request.URL == nil || b.Request.Host == b.Request.URL.Host {
+			req.Host = ""
+		}
+	}
+	if b.ChunkSize > 0 && len(body) > 0 {
+		// Leave GetBody unset, a partly sent body cannot be replayed.
+		req.Body = newChunkedBody(body, b.ChunkSize, b.ChunkDelay, b.stopCh)
+		req.GetBody = nil
+		req.ContentLength = -1
+		if b.ForceContentLength {
+			req.ContentLength = int64(len(body))
+		}
+	}
+	if b.ForceChunked && req.Body != nil && req.Body != http.NoBody {
+		// An unknown length makes the transport send the body chunked.
+		req.ContentLength = -1
+	}
+	if b.ContentType != "" && req.Body != nil && req.Body != http.NoBody && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", b.ContentType)
+	}
+	if b.CacheBust {
+		b.bustCache(req)
+	}
+	if b.sequence != nil {
+		b.sequence.record(req, body)
+	}
+	return req, nil
 }
 
-// Run makes all the requests, prints the summary. It blocks until
-// all work is done.
-func (b *Work) Run() {
-	b.results = make(chan *result, min(b.C*1000, maxResult))
-	b.stopCh = make(chan struct{}, b.C)
-	b.start = time.Now()
-	b.report = newReport(b.writer(), b.results, b.Output, b.N)
-	// Run the reporter first, it polls the result channel until it is closed.
-	go func() {
-		runReporter(b.report)
-	}()
-	b.runWorkers()
-	b.Finish()
+// requestID returns the ID of request num of worker for RequestIDHeader.
+func (b *Work) requestID(worker, num int) string {
+	if b.RequestIDFunc != nil {
+		return b.RequestIDFunc(worker, num)
+	}
+	return strconv.FormatInt(b.start.UnixNano(), 36) + "-" + strconv.Itoa(worker) + "-" + strconv.Itoa(num)
 }
 
-func (b *Work) Stop() {
-	// Send stop signal so that workers can stop gracefully.
-	for i := 0; i < b.C; i++ {
-		b.stopCh <- struct{}{}
+// bustCache makes req unique, as documented on Work.CacheBust.
+func (b *Work) bustCache(req *http.Request) {
+	name := b.CacheBustParam
+	if name == "" {
+		name = DefaultCacheBustParam
+	}
+	n := atomic.AddInt64(&b.cacheBustSeq, 1)
+	param := url.QueryEscape(name) + "=" + strconv.FormatInt(b.start.UnixNano(), 36) + "-" + strconv.FormatInt(n, 36)
+	// The URL may be shared with other requests.
+	u := *req.URL
+	if u.RawQuery == "" {
+		u.RawQuery = param
+	} else {
+		u.RawQuery += "&" + param
+	}
+	req.URL = &u
+	if req.Header.Get("Cache-Control") == "" {
+		req.Header.Set("Cache-Control", "no-cache")
 	}
 }
 
-func (b *Work) Finish() {
-	close(b.results)
-	total := time.Now().Sub(b.start)
-	// Wait until the reporter is done.
-	<-b.report.done
-	b.report.finalize(total)
+func (b *Work) userAgent() string {
+	if b.UserAgent == "" {
+		return DefaultUserAgent
+	}
+	return b.UserAgent
 }
 
-func (b *Work) makeRequest(c *http.Client) {
+// makeRequest makes a request and sends its result to the reporter. In
+// the open model, intended is when the request was scheduled to start.
+// tg, if set, is the target to request, as scheduled by PreserveTiming.
+func (b *Work) makeRequest(c *http.Client, worker, num int, intended time.Time, tg *target) {
+	req, err := b.newRequest(tg)
+	if err == errStopped {
+		return
+	}
+	var requestID string
+	if err == nil && b.RequestIDHeader != "" {
+		requestID = b.requestID(worker, num)
+		req.Header.Set(b.RequestIDHeader, requestID)
+	}
+	if err == nil && b.oauth2 != nil {
+		err = b.oauth2.authorize(b.ctx, req)
+	}
+	var deadline time.Duration
+	if err == nil && b.DeadlineHeader != "" {
+		deadline, err = headerDeadline(req.Header, b.DeadlineHeader)
+	}
+	if err != nil {
+		b.results <- &Result{Err: err, Start: time.Now()}
+		return
+	}
 	s := time.Now()
+	var queueDuration time.Duration
+	if !intended.IsZero() {
+		queueDuration = s.Sub(intended)
+	}
 	var size int64
 	var code int
-	var dnsStart, connStart, resStart, reqStart, delayStart time.Time
-	var dnsDuration, connDuration, resDuration, reqDuration, delayDuration time.Duration
-	req := cloneRequest(b.Request, b.RequestBody)
+	var dnsStart, connStart, tlsStart, resStart, reqStart, delayStart, headersWritten time.Time
+	var dnsDuration, connDuration, tlsDuration, resDuration, reqDuration, delayDuration, ttfbDuration, continueDuration time.Duration
+	var connReused, truncated, compressed bool
+	var bodySize, wireSize int64
+	var headerBytes, headerFields int
+	var tlsVersion, cipherSuite uint16
+	var alpn, grpcCode, encoding, family, serverName, remoteIP string
+	var events []time.Time
+	var snippet, capture, abortBody, metricBody *snippetWriter
+	var metric float64
+	var metricErr error
+	var webFrames *grpcWebFrames
+	var aborted, deadlineExceeded bool
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", b.userAgent())
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		// Ask for compression ourselves rather than letting the transport
+		// do it, as it would hide the compressed size.
+		if b.AcceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", b.AcceptEncoding)
+		} else if !b.DisableCompression {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+	}
+	if b.Expect100Continue && req.Body != nil && req.Body != http.NoBody {
+		req.Header.Set("Expect", "100-continue")
+	}
+	if b.HTTP10 {
+		req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/1.0", 1, 0
+		req.Close = true
+	}
+	// The trace hooks may be called from the transport's goroutines.
+	var mu sync.Mutex
+	var held int // connections got and not put back idle yet
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		b.pool.release(held)
+	}()
 	trace := &httptrace.ClientTrace{
 		DNSStart: func(info httptrace.DNSStartInfo) {
+			mu.Lock()
+			defer mu.Unlock()
 			dnsStart = time.Now()
 		},
 		DNSDone: func(dnsInfo httptrace.DNSDoneInfo) {
+			mu.Lock()
 			dnsDuration = time.Now().Sub(dnsStart)
+			d := dnsDuration
+			mu.Unlock()
+			b.dns.lookup(d, dnsInfo)
 		},
 		GetConn: func(h string) {
+			mu.Lock()
+			defer mu.Unlock()
 			connStart = time.Now()
 		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			tlsDuration = time.Now().Sub(tlsStart)
+		},
 		GotConn: func(connInfo httptrace.GotConnInfo) {
+			mu.Lock()
 			if !connInfo.Reused {
 				connDuration = time.Now().Sub(connStart)
 			}
+			connReused = connInfo.Reused
+			family = ipFamily(connInfo.Conn.RemoteAddr())
+			remoteIP = ipAddress(connInfo.Conn.RemoteAddr())
 			reqStart = time.Now()
+			d := connDuration
+			held++
+			b.pool.got(connInfo.Reused)
+			if !connInfo.Reused {
+				b.dns.conn(!dnsStart.IsZero())
+			}
+			mu.Unlock()
+			if b.logger != nil && !connInfo.Reused {
+				b.logger("debug", "connection established", map[string]interface{}{
+					"url":      req.URL.String(),
+					"addr":     connInfo.Conn.RemoteAddr().String(),
+					"duration": d,
+				})
+			}
+		},
+		PutIdleConn: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if held > 0 {
+				held--
+				b.pool.put(err != nil)
+			}
+		},
+		WroteHeaders: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			headersWritten = time.Now()
+		},
+		Got100Continue: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			continueDuration = time.Now().Sub(headersWritten)
 		},
 		WroteRequest: func(w httptrace.WroteRequestInfo) {
+			mu.Lock()
 			reqDuration = time.Now().Sub(reqStart)
 			delayStart = time.Now()
+			mu.Unlock()
+			if b.logger != nil {
+				b.logger("debug", "request sent", map[string]interface{}{
+					"url":    req.URL.String(),
+					"method": req.Method,
+				})
+			}
 		},
 		GotFirstResponseByte: func() {
-			delayDuration = time.Now().Sub(delayStart)
+			mu.Lock()
+			defer mu.Unlock()
 			resStart = time.Now()
+			delayDuration = resStart.Sub(delayStart)
+			ttfbDuration = resStart.Sub(reqStart)
 		},
 	}
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	ctx := b.ctx
+	if b.SSE {
+		var cancel context.CancelFunc
+		ctx, cancel = b.streamContext()
+		defer cancel()
+	}
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
 	resp, err := c.Do(req)
+	if err != nil && (b.ctx.Err() != nil || ctx.Err() == context.Canceled) {
+		// The run was canceled, not the request failed.
+		b.canceled()
+		return
+	}
+	if err != nil && deadline > 0 && ctx.Err() == context.DeadlineExceeded {
+		deadlineExceeded = true
+	}
+	if b.logger != nil {
+		if err != nil {
+			b.logger("error", "request failed", map[string]interface{}{
+				"url":   req.URL.String(),
+				"error": err,
+			})
+		} else {
+			b.logger("debug", "response received", map[string]interface{}{
+				"url":      req.URL.String(),
+				"status":   resp.StatusCode,
+				"duration": time.Now().Sub(s),
+			})
+		}
+	}
 	if err == nil {
-		size = resp.ContentLength
 		code = resp.StatusCode
-		io.Copy(ioutil.Discard, resp.Body)
+		if resp.TLS != nil {
+			tlsVersion, cipherSuite = resp.TLS.Version, resp.TLS.CipherSuite
+			alpn = resp.TLS.NegotiatedProtocol
+			serverName = resp.TLS.ServerName
+		}
+		encoding = contentEncoding(resp.Header.Get("Content-Encoding"))
+		headerBytes, headerFields = headerSize(resp.Header)
+		if !b.DiscardBodyImmediately {
+			size = resp.ContentLength
+			wire := &countingReader{r: resp.Body}
+			var body io.Reader = wire
+			if dec := decodeBody(wire, encoding); dec != nil {
+				defer dec.Close()
+				body, compressed = dec, true
+			}
+			if b.OutputErrorsOnly && resp.StatusCode >= 400 {
+				snippet = &snippetWriter{max: maxSnippet}
+				body = io.TeeReader(body, snippet)
+			}
+			if b.SlowThreshold > 0 {
+				capture = &snippetWriter{max: maxSlowCapture}
+				body = io.TeeReader(body, capture)
+			}
+			if b.AbortOnResponse != nil {
+				abortBody = &snippetWriter{max: maxAbortBody}
+				body = io.TeeReader(body, abortBody)
+			}
+			if b.ExtractMetric != nil {
+				metricBody = &snippetWriter{max: maxMetricBody}
+				body = io.TeeReader(body, metricBody)
+			}
+			if b.GRPCWeb != "" {
+				webFrames = newGRPCWebFrames(resp.Header)
+				body = io.TeeReader(body, webFrames)
+			}
+			if b.SSE {
+				bodySize, events = readEvents(body)
+			} else {
+				var watch *bodyWatch
+				if b.Timeout > 0 || deadline > 0 {
+					watch = b.watchBody(ctx, s, resp.Body)
+				}
+				bodySize, truncated = b.readBody(body)
+				timedOut := watch != nil && watch.stop()
+				if wire.err != nil {
+					// The body was cut short, such as by the connection
+					// being reset, and is not a smaller response.
+					err = &bodyError{err: wire.err, timeout: timedOut || isTimeout(wire.err)}
+				}
+			}
+			wireSize = wire.n
+		}
+		if webFrames != nil {
+			grpcCode, _ = webFrames.status(resp.Header)
+		} else if b.grpc != nil {
+			grpcCode, _ = grpcStatus(resp)
+		}
 		resp.Body.Close()
+		if b.ctx.Err() != nil {
+			// The body was cut short by the run being canceled.
+			b.canceled()
+			return
+		}
+		if deadline > 0 && ctx.Err() == context.DeadlineExceeded {
+			// The deadline passed while the body was read.
+			err, deadlineExceeded = ctx.Err(), true
+		}
+		if b.AbortOnResponse != nil {
+			aborted = b.checkAbort(resp, abortBody)
+		}
+		if metricBody != nil && err == nil {
+			metric, metricErr = b.ExtractMetric(metricBody.buf)
+		}
 	}
+	// The transport may still be writing the body if the server
+	// responded early.
+	upload, _ := req.Body.(*chunkedBody)
 	t := time.Now()
-	resDuration = t.Sub(resStart)
 	finish := t.Sub(s)
-	b.results <- &result{
-		statusCode:    code,
-		duration:      finish,
-		err:           err,
-		contentLength: size,
-		connDuration:  connDuration,
-		dnsDuration:   dnsDuration,
-		reqDuration:   reqDuration,
-		resDuration:   resDuration,
-		delayDuration: delayDuration,
+	if b.SlowThreshold > 0 && err == nil && finish > b.SlowThreshold {
+		var captured []byte
+		if capture != nil {
+			captured = capture.buf
+		}
+		b.captureSlow(req, resp, finish, captured)
+	}
+	if b.adaptive != nil {
+		b.adaptive.observe(finish, code, err)
+	}
+	mu.Lock()
+	resDuration = t.Sub(resStart)
+	res := &Result{
+		URL:           req.URL.String(),
+		StatusCode:    code,
+		Start:         s,
+		Duration:      finish,
+		Err:           err,
+		ContentLength: size,
+		ConnDuration:  connDuration,
+		DNSDuration:   dnsDuration,
+		TLSDuration:   tlsDuration,
+		ReqDuration:   reqDuration,
+		ResDuration:   resDuration,
+		DelayDuration: delayDuration,
+		TTFBDuration:  ttfbDuration,
+		QueueDuration: queueDuration,
+		BodySize:      bodySize,
+		WireSize:      wireSize,
+		HeaderBytes:   headerBytes,
+		HeaderFields:  headerFields,
+		Compressed:    compressed,
+		Encoding:      encoding,
+		Truncated:     truncated,
+		ConnReused:    connReused,
+		TLSVersion:    tlsVersion,
+		CipherSuite:   cipherSuite,
+		ALPN:          alpn,
+		IPFamily:      family,
+		RemoteIP:      remoteIP,
+		GRPCStatus:    grpcCode,
+	}
+	res.ContinueDuration = continueDuration
+	res.ServerName = serverName
+	res.RequestID = requestID
+	if tg != nil {
+		res.Target = tg.name
+	}
+	if webFrames != nil {
+		res.GRPCWebMessages, res.GRPCWebTrailers = webFrames.messages, webFrames.hasTrail
+	}
+	res.Metric, res.MetricErr = metric, metricErr
+	res.Aborted = aborted
+	res.DeadlineExceeded = deadlineExceeded
+	if snippet != nil {
+		res.BodySnippet = snippet.buf
 	}
+	if upload != nil {
+		res.UploadCutOff = !upload.complete()
+	}
+	if len(events) > 0 {
+		res.Events = len(events)
+		res.FirstEventDuration = events[0].Sub(s)
+		for i := 1; i < len(events); i++ {
+			res.EventGaps = append(res.EventGaps, events[i].Sub(events[i-1]))
+		}
+	}
+	mu.Unlock()
+	b.results <- res
 }
 
-func (b *Work) runWorker(client *http.Client, n int) {
-	var throttle <-chan time.Time
-	if b.QPS > 0 {
-		throttle = time.Tick(time.Duration(1e6/(b.QPS)) * time.Microsecond)
+// readBody discards the response body, reading at most MaxBodyBytes if
+// set, and returns the number of bytes read and whether it was truncated.
+func (b *Work) readBody(body io.Reader) (int64, bool) {
+	if b.MaxBodyBytes <= 0 {
+		n, _ := io.Copy(ioutil.Discard, body)
+		return n, false
+	}
+	// Read one byte past the limit to tell whether the body was longer.
+	n, _ := io.Copy(ioutil.Discard, io.LimitReader(body, b.MaxBodyBytes+1))
+	if n > b.MaxBodyBytes {
+		return b.MaxBodyBytes, true
 	}
+	return n, false
+}
 
-	if b.DisableRedirects {
-		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error // first error other than io.EOF
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// bodyError is the error of a response whose body could not be read to
+// the end.
+type bodyError struct {
+	err     error
+	timeout bool // the request timed out while the body was read
+}
+
+func (e *bodyError) Error() string {
+	if e.timeout {
+		return bodyReadTimeout + ": " + e.err.Error()
+	}
+	return bodyReadError + ": " + e.err.Error()
+}
+
+func (e *bodyError) Unwrap() error { return e.err }
+
+// bodyWatch closes a response body once the request times out, so that
+// a server that sends the headers and then stops sending the body cannot
+// hold the worker past the timeout, even with a Transport that does not
+// watch the context of the request.
+type bodyWatch struct {
+	done    chan struct{}
+	expired int32 // set once the body was closed
+}
+
+// watchBody watches body until the request started at s times out, by
+// Timeout or by ctx.
+func (b *Work) watchBody(ctx context.Context, s time.Time, body io.Closer) *bodyWatch {
+	w := &bodyWatch{done: make(chan struct{})}
+	go func() {
+		var timeout <-chan time.Time
+		if b.Timeout > 0 {
+			t := time.NewTimer(time.Until(s.Add(time.Duration(b.Timeout) * time.Second)))
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case <-timeout:
+		case <-ctx.Done():
+			if ctx.Err() != context.DeadlineExceeded {
+				return
+			}
+		case <-w.done:
+			return
+		}
+		atomic.StoreInt32(&w.expired, 1)
+		body.Close()
+	}()
+	return w
+}
+
+// stop stops watching the body and reports whether it was closed for
+// the request timing out.
+func (w *bodyWatch) stop() bool {
+	close(w.done)
+	return atomic.LoadInt32(&w.expired) == 1
+}
+
+// isTimeout reports whether err is a timeout, such as that of the client
+// while the body was read.
+func isTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+// maxSnippet is the size of the response body kept for failed requests.
+const maxSnippet = 256
+
+// snippetWriter keeps the first max bytes written to it.
+type snippetWriter struct {
+	buf []byte
+	max int
+}
+
+func (s *snippetWriter) Write(p []byte) (int, error) {
+	if n := s.max - len(s.buf); n > 0 {
+		s.buf = append(s.buf, p[:min(n, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// safeMakeRequest calls makeRequest, recovering from any panic so that a
+// single bad request is recorded as an error rather than aborting the run.
+func (b *Work) safeMakeRequest(c *http.Client, worker, num int, intended time.Time, tg *target) {
+	if b.inFlight != nil {
+		if !b.inFlight.acquire(b.stopCh) {
+			return
+		}
+		defer b.inFlight.release()
+	}
+	s := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "worker %d: request %d panicked: %v\n", worker, num, r)
+			if b.logger != nil {
+				b.logger("error", "request panicked", map[string]interface{}{
+					"worker":  worker,
+					"request": num,
+					"error":   r,
+				})
+			}
+			b.results <- &Result{
+				Err:      fmt.Errorf("panic: %v", r),
+				Start:    s,
+				Duration: time.Now().Sub(s),
+			}
 		}
+	}()
+	if b.WebSocket != nil {
+		b.holdWebSocket()
+		return
+	}
+	if b.HandshakeOnly {
+		b.handshake()
+		return
+	}
+	if b.raw != nil {
+		b.makeRawRequest()
+		return
+	}
+	b.makeRequest(c, worker, num, intended, tg)
+}
+
+func (b *Work) runWorker(client *http.Client, id, n int) {
+	if b.pipeline != nil {
+		b.runPipelineWorker(n)
+		return
+	}
+	var tg *target
+	if b.workerTargets != nil {
+		tg = b.workerTargets[id]
+	}
+	var throttle <-chan time.Time
+	if b.QPS > 0 {
+		ticker := time.NewTicker(time.Duration(1e6/(b.QPS)) * time.Microsecond)
+		defer ticker.Stop()
+		throttle = ticker.C
 	}
 	for i := 0; i < n; i++ {
+		if b.adaptive != nil && !b.adaptive.acquire(id, b.stopCh) {
+			return
+		}
+		if b.adaptive == nil && b.WorkStealing && atomic.AddInt64(&b.remaining, -1) < 0 {
+			return
+		}
 		// Check if application is stopped. Do not send into a closed channel.
 		select {
 		case <-b.stopCh:
 			return
 		default:
-			if b.QPS > 0 {
-				<-throttle
+		}
+		if throttle != nil {
+			// Stop while waiting for the next tick too.
+			select {
+			case <-b.stopCh:
+				return
+			case <-throttle:
 			}
-			b.makeRequest(client)
 		}
+		b.safeMakeRequest(client, id, i, time.Time{}, tg)
 	}
 }
 
-func (b *Work) runWorkers() {
-	var wg sync.WaitGroup
-	wg.Add(b.C)
+// newClient builds the HTTP client shared by all workers.
+func (b *Work) newClient() (*http.Client, error) {
+	if len(b.LocalAddrs) > 0 || b.ReuseAddr || b.IPVersion == "4" || b.IPVersion == "6" {
+		var err error
+		if b.source, err = newSourceDialer(b.LocalAddrs, b.ReuseAddr, b.IPVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.CAFile != "" {
+		var err error
+		if b.rootCAs, err = loadCAFile(b.CAFile); err != nil {
+			return nil, err
+		}
+	}
 
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+		TLSClientConfig:     b.tlsConfig(),
 		MaxIdleConnsPerHost: min(b.C, maxIdleConn),
 		DisableCompression:  b.DisableCompression,
 		DisableKeepAlives:   b.DisableKeepAlives,
 		Proxy:               http.ProxyURL(b.ProxyAddr),
+		ReadBufferSize:      b.ReadBufferSize,
+		WriteBufferSize:     b.WriteBufferSize,
+	}
+	if b.Expect100Continue {
+		tr.ExpectContinueTimeout = expectContinueTimeout
 	}
 	if b.H2 {
-		http2.ConfigureTransport(tr)
+		if err := http2.ConfigureTransport(tr); err != nil {
+			return nil, err
+		}
 	} else {
 		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
 	}
-	client := &http.Client{Transport: tr, Timeout: time.Duration(b.Timeout) * time.Second}
+	if b.source != nil || b.rrDialer != nil || b.bandwidth != nil {
+		tr.DialContext = b.dialContext()
+	}
+	if b.MaxConnDuration > 0 {
+		b.cycler = &connCycler{dial: b.dialContext(), max: b.MaxConnDuration}
+		tr.DialContext = b.cycler.DialContext
+	}
+	if b.PrewarmConns > 0 {
+		b.prewarm = newPrewarmPool(tr.TLSClientConfig, b.source)
+		tr.DialContext = b.prewarm.DialContext
+		tr.DialTLS = b.prewarm.DialTLS
+	}
+	var rt http.RoundTripper = tr
+	if b.H2Conns > 0 || b.H2MaxConcurrentStreams > 0 {
+		conns := b.H2Conns
+		if conns == 0 {
+			conns = 1
+		}
+		b.h2pool = newH2Pool(conns, b.H2MaxConcurrentStreams, tr.TLSClientConfig, b.dialContext(),
+			b.Request.URL.Scheme == "http", b.DisableCompression)
+		rt = b.h2pool
+	}
+	if b.GRPCMethod != "" && b.GRPCWeb == "" {
+		rt = b.grpcTransport(tr.TLSClientConfig)
+	}
+	if b.HTTP10 {
+		rt = &http10Transport{
+			dial: b.dialContext(),
+			tls:  tr.TLSClientConfig,
+		}
+	}
+	if b.Transport != nil {
+		rt = b.Transport
+	}
+	if b.NTLMAuth != nil {
+		b.ntlm = newNTLMTransport(tr, *b.NTLMAuth, b.C)
+		rt = b.ntlm
+	}
+	if b.CompressRequestBody {
+		b.compress = newCompressTransport(rt, b.FallbackUncompressed)
+		rt = b.compress
+	}
+	if b.DigestAuthUser != "" {
+		b.digest = newDigestTransport(rt, b.DigestAuthUser, b.DigestAuthPassword, b.C)
+		rt = b.digest
+	}
+	if b.Revalidate {
+		rt = newRevalidateTransport(rt, b.C)
+	}
+	client := &http.Client{Transport: rt, Timeout: time.Duration(b.Timeout) * time.Second}
+	if b.SSE {
+		// Streams last as long as the server keeps them open.
+		tr.ResponseHeaderTimeout, client.Timeout = client.Timeout, 0
+	}
+	if b.DisableRedirects {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	} else {
+		client.CheckRedirect = b.checkRedirect
+	}
+	return client, nil
+}
+
+// stagger waits StartupStagger for each worker started before worker id,
+// and reports whether the run was not stopped meanwhile.
+func (b *Work) stagger(id int) bool {
+	if b.StartupStagger <= 0 || id == 0 {
+		return true
+	}
+	t := time.NewTimer(time.Duration(id) * b.StartupStagger)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-b.stopCh:
+		return false
+	}
+}
+
+func (b *Work) runWorkers(client *http.Client) {
+	var wg sync.WaitGroup
+	wg.Add(b.C)
+	// Workers wait until all of them are spawned, so that the run starts
+	// once they are all ready, however long spawning many of them takes.
+	var ready sync.WaitGroup
+	ready.Add(b.C)
+	begin := make(chan struct{})
 
-	// Ignore the case where b.N % b.C != 0.
+	// The first b.N % b.C workers make one more request, so that exactly
+	// b.N requests are made.
+	n, extra := b.N/b.C, b.N%b.C
+	if b.adaptive != nil {
+		// Workers take requests from the controller as they are allowed.
+		n, extra = b.N, 0
+	} else if b.OpenModel || len(b.RateSchedule) > 0 || b.PreserveTiming {
+		schedule := make(chan scheduled)
+		for i := 0; i < b.C; i++ {
+			go func(id int) {
+				ready.Done()
+				<-begin
+				b.runOpenWorker(client, id, schedule)
+				wg.Done()
+			}(i)
+		}
+		ready.Wait()
+		b.begin(begin)
+		if b.PreserveTiming {
+			go b.dispatchReplay(schedule)
+		} else {
+			go b.dispatch(schedule)
+		}
+		wg.Wait()
+		return
+	} else if b.WorkStealing {
+		n, extra = b.N, 0
+		b.remaining = int64(b.N)
+	}
 	for i := 0; i < b.C; i++ {
-		go func() {
-			b.runWorker(client, b.N/b.C)
+		wn := n
+		if i < extra {
+			wn++
+		}
+		go func(id, n int) {
+			ready.Done()
+			<-begin
+			if b.stagger(id) {
+				b.runWorker(client, id, n)
+			}
 			wg.Done()
-		}()
+		}(i, wn)
+	}
+	ready.Wait()
+	b.begin(begin)
+	if b.adaptive != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go b.adaptive.run(b.start, done)
 	}
 	wg.Wait()
 }
 
+// begin starts the run once all the workers are ready: it records its
+// start, from which the rate of requests is computed, and releases the
+// workers and those waiting on Started.
+func (b *Work) begin(workers chan struct{}) {
+	b.start = time.Now()
+	b.report.mu.Lock()
+	b.report.start = b.start
+	b.report.mu.Unlock()
+	close(workers)
+	close(b.startedChan())
+}
+
+// Started returns a channel closed when the run starts, after the setup
+// of Run, such as PrewarmConns, is done and all the workers are ready.
+// Use it to time runs that are stopped with Stop.
+func (b *Work) Started() <-chan struct{} {
+	return b.startedChan()
+}
+
+// resetChans prepares the channels of the run for a new one, so that a
+// Work can be run again, even once stopped. The channel of Started is
+// kept if it is still open, as callers may already wait on it.
+func (b *Work) resetChans() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ran {
+		b.stopCh, b.ran = nil, false
+	}
+	select {
+	case <-b.startCh:
+		// Closed by the previous run.
+		b.startCh = nil
+	default:
+	}
+}
+
+// startedChan returns the channel returned by Started, creating it if
+// needed.
+func (b *Work) startedChan() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.startCh == nil {
+		b.startCh = make(chan struct{})
+	}
+	return b.startCh
+}
+
+// TTFBPercentiles returns the time to first byte, measured from when the
+// request started being written, at the 10th, 25th, 50th, 75th, 90th,
+// 95th and 99th percentiles of the successful requests. It returns nil
+// if Run has not completed.
+func (b *Work) TTFBPercentiles() map[int]time.Duration {
+	if b.report == nil || len(b.report.ttfbLats) == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), b.report.ttfbLats...)
+	sort.Float64s(sorted)
+	pctls := make(map[int]time.Duration)
+	for _, p := range pctlsReported {
+		pctls[p] = time.Duration(percentile(sorted, float64(p)) * float64(time.Second))
+	}
+	return pctls
+}
+
+// TLSVersionDist returns the number of responses received over each
+// negotiated TLS version, such as "TLS 1.3". Plaintext responses are not
+// counted. It returns nil before Run.
+func (b *Work) TLSVersionDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.tlsVersionDist })
+}
+
+// CipherSuiteDist returns the number of responses received with each
+// negotiated TLS cipher suite, by name. Plaintext responses are not
+// counted. It returns nil before Run.
+func (b *Work) CipherSuiteDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.cipherSuiteDist })
+}
+
+// ALPNDist returns the number of responses received over each protocol
+// negotiated with ALPN, such as "h2" or "http/1.1", or "none" for TLS
+// connections where no protocol was negotiated. Plaintext responses are
+// not counted. It returns nil before Run.
+func (b *Work) ALPNDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.alpnDist })
+}
+
+// ServerNameDist returns the number of responses received over TLS
+// connections with each server name sent (SNI), or "none" for those
+// without, such as to IP addresses. Plaintext responses are not counted.
+// It returns nil before Run.
+func (b *Work) ServerNameDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.serverNameDist })
+}
+
+// StatusClassDist returns the number of responses by status class,
+// "1xx" to "5xx". Failed requests, which got no response, are not
+// counted. It returns nil before Run.
+func (b *Work) StatusClassDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.statusClassDist() })
+}
+
+// EncodingDist returns the number of responses received with each
+// content coding, such as "gzip", "br" or "identity" for unencoded ones.
+// It returns nil before Run.
+func (b *Work) EncodingDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.encodingDist })
+}
+
+// GRPCStatusDist returns the number of gRPC calls that ended with each
+// status, such as "OK" or "NotFound", with GRPCMethod. It returns nil
+// before Run.
+func (b *Work) GRPCStatusDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.grpcStatusDist })
+}
+
+// SourceAddrDist returns the number of connections made from each of
+// LocalAddrs. It returns nil before Run.
+func (b *Work) SourceAddrDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.sourceDist })
+}
+
+// IPFamilyDist returns the number of connections made with each IP
+// version, "IPv4" or "IPv6". It returns nil before Run.
+func (b *Work) IPFamilyDist() map[string]int {
+	return b.copyDist(func(r *report) map[string]int { return r.ipFamilyDist })
+}
+
+// copyDist returns a copy of a distribution of the report.
+func (b *Work) copyDist(dist func(r *report) map[string]int) map[string]int {
+	b.mu.Lock()
+	r := b.report
+	b.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := make(map[string]int)
+	for k, v := range dist(r) {
+		d[k] = v
+	}
+	return d
+}
+
+// withValues returns ctx with the given values set.
+func withValues(ctx context.Context, values map[interface{}]interface{}) context.Context {
+	for k, v := range values {
+		ctx = context.WithValue(ctx, k, v)
+	}
+	return ctx
+}
+
 // cloneRequest returns a clone of the provided *http.Request.
 // The clone is a shallow copy of the struct and its Header map.
 func cloneRequest(r *http.Request, body []byte) *http.Request {
@@ -255,6 +2604,7 @@ func cloneRequest(r *http.Request, body []byte) *http.Request {
 	}
 	if len(body) > 0 {
 		r2.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r2.ContentLength = int64(len(body))
 	}
 	return r2
 }
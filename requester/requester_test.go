@@ -16,9 +16,18 @@ package requester
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -45,6 +54,146 @@ func TestN(t *testing.T) {
 	}
 }
 
+func TestNNotDivisibleByC(t *testing.T) {
+	tests := []struct{ n, c int }{{10, 3}, {7, 7}, {100, 7}, {5, 4}, {1000, 999}}
+	for _, tt := range tests {
+		var count int64
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&count, 1)
+		}
+		server := httptest.NewServer(http.HandlerFunc(handler))
+
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{
+			Request: req,
+			N:       tt.n,
+			C:       tt.c,
+			Writer:  ioutil.Discard,
+		}
+		w.Run()
+		server.Close()
+		if count != int64(tt.n) {
+			t.Errorf("N=%v C=%v: expected %v requests, found %v", tt.n, tt.c, tt.n, count)
+		}
+	}
+}
+
+func TestWorkStealing(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:      req,
+		N:            101,
+		C:            7,
+		WorkStealing: true,
+		Writer:       ioutil.Discard,
+	}
+	w.Run()
+	if count != 101 {
+		t.Errorf("Expected to send 101 requests, found %v", count)
+	}
+}
+
+func TestStartupStagger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	reporter := &recordingReporter{}
+	w := &Work{
+		Request:        req,
+		N:              5,
+		C:              5,
+		StartupStagger: 50 * time.Millisecond,
+		Reporter:       reporter,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reporter.results) != 5 {
+		t.Fatalf("Expected 5 results, found %v", len(reporter.results))
+	}
+	// Each worker makes a single request, 50ms after the one before.
+	var starts []time.Time
+	for _, res := range reporter.results {
+		starts = append(starts, res.Start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("Expected the workers to start 50ms apart, found a gap of %v", gap)
+		}
+	}
+}
+
+func TestStartSkew(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://127.0.0.1", nil)
+	reporter := &recordingReporter{}
+	startedAt := make(chan time.Time, 1)
+	w := &Work{
+		Request:   req,
+		N:         2000,
+		C:         2000,
+		Transport: exhaustedTransport{},
+		Reporter:  reporter,
+	}
+	go func() {
+		<-w.Started()
+		startedAt <- time.Now()
+	}()
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if started := <-startedAt; started.Before(w.start) {
+		t.Errorf("Expected Started to be closed when the run started, found %v", started)
+	}
+	// All the workers were ready when the run started, so that their
+	// requests start right away rather than as they are spawned.
+	var skew time.Duration
+	for _, res := range reporter.results {
+		if res.Start.Before(w.start) {
+			t.Fatalf("Expected requests to start after the run, found one %v before", w.start.Sub(res.Start))
+		}
+		if d := res.Start.Sub(w.start); d > skew {
+			skew = d
+		}
+	}
+	t.Logf("start skew of 2000 workers: %v", skew)
+	if skew > 500*time.Millisecond {
+		t.Errorf("Expected the workers to start together, found a skew of %v", skew)
+	}
+}
+
+func TestRunTwice(t *testing.T) {
+	var count int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 10, C: 2, Writer: ioutil.Discard}
+	for i := 0; i < 2; i++ {
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-w.Started():
+		default:
+			t.Errorf("Run %d: expected Started to be closed", i)
+		}
+	}
+	if count != 20 {
+		t.Errorf("Expected 20 requests, found %v", count)
+	}
+}
+
 func TestQps(t *testing.T) {
 	var wg sync.WaitGroup
 	var count int64
@@ -99,6 +248,9 @@ func TestRequest(t *testing.T) {
 	if uri != "/" {
 		t.Errorf("Uri is expected to be /, %v is found", uri)
 	}
+	if method != "GET" {
+		t.Errorf("Method is expected to be GET, %v is found", method)
+	}
 	if contentType != "text/html" {
 		t.Errorf("Content type is expected to be text/html, %v is found", contentType)
 	}
@@ -133,3 +285,1034 @@ func TestBody(t *testing.T) {
 		t.Errorf("Expected to work 10 times, found %v", count)
 	}
 }
+
+func TestContentType(t *testing.T) {
+	var mu sync.Mutex
+	types := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		types[r.Method+" "+r.Header.Get("Content-Type")]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	post, _ := http.NewRequest("POST", server.URL, nil)
+	get, _ := http.NewRequest("GET", server.URL, nil)
+	typed, _ := http.NewRequest("PUT", server.URL, nil)
+	typed.Header.Set("Content-Type", "text/plain")
+	for _, w := range []*Work{
+		{Request: post, RequestBody: []byte(`{"k":"v"}`), ContentType: "application/json"},
+		{Request: get, ContentType: "application/json"},
+		{Request: typed, RequestBody: []byte("v"), ContentType: "application/json"},
+		{Request: post, RequestBody: []byte("v")},
+	} {
+		w.N, w.C, w.Reporter = 2, 1, &recordingReporter{}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]int{"POST application/json": 2, "GET ": 2, "PUT text/plain": 2, "POST ": 2}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("Expected content types %v, found %v", want, types)
+	}
+}
+
+func TestHeaderFile(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "headers.txt")
+	file := "# Common headers\n\nX-Env: staging\nX-Trace: a\nx-trace: b\nAccept: text/plain\n  X-Spaced :  value  \n"
+	if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept", "application/json")
+	w := &Work{Request: req, N: 1, C: 1, HeaderFile: path, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Get("X-Env"); v != "staging" {
+		t.Errorf("Expected X-Env from the file, found %q", v)
+	}
+	if v := got["X-Trace"]; !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Errorf("Expected both X-Trace values, found %q", v)
+	}
+	if v := got.Get("X-Spaced"); v != "value" {
+		t.Errorf("Expected a trimmed X-Spaced, found %q", v)
+	}
+	// Request headers take precedence.
+	if v := got["Accept"]; !reflect.DeepEqual(v, []string{"application/json"}) {
+		t.Errorf("Expected the Accept of the request, found %q", v)
+	}
+	if len(req.Header) != 1 {
+		t.Errorf("Expected the request headers to be left alone, found %v", req.Header)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("X-Env staging\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w = &Work{Request: req, N: 1, C: 1, HeaderFile: path, Reporter: &recordingReporter{}}
+	if err := w.Run(); err == nil || !strings.Contains(err.Error(), ":1: invalid header") {
+		t.Errorf("Expected an invalid header error, found %v", err)
+	}
+}
+
+func TestBodyFunc(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string]int)
+	var contentTypes []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies[string(body)]++
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+		mu.Unlock()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	req.Header.Set("Content-Type", "text/plain")
+	w := &Work{
+		Request:     req,
+		RequestBody: []byte("Body"),
+		BodyFunc: func(reqNum int) ([]byte, string) {
+			return []byte(fmt.Sprintf(`{"n":%d}`, reqNum)), "application/json"
+		},
+		N:      20,
+		C:      4,
+		Writer: ioutil.Discard,
+	}
+	w.Run()
+	for i := 0; i < 20; i++ {
+		body := fmt.Sprintf(`{"n":%d}`, i)
+		if bodies[body] != 1 {
+			t.Errorf("Expected body %v to be sent once, found %v", body, bodies[body])
+		}
+	}
+	if len(bodies) != 20 {
+		t.Errorf("Expected 20 distinct bodies, found %v", len(bodies))
+	}
+	for _, ct := range contentTypes {
+		if ct != "application/json" {
+			t.Errorf("Content-Type is expected to be application/json, %v is found", ct)
+		}
+	}
+	if req.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected Request to be left unchanged, found %v", req.Header)
+	}
+}
+
+func TestCustomMethods(t *testing.T) {
+	for _, m := range []string{"PROPFIND", "PURGE", "QUERY"} {
+		var mu sync.Mutex
+		var methods, bodies []string
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			methods = append(methods, r.Method)
+			bodies = append(bodies, string(body))
+			mu.Unlock()
+		}
+		server := httptest.NewServer(http.HandlerFunc(handler))
+
+		req, _ := http.NewRequest(m, server.URL, nil)
+		w := &Work{
+			Request:     req,
+			RequestBody: []byte("Body"),
+			N:           2,
+			C:           1,
+		}
+		w.Run()
+		server.Close()
+		if len(methods) != 2 {
+			t.Fatalf("Expected 2 %v requests, found %v", m, len(methods))
+		}
+		for i := range methods {
+			if methods[i] != m {
+				t.Errorf("Method is expected to be %v, %v is found", m, methods[i])
+			}
+			if bodies[i] != "Body" {
+				t.Errorf("Body is expected to be Body, %v is found", bodies[i])
+			}
+		}
+	}
+}
+
+func TestCacheBust(t *testing.T) {
+	var mu sync.Mutex
+	var queries []url.Values
+	var cacheControl []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		cacheControl = append(cacheControl, r.Header.Get("Cache-Control"))
+		mu.Unlock()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	for _, param := range []string{"", "nocache"} {
+		queries, cacheControl = nil, nil
+		req, _ := http.NewRequest("GET", server.URL+"/?a=1&b=x%20y", nil)
+		w := &Work{
+			Request:        req,
+			N:              10,
+			C:              2,
+			CacheBust:      true,
+			CacheBustParam: param,
+			Writer:         ioutil.Discard,
+		}
+		w.Run()
+		if param == "" {
+			param = DefaultCacheBustParam
+		}
+		seen := make(map[string]bool)
+		for i, q := range queries {
+			if q.Get("a") != "1" || q.Get("b") != "x y" {
+				t.Errorf("Expected the existing parameters to be kept, found %v", q)
+			}
+			v := q.Get(param)
+			if v == "" || seen[v] {
+				t.Errorf("Expected a unique %v parameter, found %q", param, v)
+			}
+			seen[v] = true
+			if cacheControl[i] != "no-cache" {
+				t.Errorf("Cache-Control is expected to be no-cache, %v is found", cacheControl[i])
+			}
+		}
+		if req.URL.RawQuery != "a=1&b=x%20y" {
+			t.Errorf("Expected Request to be left unchanged, found %v", req.URL)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var ua string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 1, C: 1}
+	w.Run()
+	if ua != DefaultUserAgent {
+		t.Errorf("User-Agent is expected to be %v, %v is found", DefaultUserAgent, ua)
+	}
+
+	w = &Work{Request: req, N: 1, C: 1, UserAgent: "custom/1.0"}
+	w.Run()
+	if ua != "custom/1.0" {
+		t.Errorf("User-Agent is expected to be custom/1.0, %v is found", ua)
+	}
+
+	req.Header.Set("User-Agent", "override/2.0")
+	w = &Work{Request: req, N: 1, C: 1, UserAgent: "custom/1.0"}
+	w.Run()
+	if ua != "override/2.0" {
+		t.Errorf("User-Agent is expected to be override/2.0, %v is found", ua)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/big" {
+			w.Write(bytes.Repeat([]byte("a"), 1<<20))
+		} else {
+			w.Write([]byte("small"))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		path      string
+		truncated int64
+	}{
+		{"/big", 4},
+		{"/small", 0},
+	} {
+		req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+		w := &Work{
+			Request:      req,
+			N:            4,
+			C:            1,
+			MaxBodyBytes: 1024,
+		}
+		w.Run()
+		if got := w.report.numTruncated; got != tt.truncated {
+			t.Errorf("%s: expected %v truncated responses, found %v", tt.path, tt.truncated, got)
+		}
+	}
+}
+
+func TestBodyReadError(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reset" {
+			// Promise more than is sent, then drop the connection.
+			w.Header().Set("Content-Length", "1000")
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("complete"))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	for _, raw := range []bool{false, true} {
+		for _, tt := range []struct {
+			path   string
+			errors int
+		}{
+			{"/reset", 4},
+			{"/complete", 0},
+		} {
+			req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+			w := &Work{Request: req, N: 4, C: 1, RawMode: raw, Writer: ioutil.Discard}
+			if err := w.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.report.errorDist[bodyReadError]; got != tt.errors {
+				t.Errorf("%s (raw %v): expected %v body read errors, found %v", tt.path, raw, tt.errors, w.report.errorDist)
+			}
+		}
+	}
+}
+
+func TestBodyReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Send the headers and part of the body, then hang.
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("12345"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	defer close(release)
+
+	for _, raw := range []bool{false, true} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{Request: req, N: 2, C: 2, Timeout: 1, RawMode: raw, Writer: ioutil.Discard}
+		start := time.Now()
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("raw %v: expected the body reads to time out, the run took %v", raw, elapsed)
+		}
+		if got := w.report.errorDist[bodyReadTimeout]; got != 2 {
+			t.Errorf("raw %v: expected 2 body read timeouts, found %v", raw, w.report.errorDist)
+		}
+	}
+}
+
+func benchmarkBody(b *testing.B, discard bool) {
+	body := bytes.Repeat([]byte("a"), 1<<20)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	b.ResetTimer()
+	w := &Work{
+		Request:                req,
+		N:                      b.N,
+		C:                      1,
+		DiscardBodyImmediately: discard,
+		Writer:                 ioutil.Discard,
+	}
+	w.Run()
+}
+
+func BenchmarkReadBody(b *testing.B)    { benchmarkBody(b, false) }
+func BenchmarkDiscardBody(b *testing.B) { benchmarkBody(b, true) }
+
+func TestBufferSizes(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	w := &Work{Request: req, N: 1, C: 1, ReadBufferSize: 1 << 16, WriteBufferSize: 1 << 15}
+	c, err := w.newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, ok := c.Transport.(*http.Transport)
+	if !ok || tr.ReadBufferSize != 1<<16 || tr.WriteBufferSize != 1<<15 {
+		t.Errorf("Expected a transport with 64KB and 32KB buffers, found %#v", c.Transport)
+	}
+}
+
+func benchmarkBufferSize(b *testing.B, size int) {
+	body := bytes.Repeat([]byte("a"), 1<<20)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	w := &Work{
+		Request:        req,
+		N:              b.N,
+		C:              1,
+		ReadBufferSize: size,
+		Writer:         ioutil.Discard,
+	}
+	w.Run()
+}
+
+func BenchmarkReadBuffer4K(b *testing.B)   { benchmarkBufferSize(b, 4<<10) }
+func BenchmarkReadBuffer64K(b *testing.B)  { benchmarkBufferSize(b, 64<<10) }
+func BenchmarkReadBuffer256K(b *testing.B) { benchmarkBufferSize(b, 256<<10) }
+
+func TestAcceptEncoding(t *testing.T) {
+	plain := strings.Repeat("hey ", 1000)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(plain))
+	gz.Close()
+	compressed := buf.Bytes()
+
+	var mu sync.Mutex
+	var encodings []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		encodings = append(encodings, r.Header.Get("Accept-Encoding"))
+		mu.Unlock()
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed)
+			return
+		}
+		w.Write([]byte(plain))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	tests := []struct {
+		acceptEncoding     string
+		disableCompression bool
+		header             string
+		wire               int
+	}{
+		{"", false, "gzip", len(compressed)},
+		{"gzip, br", false, "gzip, br", len(compressed)},
+		{"", true, "", len(plain)},
+		{"identity", false, "identity", len(plain)},
+	}
+	for _, tt := range tests {
+		encodings = nil
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{
+			Request:            req,
+			N:                  2,
+			C:                  1,
+			AcceptEncoding:     tt.acceptEncoding,
+			DisableCompression: tt.disableCompression,
+			Writer:             ioutil.Discard,
+		}
+		w.Run()
+		for _, e := range encodings {
+			if e != tt.header {
+				t.Errorf("Accept-Encoding is expected to be %q, %q is found", tt.header, e)
+			}
+		}
+		if got := w.report.wireTotal; got != int64(2*tt.wire) {
+			t.Errorf("%q: expected %v bytes on the wire, found %v", tt.header, 2*tt.wire, got)
+		}
+		if got := w.report.decodedTotal; got != int64(2*len(plain)) {
+			t.Errorf("%q: expected %v decoded bytes, found %v", tt.header, 2*len(plain), got)
+		}
+	}
+}
+
+func TestTTFBPercentiles(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.(http.Flusher).Flush()
+		// The body takes a while to arrive after the first byte.
+		time.Sleep(30 * time.Millisecond)
+		w.Write([]byte("done"))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 4, C: 2}
+	if w.TTFBPercentiles() != nil {
+		t.Errorf("Expected no TTFB percentiles before running")
+	}
+	w.Run()
+	pctls := w.TTFBPercentiles()
+	if len(pctls) != 7 {
+		t.Fatalf("Expected 7 TTFB percentiles, found %v", len(pctls))
+	}
+	if p50 := pctls[50]; p50 < 20*time.Millisecond || p50 >= 50*time.Millisecond {
+		t.Errorf("Expected median TTFB between 20ms and 50ms, found %v", p50)
+	}
+}
+
+func TestStop(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+		time.Sleep(time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       100000,
+		C:       2,
+		Writer:  ioutil.Discard,
+	}
+	go func() {
+		for atomic.LoadInt64(&count) < 10 {
+			time.Sleep(time.Millisecond)
+		}
+		for i := 0; i < 3; i++ {
+			w.Stop()
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		w.Run()
+		// Stopping a finished run must not block either.
+		w.Stop()
+		w.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+	if n := w.report.numRes; n >= 100000 {
+		t.Errorf("Expected the run to stop early, found %v requests", n)
+	}
+
+	// The next run is not stopped by the previous Stop.
+	w.N = 10
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := w.report.numRes; n != 10 {
+		t.Errorf("Expected 10 requests after Stop, found %v", n)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	var arrived int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// The first request completes within the drain window, the
+		// second does not.
+		d := 100 * time.Millisecond
+		if atomic.AddInt64(&arrived, 1) > 1 {
+			d = 10 * time.Second
+		}
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	reporter := &recordingReporter{}
+	w := &Work{
+		Request:      req,
+		N:            2,
+		C:            2,
+		DrainTimeout: time.Second,
+		Reporter:     reporter,
+	}
+	go func() {
+		for atomic.LoadInt64(&arrived) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		w.Stop()
+	}()
+	s := time.Now()
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(s); d > 5*time.Second {
+		t.Errorf("Expected the slow request to be canceled, found a run of %v", d)
+	}
+	if len(reporter.results) != 1 || reporter.results[0].Err != nil {
+		t.Errorf("Expected the fast request to be reported, found %+v", reporter.results)
+	}
+	if w.report.drainCancels != 1 {
+		t.Errorf("Expected 1 canceled request, found %v", w.report.drainCancels)
+	}
+}
+
+func TestStopThrottled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       100,
+		C:       5,
+		QPS:     0.2,
+		Writer:  ioutil.Discard,
+	}
+	time.AfterFunc(100*time.Millisecond, w.Stop)
+	start := time.Now()
+	w.Run()
+	// Workers waiting on the 5s throttle must all stop right away.
+	if d := time.Now().Sub(start); d > 2*time.Second {
+		t.Errorf("Expected workers to stop promptly, took %v", d)
+	}
+}
+
+func TestTLSDuration(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:           req,
+		N:                 4,
+		C:                 2,
+		DisableKeepAlives: true,
+		Writer:            &out,
+	}
+	w.Run()
+	if len(w.report.tlsLats) != 4 {
+		t.Fatalf("Expected 4 TLS durations, found %v", len(w.report.tlsLats))
+	}
+	for _, d := range w.report.tlsLats {
+		if d <= 0 {
+			t.Errorf("Expected a TLS handshake duration, found %v", d)
+		}
+	}
+	if !strings.Contains(out.String(), "TLS handshake distribution:") {
+		t.Errorf("Expected the TLS handshake distribution in %q", out.String())
+	}
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	out.Reset()
+	req, _ = http.NewRequest("GET", plain.URL, nil)
+	w = &Work{Request: req, N: 2, C: 1, Writer: &out}
+	w.Run()
+	if strings.Contains(out.String(), "TLS handshake") {
+		t.Errorf("Expected no TLS handshake details for http, found %q", out.String())
+	}
+}
+
+func TestTLSDist(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 4, C: 2, Writer: ioutil.Discard}
+	if w.TLSVersionDist() != nil || w.CipherSuiteDist() != nil {
+		t.Errorf("Expected no TLS distributions before running")
+	}
+	w.Run()
+	if got := w.TLSVersionDist(); len(got) != 1 || got["TLS 1.2"] != 4 {
+		t.Errorf("Expected 4 TLS 1.2 responses, found %v", got)
+	}
+	if got := w.CipherSuiteDist(); len(got) != 1 || got["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"] != 4 {
+		t.Errorf("Expected 4 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 responses, found %v", got)
+	}
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	req, _ = http.NewRequest("GET", plain.URL, nil)
+	w = &Work{Request: req, N: 2, C: 1, Writer: ioutil.Discard}
+	w.Run()
+	if got := w.TLSVersionDist(); len(got) != 0 {
+		t.Errorf("Expected no TLS versions for http, found %v", got)
+	}
+}
+
+func TestALPNDist(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tt := range []struct {
+		h2   bool
+		want string
+	}{{true, "h2"}, {false, "none"}} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{Request: req, N: 2, C: 1, H2: tt.h2, Writer: ioutil.Discard}
+		if w.ALPNDist() != nil {
+			t.Errorf("Expected no ALPN distribution before running")
+		}
+		w.Run()
+		if got := w.ALPNDist(); len(got) != 1 || got[tt.want] != 2 {
+			t.Errorf("H2 %v: expected 2 %v responses, found %v", tt.h2, tt.want, got)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&count, 1) > 5 {
+			// Hang until the run is canceled.
+			<-r.Context().Done()
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for atomic.LoadInt64(&count) <= 5 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       100,
+		C:       1,
+		Writer:  ioutil.Discard,
+	}
+	done := make(chan error)
+	go func() {
+		done <- w.RunContext(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, found %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return after cancel")
+	}
+	if n := w.report.numRes; n != 5 {
+		t.Errorf("Expected 5 completed requests, found %v", n)
+	}
+	if len(w.report.errorDist) > 0 {
+		t.Errorf("Expected no errors, found %v", w.report.errorDist)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+	defer server.Close()
+
+	for _, tt := range []struct {
+		url  string
+		want map[string]int
+	}{
+		{server.URL, map[string]int{"debug connection established": 1, "debug request sent": 4, "debug response received": 4}},
+		{closed.URL, map[string]int{"error request failed": 4}},
+	} {
+		var mu sync.Mutex
+		got := make(map[string]int)
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		w := &Work{
+			Request: req,
+			N:       4,
+			C:       1,
+			Writer:  ioutil.Discard,
+			Logger: func(level, msg string, fields map[string]interface{}) {
+				mu.Lock()
+				defer mu.Unlock()
+				got[level+" "+msg]++
+				if fields["url"] != tt.url {
+					t.Errorf("Expected the url field to be %v, found %v", tt.url, fields["url"])
+				}
+			},
+		}
+		w.Run()
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expected log messages %v, found %v", tt.want, got)
+		}
+	}
+}
+
+func TestStatusClassDist(t *testing.T) {
+	codes := []int{200, 204, 404, 500}
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(codes[(atomic.AddInt64(&count, 1)-1)%4])
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 8, C: 1, Writer: &out}
+	w.Run()
+	want := map[string]int{"2xx": 4, "4xx": 2, "5xx": 2}
+	if got := w.StatusClassDist(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected status classes %v, found %v", want, got)
+	}
+	for _, s := range []string{"Success rate:\t50.0%", "[4xx]\t2 responses"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected %q in the output, found %v", s, out.String())
+		}
+	}
+}
+
+func TestNoResults(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	for _, output := range []string{"", "json"} {
+		var out bytes.Buffer
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{Request: req, N: 10, C: 2, Output: output, Writer: &out}
+		// Stopped before it starts, the run collects no results.
+		w.Stop()
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if output == "" && out.String() != "No results collected.\n" {
+			t.Errorf("Expected no results to be reported, found %q", out.String())
+		}
+		if strings.Contains(out.String(), "NaN") {
+			t.Errorf("%q: unexpected NaN in the output: %v", output, out.String())
+		}
+	}
+	if count != 0 {
+		t.Errorf("Expected no requests, found %v", count)
+	}
+}
+
+func TestSingleResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	for _, output := range []string{"", "json"} {
+		var out bytes.Buffer
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		w := &Work{Request: req, N: 1, C: 1, Output: output, Writer: &out}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out.String(), "NaN") || !strings.Contains(out.String(), "verage") {
+			t.Errorf("%q: expected a summary without NaN, found %v", output, out.String())
+		}
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	relative, _ := http.NewRequest("GET", "/path", nil)
+	badDeadline, _ := http.NewRequest("GET", "http://example.com", nil)
+	badDeadline.Header.Set("X-Deadline", "soon")
+	ftpReq, _ := http.NewRequest("GET", "ftp://example.com/file", nil)
+	proxy, _ := url.Parse("localhost:8080")
+	extract := func([]byte) (float64, error) { return 0, nil }
+	target := Target{URL: req.URL, C: 1}
+	tests := []struct {
+		name string
+		w    *Work
+	}{
+		{"no request", &Work{N: 1, C: 1}},
+		{"relative url", &Work{Request: relative, N: 1, C: 1}},
+		{"zero n", &Work{Request: req, C: 1}},
+		{"zero c", &Work{Request: req, N: 1}},
+		{"n less than c", &Work{Request: req, N: 1, C: 2}},
+		{"negative qps", &Work{Request: req, N: 1, C: 1, QPS: -1}},
+		{"negative timeout", &Work{Request: req, N: 1, C: 1, Timeout: -1}},
+		{"open model without qps", &Work{Request: req, N: 1, C: 1, OpenModel: true}},
+		{"omission correction without qps", &Work{Request: req, N: 1, C: 1, CorrectOmission: true}},
+		{"bad output", &Work{Request: req, N: 1, C: 1, Output: "xml"}},
+		{"preserve timing without targets", &Work{Request: req, N: 1, C: 1, PreserveTiming: true}},
+		{"preserve timing with qps", &Work{Request: req, N: 1, C: 1, HARFile: "x.har", PreserveTiming: true, QPS: 1}},
+		{"negative time scale", &Work{Request: req, N: 1, C: 1, TimeScale: -1}},
+		{"revalidate with cache bust", &Work{Request: req, N: 1, C: 1, Revalidate: true, CacheBust: true}},
+		{"decreasing histogram buckets", &Work{Request: req, N: 1, C: 1, HistogramBuckets: []time.Duration{time.Second, time.Millisecond}}},
+		{"negative chunk size", &Work{Request: req, N: 1, C: 1, ChunkSize: -1}},
+		{"chunk size with http10", &Work{Request: req, N: 1, C: 1, ChunkSize: 10, HTTP10: true}},
+		{"force content length and chunked", &Work{Request: req, N: 1, C: 1, ForceContentLength: true, ForceChunked: true}},
+		{"ntlm without user", &Work{Request: req, N: 1, C: 1, NTLMAuth: &NTLMAuth{Password: "secret"}}},
+		{"ntlm with h2", &Work{Request: req, N: 1, C: 1, NTLMAuth: &NTLMAuth{User: "user"}, H2: true}},
+		{"invalid ip version", &Work{Request: req, N: 1, C: 1, IPVersion: "5"}},
+		{"empty circuit breaker window", &Work{Request: req, N: 1, C: 1, CircuitBreaker: &CircuitBreaker{ErrorRate: 0.5}}},
+		{"negative slow threshold", &Work{Request: req, N: 1, C: 1, SlowThreshold: -time.Second, SlowDumpDir: "slow"}},
+		{"slow threshold without dir", &Work{Request: req, N: 1, C: 1, SlowThreshold: time.Second}},
+		{"negative drain timeout", &Work{Request: req, N: 1, C: 1, DrainTimeout: -time.Second}},
+		{"expect continue with http10", &Work{Request: req, N: 1, C: 1, Expect100Continue: true, HTTP10: true}},
+		{"max conn duration with h2", &Work{Request: req, N: 1, C: 1, MaxConnDuration: time.Second, H2: true}},
+		{"startup stagger with open model", &Work{Request: req, N: 1, C: 1, QPS: 1, StartupStagger: time.Millisecond, OpenModel: true}},
+		{"deadline header with sse", &Work{Request: req, N: 1, C: 1, DeadlineHeader: "X-Deadline", SSE: true}},
+		{"invalid deadline header", &Work{Request: badDeadline, N: 1, C: 1, DeadlineHeader: "X-Deadline"}},
+		{"negative show slowest", &Work{Request: req, N: 1, C: 1, ShowSlowest: -1}},
+		{"h2 conns without h2", &Work{Request: req, N: 1, C: 1, H2Conns: 2}},
+		{"raw mode with h2", &Work{Request: req, N: 1, C: 1, RawMode: true, H2: true}},
+		{"raw mode with body func", &Work{Request: req, N: 1, C: 1, RawMode: true, BodyFunc: func(int) ([]byte, string) { return nil, "" }}},
+		{"raw mode with ftp url", &Work{Request: ftpReq, N: 1, C: 1, RawMode: true}},
+		{"negative pipeline depth", &Work{Request: req, N: 1, C: 1, RawMode: true, PipelineDepth: -1}},
+		{"pipeline without raw mode", &Work{Request: req, N: 1, C: 1, PipelineDepth: 2}},
+		{"pipeline with qps", &Work{Request: req, N: 1, C: 1, RawMode: true, PipelineDepth: 2, QPS: 10}},
+		{"grpc web without grpc", &Work{Request: req, N: 1, C: 1, GRPCWeb: "text"}},
+		{"invalid grpc web", &Work{Request: req, N: 1, C: 1, GRPCMethod: "grpc.health.v1.Health/Check", GRPCWeb: "json"}},
+		{"negative max consecutive failures", &Work{Request: req, N: 1, C: 1, MaxConsecutiveFailures: -1}},
+		{"negative replay factor", &Work{Request: req, N: 1, C: 1, ReplayFactor: -1}},
+		{"replay factor without targets", &Work{Request: req, N: 1, C: 1, ReplayFactor: 2}},
+		{"negative read buffer", &Work{Request: req, N: 1, C: 1, ReadBufferSize: -1}},
+		{"extract metric with discarded body", &Work{Request: req, N: 1, C: 1, ExtractMetric: extract, DiscardBodyImmediately: true}},
+		{"extract metric with sse", &Work{Request: req, N: 1, C: 1, ExtractMetric: extract, SSE: true}},
+		{"extract metric in raw mode", &Work{Request: req, N: 1, C: 1, ExtractMetric: extract, RawMode: true}},
+		{"targets not summing to c", &Work{Request: req, N: 2, C: 2, Targets: []Target{target}}},
+		{"target without url", &Work{Request: req, N: 1, C: 1, Targets: []Target{{C: 1}}}},
+		{"duplicate targets", &Work{Request: req, N: 2, C: 2, Targets: []Target{target, target}}},
+		{"targets with work stealing", &Work{Request: req, N: 1, C: 1, Targets: []Target{target}, WorkStealing: true}},
+		{"compressed chunked body", &Work{Request: req, N: 1, C: 1, CompressRequestBody: true, ChunkSize: 10}},
+		{"fallback without compression", &Work{Request: req, N: 1, C: 1, FallbackUncompressed: true}},
+		{"dns round robin with url file", &Work{Request: req, N: 1, C: 1, DNSRoundRobin: true, URLFile: "targets.txt"}},
+		{"dns round robin with proxy", &Work{Request: req, N: 1, C: 1, DNSRoundRobin: true, ProxyAddr: proxy}},
+		{"negative max bandwidth", &Work{Request: req, N: 1, C: 1, MaxBandwidth: -1}},
+		{"max bandwidth with prewarm", &Work{Request: req, N: 1, C: 1, MaxBandwidth: 1000, PrewarmConns: 1}},
+		{"request id header in raw mode", &Work{Request: req, N: 1, C: 1, RequestIDHeader: "X-Request-ID", RawMode: true}},
+		{"forbid downgrades without redirects", &Work{Request: req, N: 1, C: 1, NoDowngradeRedirects: true, DisableRedirects: true}},
+		{"negative apdex target", &Work{Request: req, N: 1, C: 1, ApdexTarget: -time.Second}},
+		{"nil context value key", &Work{Request: req, N: 1, C: 1, ContextValues: map[interface{}]interface{}{nil: "x"}}},
+		{"handshake only with proxy", &Work{Request: req, N: 1, C: 1, HandshakeOnly: true, ProxyAddr: &url.URL{Host: "localhost:8080"}}},
+		{"oauth2 without token url", &Work{Request: req, N: 1, C: 1, OAuth2: &OAuth2{ClientID: "hey"}}},
+		{"bad proxy", &Work{Request: req, N: 1, C: 1, ProxyAddr: proxy}},
+		{"websocket with http10", &Work{Request: req, N: 1, C: 1, HTTP10: true, WebSocket: &WebSocket{}}},
+		{"negative websocket hold", &Work{Request: req, N: 1, C: 1, WebSocket: &WebSocket{Hold: -1}}},
+	}
+	for _, tt := range tests {
+		if err := tt.w.Run(); err == nil {
+			t.Errorf("%s: expected an error, found none", tt.name)
+		}
+	}
+}
+
+type panickingTransport struct {
+	count int64
+}
+
+func (t *panickingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.AddInt64(&t.count, 1)%2 == 0 {
+		panic("boom")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, int64(1))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:   req,
+		N:         10,
+		C:         1,
+		Transport: &panickingTransport{},
+	}
+	w.Run()
+	if count != 5 {
+		t.Errorf("Expected 5 requests to reach the server, found %v", count)
+	}
+	if got := w.report.errorDist["panic: boom"]; got != 5 {
+		t.Errorf("Expected 5 recorded panics, found %v", got)
+	}
+}
+
+type correlationKey struct{}
+
+// valueTransport counts the requests whose context has the correlation
+// ID.
+type valueTransport struct {
+	count int64
+}
+
+func (t *valueTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id, _ := req.Context().Value(correlationKey{}).(string); id == "run-1" {
+		atomic.AddInt64(&t.count, 1)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestContextValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	tr := &valueTransport{}
+	w := &Work{
+		Request:       req,
+		N:             10,
+		C:             2,
+		Transport:     tr,
+		ContextValues: map[interface{}]interface{}{correlationKey{}: "run-1"},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.count != 10 {
+		t.Errorf("Expected the value in the context of 10 requests, found %v", tr.count)
+	}
+}
+
+// benchmarkBimodal runs requests against a server where one request in
+// ten is slow, with or without work stealing.
+func benchmarkBimodal(b *testing.B, stealing bool) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&count, 1)%10 == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := &Work{
+			Request:      req,
+			N:            200,
+			C:            10,
+			WorkStealing: stealing,
+			Writer:       ioutil.Discard,
+		}
+		w.Run()
+	}
+}
+
+func BenchmarkStaticDivision(b *testing.B) { benchmarkBimodal(b, false) }
+func BenchmarkWorkStealing(b *testing.B)   { benchmarkBimodal(b, true) }
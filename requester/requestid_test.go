@@ -0,0 +1,127 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRequestIDHeader(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+	failed := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := r.Header.Get("X-Request-ID")
+		ids = append(ids, id)
+		if len(ids)%4 == 0 {
+			failed[id] = true
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	for _, output := range []string{"", "json"} {
+		ids, failed = nil, make(map[string]bool)
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		var out bytes.Buffer
+		w := &Work{Request: req, N: 20, C: 2, Output: output, OutputErrorsOnly: true, Writer: &out, RequestIDHeader: "X-Request-ID"}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		unique := make(map[string]bool)
+		for _, id := range ids {
+			unique[id] = true
+		}
+		if len(unique) != 20 || unique[""] {
+			t.Errorf("%q: expected 20 unique IDs, found %v", output, ids)
+		}
+		var reported []string
+		if output == "json" {
+			for _, l := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				var row errorRow
+				if err := json.Unmarshal([]byte(l), &row); err != nil {
+					t.Fatal(err)
+				}
+				reported = append(reported, row.ID)
+			}
+		} else {
+			records, err := csv.NewReader(&out).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if records[0][5] != "request_id" {
+				t.Fatalf("Expected a request_id column, found %v", records[0])
+			}
+			for _, r := range records[1:] {
+				reported = append(reported, r[5])
+			}
+		}
+		if len(reported) != 5 {
+			t.Fatalf("%q: expected 5 failures, found %v", output, reported)
+		}
+		for _, id := range reported {
+			if !failed[id] {
+				t.Errorf("%q: reported ID %q of a request that did not fail", output, id)
+			}
+		}
+	}
+}
+
+func TestRequestIDFunc(t *testing.T) {
+	var mu sync.Mutex
+	ids := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		ids[r.Header.Get("X-Trace")] = true
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	rec := &recordingReporter{}
+	w := &Work{
+		Request:         req,
+		N:               4,
+		C:               2,
+		Reporter:        rec,
+		RequestIDHeader: "X-Trace",
+		RequestIDFunc: func(worker, n int) string {
+			return fmt.Sprintf("w%d-r%d", worker, n)
+		},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"w0-r0", "w0-r1", "w1-r0", "w1-r1"} {
+		if !ids[id] {
+			t.Errorf("Expected request %s, found %v", id, ids)
+		}
+	}
+	for _, res := range rec.results {
+		if !ids[res.RequestID] {
+			t.Errorf("Expected the result to have the ID sent, found %q", res.RequestID)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import "net/http"
+
+// revalidateTransport makes requests conditional on the validators of
+// earlier responses, to exercise cache revalidation: once a response to
+// a URL carried an ETag or a Last-Modified date, the next requests to it
+// send If-None-Match or If-Modified-Since.
+type revalidateTransport struct {
+	rt http.RoundTripper
+
+	// idle holds the validators of requests that are done, for the next
+	// ones, so that each worker revalidates what it fetched itself.
+	idle chan validators
+}
+
+// validators are the validators of the responses to each URL.
+type validators map[string]validator
+
+type validator struct {
+	etag, lastModified string
+}
+
+func newRevalidateTransport(rt http.RoundTripper, c int) *revalidateTransport {
+	return &revalidateTransport{rt: rt, idle: make(chan validators, c)}
+}
+
+func (t *revalidateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var vs validators
+	select {
+	case vs = <-t.idle:
+	default:
+		vs = make(validators)
+	}
+	defer func() {
+		select {
+		case t.idle <- vs:
+		default:
+		}
+	}()
+	key := req.URL.String()
+	if v, ok := vs[key]; ok {
+		// Leave conditions set on Request alone.
+		if req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+			r := req.Clone(req.Context())
+			if v.etag != "" {
+				r.Header.Set("If-None-Match", v.etag)
+			}
+			if v.lastModified != "" {
+				r.Header.Set("If-Modified-Since", v.lastModified)
+			}
+			req = r
+		}
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		v := validator{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
+		if v.etag != "" || v.lastModified != "" {
+			vs[key] = v
+		} else {
+			delete(vs, key)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRevalidate(t *testing.T) {
+	modified := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	var conditional int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			atomic.AddInt64(&conditional, 1)
+		}
+		if r.URL.Path == "/etag" {
+			w.Header().Set("ETag", `"v1"`)
+		}
+		http.ServeContent(w, r, "", modified, strings.NewReader("content"))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL+"/etag", nil)
+	w := &Work{Request: req, N: 10, C: 1, Revalidate: true, Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.report.statusCodeDist[http.StatusOK] != 1 || w.report.statusCodeDist[http.StatusNotModified] != 9 {
+		t.Errorf("Expected 1 full and 9 not modified responses, found %v", w.report.statusCodeDist)
+	}
+	if conditional != 9 {
+		t.Errorf("Expected 9 requests with If-None-Match, found %v", conditional)
+	}
+	if !strings.Contains(out.String(), "Not modified:\t90.0%") {
+		t.Errorf("Expected the 304 ratio in the output, found %v", out.String())
+	}
+
+	// Last-Modified alone is revalidated with If-Modified-Since.
+	req, _ = http.NewRequest("GET", server.URL+"/date", nil)
+	w = &Work{Request: req, N: 4, C: 2, Revalidate: true, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.report.statusCodeDist[http.StatusNotModified] < 2 {
+		t.Errorf("Expected revalidated responses, found %v", w.report.statusCodeDist)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// lookupIP resolves the host of DNSRoundRobin. Tests replace it.
+var lookupIP = net.DefaultResolver.LookupIP
+
+// roundRobinDialer dials the connections to a host with several
+// addresses to each of them in turn, rather than to the first that
+// answers as the default dialer does.
+type roundRobinDialer struct {
+	host   string
+	addrs  []string
+	counts []int64 // connections dialed to each address
+	next   uint64
+}
+
+// newRoundRobinDialer resolves the addresses of host, of ipVersion if it
+// is "4" or "6".
+func newRoundRobinDialer(ctx context.Context, host, ipVersion string) (*roundRobinDialer, error) {
+	network := "ip"
+	if ipVersion == "4" || ipVersion == "6" {
+		network += ipVersion
+	}
+	ips, err := lookupIP(ctx, network, host)
+	if err != nil {
+		return nil, fmt.Errorf("requester: cannot resolve %s: %v", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("requester: %s has no address", host)
+	}
+	d := &roundRobinDialer{host: host, counts: make([]int64, len(ips))}
+	for _, ip := range ips {
+		d.addrs = append(d.addrs, ip.String())
+	}
+	return d, nil
+}
+
+// wrap returns a dial function dialing the addresses of the host in turn
+// with dial, and other hosts, such as those of redirects, as is.
+func (d *roundRobinDialer) wrap(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || host != d.host {
+			return dial(ctx, network, addr)
+		}
+		i := (atomic.AddUint64(&d.next, 1) - 1) % uint64(len(d.addrs))
+		atomic.AddInt64(&d.counts[i], 1)
+		return dial(ctx, network, net.JoinHostPort(d.addrs[i], port))
+	}
+}
+
+// dist returns the number of connections dialed to each address.
+func (d *roundRobinDialer) dist() map[string]int {
+	dist := make(map[string]int, len(d.addrs))
+	for i, a := range d.addrs {
+		dist[a] = int(atomic.LoadInt64(&d.counts[i]))
+	}
+	return dist
+}
+
+// printResolved prints the number of connections made to, and requests
+// answered by, each address of the host of a DNSRoundRobin run, so that
+// addresses left out stand out.
+func (r *report) printResolved() {
+	r.printf("\nResolved address distribution:\n")
+	for _, a := range r.resolved {
+		r.printf("  [%s]\t%d requests, %d connections\n", a, r.remoteIPDist[a], r.resolvedConns[a])
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubLookupIP makes lookupIP resolve every host to ips for the test.
+func stubLookupIP(t *testing.T, ips ...string) {
+	orig := lookupIP
+	t.Cleanup(func() { lookupIP = orig })
+	lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		var res []net.IP
+		for _, ip := range ips {
+			res = append(res, net.ParseIP(ip))
+		}
+		return res, nil
+	}
+}
+
+func TestDNSRoundRobin(t *testing.T) {
+	// Listen on every address, so that the whole loopback network
+	// reaches the server.
+	l, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Listener.Close()
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+	stubLookupIP(t, "127.0.0.1", "127.0.0.2", "127.0.0.3")
+
+	url := fmt.Sprintf("http://multi.test:%d/", l.Addr().(*net.TCPAddr).Port)
+	req, _ := http.NewRequest("GET", url, nil)
+	var out bytes.Buffer
+	w := &Work{Request: req, N: 30, C: 3, Writer: &out, DisableKeepAlives: true, DNSRoundRobin: true}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	r := w.report
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"} {
+		if r.remoteIPDist[ip] != 10 || r.resolvedConns[ip] != 10 {
+			t.Errorf("Expected 10 requests and connections to %s, found %v and %v", ip, r.remoteIPDist[ip], r.resolvedConns[ip])
+		}
+	}
+	if !strings.Contains(out.String(), "Resolved address distribution:\n  [127.0.0.1]\t10 requests, 10 connections") {
+		t.Errorf("Expected the resolved addresses in the summary, found %q", out.String())
+	}
+}
+
+func TestDNSRoundRobinUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	// The server only listens on 127.0.0.1, which the report shows the
+	// only address answering.
+	stubLookupIP(t, "127.0.0.1", "127.0.0.2")
+
+	url := strings.Replace(server.URL, "127.0.0.1", "multi.test", 1)
+	req, _ := http.NewRequest("GET", url, nil)
+	w := &Work{Request: req, N: 10, C: 1, Writer: &bytes.Buffer{}, DisableKeepAlives: true, DNSRoundRobin: true}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	r := w.report
+	if r.remoteIPDist["127.0.0.1"] != 5 || r.remoteIPDist["127.0.0.2"] != 0 || r.resolvedConns["127.0.0.2"] != 5 {
+		t.Errorf("Expected half the requests to fail on 127.0.0.2, found %v and %v", r.remoteIPDist, r.resolvedConns)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// sequenceFile records the requests of a run, in the order they are
+// prepared, as the lines of a URL file.
+type sequenceFile struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+	n  int // requests recorded
+}
+
+func newSequenceFile(path string) (*sequenceFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("requester: %v", err)
+	}
+	return &sequenceFile{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// record writes the line of req, whose body is body. Bodies that span
+// lines cannot be written in a URL file, so their requests are written
+// as comments.
+func (s *sequenceFile) record(req *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n++
+	line := req.Method + " " + req.URL.String()
+	if len(body) > 0 {
+		line += " " + string(body)
+	}
+	if bytes.ContainsAny(body, "\r\n") {
+		fmt.Fprintf(s.w, "# request %d has a body spanning lines: %s %s\n", s.n, req.Method, req.URL)
+		return
+	}
+	fmt.Fprintln(s.w, line)
+}
+
+func (s *sequenceFile) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,131 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDumpSequenceFile(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.URL.Path+" "+string(body))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	urls := filepath.Join(dir, "urls.txt")
+	lines := []string{server.URL + "/a", "POST " + server.URL + "/b {\"b\":1}", "PUT " + server.URL + "/c c", server.URL + "/d"}
+	if err := ioutil.WriteFile(urls, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(file string, random bool, dump string) []string {
+		seen = nil
+		req, _ := http.NewRequest("GET", "", nil)
+		w := &Work{
+			Request:          req,
+			N:                30,
+			C:                1,
+			URLFile:          file,
+			URLFileRandom:    random,
+			Seed:             42,
+			DumpSequenceFile: dump,
+			Reporter:         &recordingReporter{},
+		}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return append([]string(nil), seen...)
+	}
+
+	first := run(urls, true, filepath.Join(dir, "first.txt"))
+	second := run(urls, true, filepath.Join(dir, "second.txt"))
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same sequence with the same seed, found %v and %v", first, second)
+	}
+	a, _ := ioutil.ReadFile(filepath.Join(dir, "first.txt"))
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "second.txt"))
+	if len(a) == 0 || string(a) != string(b) {
+		t.Errorf("Expected the same dumped sequences, found %q and %q", a, b)
+	}
+	if n := strings.Count(string(a), "\n"); n != 30 {
+		t.Errorf("Expected 30 dumped requests, found %v", n)
+	}
+
+	// The dumped sequence replays the same requests.
+	replayed := run(filepath.Join(dir, "first.txt"), false, "")
+	if !reflect.DeepEqual(first, replayed) {
+		t.Errorf("Expected the replay of the dump to match, found %v and %v", first, replayed)
+	}
+
+	// Another seed picks another sequence.
+	req, _ := http.NewRequest("GET", "", nil)
+	seen = nil
+	w := &Work{Request: req, N: 30, C: 1, URLFile: urls, URLFileRandom: true, Seed: 7, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(first, seen) {
+		t.Errorf("Expected a different sequence with another seed, found %v", seen)
+	}
+}
+
+func TestDumpSequenceFileMultilineBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "sequence.txt")
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	w := &Work{Request: req, RequestBody: []byte("a\nb"), N: 2, C: 1, DumpSequenceFile: path, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# request 1 has a body spanning lines: POST " + server.URL + "\n# request 2 has a body spanning lines: POST " + server.URL + "\n"
+	if string(got) != want {
+		t.Errorf("Expected %q, found %q", want, got)
+	}
+}
+
+func TestDumpSequenceFileWriteError(t *testing.T) {
+	// Writes to /dev/full fail with ENOSPC once flushed.
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 5, C: 1, Writer: ioutil.Discard, DumpSequenceFile: "/dev/full"}
+	err := w.Run()
+	if err == nil || !strings.Contains(err.Error(), "cannot write /dev/full") {
+		t.Errorf("Expected the write error of the sequence file, found %v", err)
+	}
+}
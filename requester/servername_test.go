@@ -0,0 +1,97 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestServerName(t *testing.T) {
+	var mu sync.Mutex
+	var names, hosts []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+	}))
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			names = append(names, hello.ServerName)
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	// Connect to an IP address, send one name and ask for another host.
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Host = "host.example"
+	w := &Work{Request: req, N: 3, C: 1, ServerName: "sni.example", DisableKeepAlives: true, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sni.example", "sni.example", "sni.example"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected the server names %v, found %v", want, names)
+	}
+	if want := []string{"host.example", "host.example", "host.example"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("Expected the hosts %v, found %v", want, hosts)
+	}
+	if got := w.ServerNameDist(); !reflect.DeepEqual(got, map[string]int{"sni.example": 3}) {
+		t.Errorf("Expected 3 responses for sni.example, found %v", got)
+	}
+
+	// Without ServerName, no name is sent to an IP address.
+	w = &Work{Request: req, N: 1, C: 1, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.ServerNameDist(); !reflect.DeepEqual(got, map[string]int{"none": 1}) {
+		t.Errorf("Expected a response without a server name, found %v", got)
+	}
+}
+
+func TestServerNameVerified(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ca := writeTempFile(t, certPEM(server.Certificate().Raw))
+	defer os.Remove(ca)
+
+	// The certificate of the test server is valid for example.com only.
+	for name, failed := range map[string]int{"example.com": 0, "other.example": 2} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		rr := &recordingReporter{}
+		w := &Work{Request: req, N: 2, C: 1, CAFile: ca, ServerName: name, Reporter: rr}
+		if err := w.Run(); err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, res := range rr.results {
+			if res.Err != nil {
+				n++
+			}
+		}
+		if n != failed {
+			t.Errorf("%s: expected %v failed requests, found %v", name, failed, n)
+		}
+	}
+}
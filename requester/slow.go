@@ -0,0 +1,50 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// maxSlowCapture is the most of each response body kept for SlowThreshold
+// captures.
+const maxSlowCapture = 1 << 20
+
+// captureSlow writes the request and response of a request that took d,
+// over SlowThreshold, with the start of the response body, to a file of
+// SlowDumpDir.
+func (b *Work) captureSlow(req *http.Request, resp *http.Response, d time.Duration, body []byte) {
+	n := atomic.AddInt64(&b.slowSeq, 1)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\nDuration: %v\n\n", req.Method, req.URL, d)
+	fmt.Fprintf(&buf, "%s %s\n", resp.Proto, resp.Status)
+	resp.Header.Write(&buf)
+	buf.WriteString("\n")
+	buf.Write(body)
+	path := filepath.Join(b.SlowDumpDir, fmt.Sprintf("slow-%d.txt", n))
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		if b.logger != nil {
+			b.logger("error", "cannot write slow capture", map[string]interface{}{"path": path, "error": err})
+		}
+		return
+	}
+	atomic.AddInt64(&b.slowCaptures, 1)
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Header().Set("X-Backend", "b1")
+		w.Write([]byte("slow body"))
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "captures")
+	req, _ := http.NewRequest("GET", server.URL+"/?slow=1", nil)
+	w := &Work{Request: req, N: 3, C: 1, SlowThreshold: 50 * time.Millisecond, SlowDumpDir: dir, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "slow-*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 captures, found %v", files)
+	}
+	b, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"GET " + server.URL + "/?slow=1\n", "Duration: ", "HTTP/1.1 200 OK\n", "X-Backend: b1\r\n", "\nslow body"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Expected %q in the capture, found %q", want, b)
+		}
+	}
+	if w.report.slowCaptures != 3 {
+		t.Errorf("Expected 3 reported captures, found %v", w.report.slowCaptures)
+	}
+
+	dir = filepath.Join(t.TempDir(), "fast")
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	w = &Work{Request: req, N: 3, C: 1, SlowThreshold: time.Second, SlowDumpDir: dir, Reporter: &recordingReporter{}}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("Expected no captures of fast requests, found %v", files)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"sort"
+	"time"
+)
+
+// RunStats are the aggregate statistics of a run at some point in time.
+type RunStats struct {
+	// Requests is the number of completed requests, including errors.
+	Requests int64
+
+	// Errors is the number of requests that failed without a response.
+	Errors int64
+
+	// StatusCodes is the number of responses by status code.
+	StatusCodes map[int]int
+
+	// Elapsed is the time since the start of the run, or its total
+	// duration once it is finished.
+	Elapsed time.Duration
+
+	// RPS is the rate of completed requests per second.
+	RPS float64
+
+	// Latencies are the latencies of the successful requests at the 10th,
+	// 25th, 50th, 75th, 90th, 95th and 99th percentiles.
+	Latencies map[int]time.Duration
+
+	// Fastest, Slowest and Average are the shortest, longest and average
+	// latencies of the successful requests.
+	Fastest time.Duration
+	Slowest time.Duration
+	Average time.Duration
+
+	// Tags are the Tags of the run.
+	Tags map[string]string
+}
+
+// Snapshot returns the statistics of the run so far. It is safe to call
+// from any goroutine while Run is in progress, and returns the final
+// statistics once Run has returned. Before Run, it returns zero RunStats.
+func (b *Work) Snapshot() RunStats {
+	b.mu.Lock()
+	r := b.report
+	b.mu.Unlock()
+	if r == nil {
+		return RunStats{}
+	}
+	return r.snapshot()
+}
+
+func (r *report) snapshot() RunStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := RunStats{
+		Requests:    r.numRes,
+		StatusCodes: make(map[int]int, len(r.statusCodeDist)),
+		Elapsed:     r.total,
+		Tags:        r.tags,
+	}
+	for _, n := range r.errorDist {
+		s.Errors += int64(n)
+	}
+	for code, n := range r.statusCodeDist {
+		s.StatusCodes[code] = n
+	}
+	if s.Elapsed == 0 {
+		s.Elapsed = time.Now().Sub(r.start)
+	}
+	if s.Elapsed > 0 {
+		s.RPS = float64(s.Requests) / s.Elapsed.Seconds()
+	}
+	s.setLatencies(r.lats)
+	return s
+}
+
+// setLatencies sets the latencies of s from lats, in seconds, if any.
+func (s *RunStats) setLatencies(lats []float64) {
+	if len(lats) == 0 {
+		return
+	}
+	sorted := append([]float64(nil), lats...)
+	sort.Float64s(sorted)
+	s.Latencies = make(map[int]time.Duration, len(pctlsReported))
+	for _, p := range pctlsReported {
+		s.Latencies[p] = time.Duration(percentile(sorted, float64(p)) * float64(time.Second))
+	}
+	var sum float64
+	for _, l := range sorted {
+		sum += l
+	}
+	s.Fastest = time.Duration(sorted[0] * float64(time.Second))
+	s.Slowest = time.Duration(sorted[len(sorted)-1] * float64(time.Second))
+	s.Average = time.Duration(sum / float64(len(sorted)) * float64(time.Second))
+}
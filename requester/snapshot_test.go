@@ -0,0 +1,83 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request: req,
+		N:       200,
+		C:       4,
+		Writer:  ioutil.Discard,
+	}
+	if s := w.Snapshot(); s.Requests != 0 || s.StatusCodes != nil {
+		t.Errorf("Expected empty stats before Run, found %+v", s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.Run()
+		close(done)
+	}()
+	var last int64
+poll:
+	for {
+		select {
+		case <-done:
+			break poll
+		default:
+		}
+		s := w.Snapshot()
+		if s.Requests < last {
+			t.Errorf("Requests went back from %v to %v", last, s.Requests)
+		}
+		last = s.Requests
+		time.Sleep(time.Millisecond)
+	}
+
+	s := w.Snapshot()
+	if s.Requests != 200 {
+		t.Errorf("Expected 200 requests, found %v", s.Requests)
+	}
+	if s.Errors != 0 {
+		t.Errorf("Expected no errors, found %v", s.Errors)
+	}
+	if s.StatusCodes[200] != 200 {
+		t.Errorf("Expected 200 OK responses, found %v", s.StatusCodes[200])
+	}
+	if s.Latencies[50] <= 0 || s.Latencies[50] > s.Latencies[99] {
+		t.Errorf("Unexpected latency percentiles %v", s.Latencies)
+	}
+	if s.RPS <= 0 {
+		t.Errorf("Expected a positive rate, found %v", s.RPS)
+	}
+	if s.Fastest <= 0 || s.Fastest > s.Average || s.Average > s.Slowest {
+		t.Errorf("Unexpected fastest, average and slowest latencies %v, %v, %v", s.Fastest, s.Average, s.Slowest)
+	}
+}
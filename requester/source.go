@@ -0,0 +1,174 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// sourceDialer dials connections from each of a set of local addresses
+// in turn, or from any address if the set is empty.
+type sourceDialer struct {
+	addrs   []string
+	dialers []*net.Dialer
+	counts  []int64 // connections dialed from each address
+	next    uint64
+}
+
+// newSourceDialer returns a dialer from addrs, which must be IP
+// addresses of the host. With reuse, SO_REUSEADDR is set on the sockets.
+// An ipVersion of "4" or "6" restricts connections to that IP version.
+func newSourceDialer(addrs []string, reuse bool, ipVersion string) (*sourceDialer, error) {
+	d := &sourceDialer{addrs: addrs}
+	if len(addrs) == 0 {
+		d.dialers = []*net.Dialer{{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}}
+	}
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		if ip == nil {
+			return nil, fmt.Errorf("requester: invalid local address %q", a)
+		}
+		if (ipVersion == "4" && ip.To4() == nil) || (ipVersion == "6" && ip.To4() != nil) {
+			return nil, fmt.Errorf("requester: local address %s is not IPv%s", a, ipVersion)
+		}
+		local := &net.TCPAddr{IP: ip}
+		// Binding fails now for an address the host does not have,
+		// rather than with every dial.
+		l, err := net.ListenTCP("tcp", local)
+		if err != nil {
+			return nil, fmt.Errorf("requester: cannot bind local address %s: %v", a, err)
+		}
+		l.Close()
+		d.dialers = append(d.dialers, &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			LocalAddr: local,
+		})
+	}
+	if reuse {
+		for _, dialer := range d.dialers {
+			dialer.Control = reuseAddr
+		}
+	}
+	if ipVersion == "4" || ipVersion == "6" {
+		for _, dialer := range d.dialers {
+			dialer.Control = onlyIPVersion("tcp"+ipVersion, dialer.Control)
+		}
+	}
+	d.counts = make([]int64, len(d.dialers))
+	return d, nil
+}
+
+// pick returns the dialer of the next connection.
+func (d *sourceDialer) pick() *net.Dialer {
+	i := (atomic.AddUint64(&d.next, 1) - 1) % uint64(len(d.dialers))
+	atomic.AddInt64(&d.counts[i], 1)
+	return d.dialers[i]
+}
+
+// DialContext is used as the transports' dial function.
+func (d *sourceDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.pick().DialContext(ctx, network, addr)
+}
+
+// onlyIPVersion returns a dial control function refusing the addresses
+// of networks other than network, so that the dialer falls back to the
+// addresses of network, before calling next, if set.
+func onlyIPVersion(network string, next func(network, address string, c syscall.RawConn) error) func(string, string, syscall.RawConn) error {
+	return func(n, address string, c syscall.RawConn) error {
+		if n != network {
+			return fmt.Errorf("requester: %s is not an %s address", address, ipFamilyNames[network])
+		}
+		if next != nil {
+			return next(n, address, c)
+		}
+		return nil
+	}
+}
+
+// ipFamilyNames are the names of the IP versions of networks.
+var ipFamilyNames = map[string]string{"tcp4": "IPv4", "tcp6": "IPv6"}
+
+// ipFamily returns "IPv4" or "IPv6" for the IP version of addr, or an
+// empty string if it is not an IP address.
+func ipFamily(addr net.Addr) string {
+	a, ok := addr.(*net.TCPAddr)
+	switch {
+	case !ok:
+		return ""
+	case a.IP.To4() != nil:
+		return "IPv4"
+	default:
+		return "IPv6"
+	}
+}
+
+// ipAddress returns the IP address of addr, or an empty string if it is
+// not a TCP address.
+func ipAddress(addr net.Addr) string {
+	if a, ok := addr.(*net.TCPAddr); ok {
+		return a.IP.String()
+	}
+	return ""
+}
+
+// checkIPVersion returns an error if host has no address of ipVersion.
+func checkIPVersion(ctx context.Context, host, ipVersion string) error {
+	if ipVersion != "4" && ipVersion != "6" {
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip"+ipVersion, host)
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("requester: %s has no IPv%s address", host, ipVersion)
+	}
+	return nil
+}
+
+// dist returns the number of connections dialed from each address, or
+// nil if the set is empty.
+func (d *sourceDialer) dist() map[string]int {
+	if len(d.addrs) == 0 {
+		return nil
+	}
+	dist := make(map[string]int, len(d.addrs))
+	for i, a := range d.addrs {
+		if n := atomic.LoadInt64(&d.counts[i]); n > 0 {
+			dist[a] += int(n)
+		}
+	}
+	return dist
+}
+
+// dialContext returns the dial function of new connections, from
+// LocalAddrs in turn and with ReuseAddr if set, to the addresses of
+// DNSRoundRobin in turn, and limited by MaxBandwidth.
+func (b *Work) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	if b.source != nil {
+		dial = b.source.DialContext
+	}
+	if b.rrDialer != nil {
+		dial = b.rrDialer.wrap(dial)
+	}
+	if b.bandwidth != nil {
+		dial = b.bandwidth.wrap(dial)
+	}
+	return dial
+}
@@ -0,0 +1,124 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLocalAddrs(t *testing.T) {
+	// Every 127/8 address is bound to the loopback interface on Linux.
+	if l, err := net.Listen("tcp", "127.0.0.2:0"); err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	} else {
+		l.Close()
+	}
+	var mu sync.Mutex
+	sources := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		mu.Lock()
+		sources[host]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:           req,
+		N:                 10,
+		C:                 1,
+		DisableKeepAlives: true,
+		LocalAddrs:        []string{"127.0.0.1", "127.0.0.2"},
+		Writer:            &out,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if sources["127.0.0.1"] != 5 || sources["127.0.0.2"] != 5 {
+		t.Errorf("Expected 5 requests from each address, found %v", sources)
+	}
+	dist := w.SourceAddrDist()
+	if dist["127.0.0.1"] != 5 || dist["127.0.0.2"] != 5 {
+		t.Errorf("Expected 5 connections from each address, found %v", dist)
+	}
+	if !strings.Contains(out.String(), "Source address distribution:") {
+		t.Errorf("Expected the source addresses in the output, found %v", out.String())
+	}
+}
+
+func TestLocalAddrsInvalid(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://127.0.0.1", nil)
+	for _, addr := range []string{"localhost", "192.0.2.1"} {
+		w := &Work{Request: req, N: 1, C: 1, LocalAddrs: []string{addr}, Reporter: &recordingReporter{}}
+		if err := w.Run(); err == nil {
+			t.Errorf("Expected an error for local address %q", addr)
+		}
+	}
+}
+
+func TestReuseAddr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	rep := &recordingReporter{}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 4, C: 2, DisableKeepAlives: true, ReuseAddr: true, Reporter: rep}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range rep.results {
+		if res.Err != nil {
+			t.Errorf("Expected no error, found %v", res.Err)
+		}
+	}
+}
+
+func TestIPVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// localhost may resolve to ::1 first, which must be skipped for the
+	// IPv4 address the server listens on.
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", "http://localhost:"+port, nil)
+	w := &Work{Request: req, N: 4, C: 2, IPVersion: "4", Writer: &out}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.report.statusCodeDist[http.StatusOK] != 4 {
+		t.Errorf("Expected 4 responses, found %v and errors %v", w.report.statusCodeDist, w.report.errorDist)
+	}
+	if d := w.IPFamilyDist(); d["IPv6"] != 0 || d["IPv4"] == 0 {
+		t.Errorf("Expected IPv4 connections only, found %v", d)
+	}
+	if !strings.Contains(out.String(), "IP version distribution:\n  [IPv4]") {
+		t.Errorf("Expected the IP versions in the output, found %v", out.String())
+	}
+
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	w = &Work{Request: req, N: 1, C: 1, IPVersion: "6", Reporter: &recordingReporter{}}
+	if err := w.Run(); err == nil || !strings.Contains(err.Error(), "no IPv6 address") {
+		t.Errorf("Expected an error for an IPv4 host, found %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// streamContext returns the context of an SSE request, done when the
+// run is stopped or SSEMaxDuration has passed.
+func (b *Work) streamContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if b.SSEMaxDuration > 0 {
+		ctx, cancel = context.WithTimeout(b.ctx, b.SSEMaxDuration)
+	} else {
+		ctx, cancel = context.WithCancel(b.ctx)
+	}
+	stop := b.stopCh
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// readEvents reads a text/event-stream body until it ends and returns
+// the number of bytes read and the time each event was received. As
+// with EventSource, an event is dispatched by a blank line after at
+// least one data field; comments and events without data are ignored.
+func readEvents(body io.Reader) (int64, []time.Time) {
+	r := bufio.NewReader(body)
+	var n int64
+	var events []time.Time
+	data := false
+	for {
+		line, err := r.ReadBytes('\n')
+		n += int64(len(line))
+		if err != nil {
+			// An event not terminated by a blank line is not dispatched.
+			return n, events
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) == 0:
+			if data {
+				events = append(events, time.Now())
+			}
+			data = false
+		case bytes.Equal(line, []byte("data")) || bytes.HasPrefix(line, []byte("data:")):
+			data = true
+		}
+	}
+}
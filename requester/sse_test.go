@@ -0,0 +1,144 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadEvents(t *testing.T) {
+	stream := ": comment\n\n" +
+		"data: one\n\n" +
+		"event: update\r\ndata: two\r\ndata: lines\r\n\r\n" +
+		"id: 3\n\n" +
+		"data\n\n" +
+		"data: unterminated\n"
+	n, events := readEvents(strings.NewReader(stream))
+	if n != int64(len(stream)) {
+		t.Errorf("Expected %v bytes read, found %v", len(stream), n)
+	}
+	if len(events) != 3 {
+		t.Errorf("Expected 3 events, found %v", len(events))
+	}
+}
+
+// eventServer streams n events, interval apart, or forever if n is
+// negative.
+func eventServer(n int, interval time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i != n; i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(interval)
+		}
+	}))
+}
+
+func TestSSE(t *testing.T) {
+	server := eventServer(5, 20*time.Millisecond)
+	defer server.Close()
+
+	var out bytes.Buffer
+	rep := &recordingReporter{}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:  req,
+		N:        2,
+		C:        2,
+		SSE:      true,
+		Reporter: rep,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range rep.results {
+		if res.Events != 5 {
+			t.Errorf("Expected 5 events, found %v", res.Events)
+		}
+		if res.FirstEventDuration <= 0 || res.FirstEventDuration > res.Duration {
+			t.Errorf("Expected the first event within the request, found %v", res.FirstEventDuration)
+		}
+		if len(res.EventGaps) != 4 {
+			t.Fatalf("Expected 4 gaps, found %v", len(res.EventGaps))
+		}
+		for _, gap := range res.EventGaps {
+			if gap < 15*time.Millisecond {
+				t.Errorf("Expected gaps of about 20ms, found %v", gap)
+			}
+		}
+	}
+
+	w = &Work{Request: req, N: 2, C: 2, SSE: true, Writer: &out}
+	w.Run()
+	for _, want := range []string{"Server-sent events:", "Events:\t10", "Event gap distribution"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, found %v", want, out.String())
+		}
+	}
+}
+
+func TestSSEMaxDuration(t *testing.T) {
+	server := eventServer(-1, 10*time.Millisecond)
+	defer server.Close()
+
+	rep := &recordingReporter{}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:        req,
+		N:              2,
+		C:              1,
+		SSE:            true,
+		SSEMaxDuration: 100 * time.Millisecond,
+		Reporter:       rep,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range rep.results {
+		if res.Err != nil || res.Events == 0 {
+			t.Errorf("Expected events and no error, found %v events and %v", res.Events, res.Err)
+		}
+		if res.Duration > time.Second {
+			t.Errorf("Expected the stream to end after 100ms, found %v", res.Duration)
+		}
+	}
+}
+
+func TestSSEStop(t *testing.T) {
+	server := eventServer(-1, 10*time.Millisecond)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 1, C: 1, SSE: true, Reporter: &recordingReporter{}}
+	time.AfterFunc(100*time.Millisecond, w.Stop)
+	done := make(chan error)
+	go func() {
+		done <- w.Run()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Stop to end the stream")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+// maxStream is the size of the buffer of the Results channel.
+const maxStream = 1000
+
+// Results returns a channel that receives every result of the next Run
+// as it completes, for consumers that process results while the run is
+// in progress rather than from the report once it is done. It must be
+// called before Run, and each Run needs a new call. The channel is
+// closed when Run returns, even if it fails before making a request.
+//
+// Results are sent from the goroutine of the Reporter, so the channel
+// should be drained: a consumer that falls behind by more than the buffer
+// holds up the report and, once its buffer fills, the workers. Once the
+// run is stopped or its context canceled, results that do not fit the
+// buffer are dropped instead, so that Run still returns, and counted by
+// ResultsDropped.
+func (b *Work) Results() <-chan Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stream == nil {
+		b.stream = make(chan Result, maxStream)
+	}
+	return b.stream
+}
+
+// takeStream returns the channel of Results for this run, if any, and
+// clears it for the next.
+func (b *Work) takeStream() chan Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stream := b.stream
+	b.stream = nil
+	return stream
+}
+
+// ResultsDropped returns the number of results not sent to the channel
+// of Results for the consumer falling behind once the run was stopped.
+// It returns 0 before Run.
+func (b *Work) ResultsDropped() int {
+	b.mu.Lock()
+	r := b.report
+	b.mu.Unlock()
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// send sends res to the channel of Results, waiting for room in its
+// buffer until the run is stopped.
+func (r *report) send(res *Result) {
+	select {
+	case r.stream <- *res:
+		return
+	default:
+	}
+	select {
+	case r.stream <- *res:
+	case <-r.streamStop:
+		r.drop()
+	case <-r.streamCtx:
+		r.drop()
+	}
+}
+
+func (r *report) drop() {
+	r.mu.Lock()
+	r.dropped++
+	r.mu.Unlock()
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 2000, C: 4, Writer: ioutil.Discard}
+	results := w.Results()
+	done := make(chan int)
+	go func() {
+		var n int
+		for res := range results {
+			if res.StatusCode != 200 || res.Err != nil || res.Duration <= 0 {
+				t.Errorf("Unexpected result %+v", res)
+			}
+			n++
+		}
+		done <- n
+	}()
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-done; n != 2000 {
+		t.Errorf("Expected 2000 streamed results, found %v", n)
+	}
+
+	// The channel is for a single run.
+	if w.Results() == results {
+		t.Error("Expected a new channel for the next run")
+	}
+}
+
+func TestResultsInvalidConfig(t *testing.T) {
+	w := &Work{N: 1, C: 1}
+	results := w.Results()
+	if err := w.Run(); err == nil {
+		t.Fatal("Expected an error, found none")
+	}
+	if _, ok := <-results; ok {
+		t.Error("Expected the channel to be closed")
+	}
+}
+
+func TestResultsNotDrained(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{Request: req, N: 1000000, C: 4, Writer: ioutil.Discard}
+	// The results are never read.
+	w.Results()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- w.RunContext(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected the run to be canceled, found %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected RunContext to return once canceled")
+	}
+	if w.ResultsDropped() == 0 {
+		t.Error("Expected dropped results")
+	}
+}
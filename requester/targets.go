@@ -0,0 +1,281 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// target is a single request to make, overriding parts of Work.Request.
+type target struct {
+	method string
+	url    *url.URL
+	header http.Header
+	body   []byte
+
+	// wait is the recorded think time before this request.
+	wait time.Duration
+
+	// name is the Name of the Target, with Targets.
+	name string
+}
+
+// targetSource provides the targets workers draw their requests from.
+// Implementations must be safe for concurrent use.
+type targetSource interface {
+	next() (*target, error)
+	close() error
+}
+
+// parseTarget parses a URL file line of the form "[METHOD] URL [BODY]".
+func parseTarget(line string) (*target, error) {
+	fields := strings.Fields(line)
+	t := &target{}
+	raw := fields[0]
+	if !strings.Contains(raw, "://") {
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("missing URL in %q", line)
+		}
+		t.method = strings.ToUpper(fields[0])
+		raw = fields[1]
+		// The body is everything after the URL, as written.
+		rest := strings.TrimSpace(line)
+		rest = strings.TrimSpace(rest[len(fields[0]):])
+		rest = strings.TrimSpace(rest[len(fields[1]):])
+		if rest != "" {
+			t.body = []byte(rest)
+		}
+	} else if len(fields) > 1 {
+		return nil, fmt.Errorf("unexpected text after URL in %q", line)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q", raw)
+	}
+	t.url = u
+	return t, nil
+}
+
+// urlFileScanner reads targets from a URL file, skipping blank lines and
+// lines starting with '#'. It returns io.EOF at the end of the file.
+type urlFileScanner struct {
+	s    *bufio.Scanner
+	line int
+	at   time.Duration // offset of the last line with one
+}
+
+func (u *urlFileScanner) next() (*target, error) {
+	for u.s.Scan() {
+		u.line++
+		line := strings.TrimSpace(u.s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var at time.Duration
+		timed := strings.HasPrefix(line, "@")
+		if timed {
+			offset := strings.Fields(line)[0]
+			var err error
+			if at, err = time.ParseDuration(offset[1:]); err != nil || at < 0 {
+				return nil, fmt.Errorf("line %d: invalid offset %q", u.line, offset)
+			}
+			line = strings.TrimSpace(line[len(offset):])
+			if line == "" {
+				return nil, fmt.Errorf("line %d: missing URL", u.line)
+			}
+		}
+		t, err := parseTarget(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", u.line, err)
+		}
+		if timed {
+			if at > u.at {
+				t.wait = at - u.at
+			}
+			u.at = at
+		}
+		return t, nil
+	}
+	if err := u.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// newTargetSource opens the URL file at path. Sequential sources stream
+// the file and start over when its end is reached, so that large files
+// are never held in memory. Random sources load every target up front,
+// and pick them from seed, or from a random seed if it is zero.
+func newTargetSource(path string, random bool, seed int64) (targetSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// Scan the whole file once so that malformed lines are reported
+	// before the run begins.
+	var targets []*target
+	scan := &urlFileScanner{s: bufio.NewScanner(f)}
+	for {
+		t, err := scan.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if random {
+			targets = append(targets, t)
+		} else if targets == nil {
+			targets = []*target{t}
+		}
+	}
+	if len(targets) == 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s: no URLs found", path)
+	}
+	if random {
+		f.Close()
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		return &randomTargets{targets: targets, rng: rand.New(rand.NewSource(seed))}, nil
+	}
+	s := &streamTargets{f: f}
+	if err := s.rewind(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// streamTargets yields the targets of a URL file in order, looping.
+type streamTargets struct {
+	mu   sync.Mutex
+	f    *os.File
+	scan *urlFileScanner
+}
+
+func (s *streamTargets) rewind() error {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.scan = &urlFileScanner{s: bufio.NewScanner(s.f)}
+	return nil
+}
+
+func (s *streamTargets) next() (*target, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.scan.next()
+	if err == io.EOF {
+		if err := s.rewind(); err != nil {
+			return nil, err
+		}
+		t, err = s.scan.next()
+		if err == io.EOF {
+			return nil, errors.New("no URLs found")
+		}
+	}
+	return t, err
+}
+
+func (s *streamTargets) close() error {
+	return s.f.Close()
+}
+
+// listTargets yields a fixed list of targets in order, looping.
+type listTargets struct {
+	mu      sync.Mutex
+	targets []*target
+	i       int
+}
+
+func (l *listTargets) next() (*target, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t := l.targets[l.i]
+	l.i = (l.i + 1) % len(l.targets)
+	return t, nil
+}
+
+func (l *listTargets) close() error {
+	return nil
+}
+
+// repeatTargets yields each target of src factor times in a row, the
+// copies without think time, so that they are sent along with it.
+type repeatTargets struct {
+	src    targetSource
+	factor int
+
+	mu    sync.Mutex
+	copy  *target // the current target, without think time
+	left  int     // copies of it left to yield
+	drawn int64   // targets drawn from src
+}
+
+func (r *repeatTargets) next() (*target, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.left > 0 {
+		r.left--
+		return r.copy, nil
+	}
+	t, err := r.src.next()
+	if err != nil {
+		return nil, err
+	}
+	c := *t
+	c.wait = 0
+	r.copy, r.left = &c, r.factor-1
+	r.drawn++
+	return t, nil
+}
+
+func (r *repeatTargets) close() error {
+	return r.src.close()
+}
+
+// randomTargets yields targets chosen uniformly at random.
+type randomTargets struct {
+	targets []*target
+
+	mu  sync.Mutex // guards rng
+	rng *rand.Rand
+}
+
+func (r *randomTargets) next() (*target, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.targets[r.rng.Intn(len(r.targets))], nil
+}
+
+func (r *randomTargets) close() error {
+	return nil
+}
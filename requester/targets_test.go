@@ -0,0 +1,111 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "hey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		line, method, url, body string
+	}{
+		{"http://a.com/x?y=1", "", "http://a.com/x?y=1", ""},
+		{"post http://a.com/ {\"k\": \"v w\"}", "POST", "http://a.com/", "{\"k\": \"v w\"}"},
+		{"DELETE http://a.com/1", "DELETE", "http://a.com/1", ""},
+		{"PROPFIND http://a.com/dav <propfind/>", "PROPFIND", "http://a.com/dav", "<propfind/>"},
+	}
+	for _, tt := range tests {
+		tg, err := parseTarget(tt.line)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.line, err)
+			continue
+		}
+		if tg.method != tt.method || tg.url.String() != tt.url || string(tg.body) != tt.body {
+			t.Errorf("%q: got %q %q %q", tt.line, tg.method, tg.url, tg.body)
+		}
+	}
+	for _, line := range []string{"GET", "GET /relative", "http://a.com/ extra"} {
+		if _, err := parseTarget(line); err == nil {
+			t.Errorf("%q: expected an error, found none", line)
+		}
+	}
+}
+
+func TestURLFile(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		seen[fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, body)]++
+		mu.Unlock()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	path := writeTempFile(t, fmt.Sprintf(`# targets
+%[1]s/a
+
+POST %[1]s/b payload
+`, server.URL))
+	defer os.Remove(path)
+
+	req, _ := http.NewRequest("GET", "", nil)
+	w := &Work{
+		Request: req,
+		URLFile: path,
+		N:       10,
+		C:       1,
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := seen["GET /a "]; got != 5 {
+		t.Errorf("Expected 5 requests to /a, found %v", got)
+	}
+	if got := seen["POST /b payload"]; got != 5 {
+		t.Errorf("Expected 5 requests to /b, found %v", got)
+	}
+}
+
+func TestURLFileInvalid(t *testing.T) {
+	path := writeTempFile(t, "# only a comment\n")
+	defer os.Remove(path)
+
+	req, _ := http.NewRequest("GET", "", nil)
+	w := &Work{Request: req, URLFile: path, N: 1, C: 1}
+	if err := w.Run(); err == nil {
+		t.Errorf("Expected an error for a file without URLs")
+	}
+}
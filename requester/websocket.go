@@ -0,0 +1,165 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocket configures WebSocket connection testing, where each of the
+// N requests of the run opens a WebSocket connection, upgrading from the
+// request URL, and holds it rather than making an HTTP request.
+type WebSocket struct {
+	// Hold is how long each connection is held open once established.
+	// Connections the server closes earlier are reported as dropped.
+	Hold time.Duration
+
+	// Interval, if positive, makes each connection send Message every
+	// Interval while it is held. The time from each message sent to the
+	// next message received is reported as its round trip, as with an
+	// echo server.
+	Interval time.Duration
+
+	// Message is the text message sent every Interval.
+	Message []byte
+}
+
+// wsURL returns the WebSocket URL of u, whose scheme may be http, https,
+// ws or wss.
+func wsURL(u *url.URL) (*url.URL, error) {
+	ws := *u
+	switch u.Scheme {
+	case "http":
+		ws.Scheme = "ws"
+	case "https":
+		ws.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return nil, errors.New("requester: WebSocket requires an http, https, ws or wss URL")
+	}
+	return &ws, nil
+}
+
+// holdWebSocket opens a WebSocket connection, holds it as configured
+// and sends its result to the reporter. The handshake is reported as
+// the request: its duration, and its error if it failed.
+func (b *Work) holdWebSocket() {
+	u, _ := wsURL(b.Request.URL) // checked by validate
+	origin := *b.Request.URL
+	origin.Scheme = "http"
+	if u.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+	origin.Path, origin.RawPath, origin.RawQuery = "", "", ""
+	config := &websocket.Config{
+		Location:  u,
+		Origin:    &origin,
+		Version:   websocket.ProtocolVersionHybi13,
+		TlsConfig: b.tlsConfig(),
+		Header:    make(http.Header, len(b.Request.Header)),
+		Dialer:    &net.Dialer{Timeout: time.Duration(b.Timeout) * time.Second},
+	}
+	if b.source != nil {
+		d := *b.source.pick()
+		d.Timeout = config.Dialer.Timeout
+		config.Dialer = &d
+	}
+	for k, v := range b.Request.Header {
+		config.Header[k] = append([]string(nil), v...)
+	}
+	if config.Header.Get("User-Agent") == "" {
+		config.Header.Set("User-Agent", b.userAgent())
+	}
+	s := time.Now()
+	ws, err := config.DialContext(b.ctx)
+	if err != nil && b.ctx.Err() != nil {
+		// The run was canceled, not the handshake failed.
+		b.canceled()
+		return
+	}
+	res := &Result{URL: u.String(), Start: s, Duration: time.Now().Sub(s), Err: err}
+	if err == nil {
+		res.StatusCode = http.StatusSwitchingProtocols
+		res.WSRoundTrips, res.WSDropped = b.wsHold(ws)
+	}
+	b.results <- res
+}
+
+// wsHold holds ws for Hold, or until the run is stopped, sending
+// Message every Interval. It returns the round trips of the messages
+// and whether the server closed the connection first.
+func (b *Work) wsHold(ws *websocket.Conn) ([]time.Duration, bool) {
+	var mu sync.Mutex
+	var sent []time.Time // messages waiting for a reply
+	var rtts []time.Duration
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var msg []byte
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				return
+			}
+			mu.Lock()
+			if len(sent) > 0 {
+				rtts = append(rtts, time.Now().Sub(sent[0]))
+				sent = sent[1:]
+			}
+			mu.Unlock()
+		}
+	}()
+
+	var tick <-chan time.Time
+	if b.WebSocket.Interval > 0 {
+		ticker := time.NewTicker(b.WebSocket.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	hold := time.NewTimer(b.WebSocket.Hold)
+	defer hold.Stop()
+	dropped := false
+loop:
+	for {
+		select {
+		case <-tick:
+			mu.Lock()
+			sent = append(sent, time.Now())
+			mu.Unlock()
+			if err := websocket.Message.Send(ws, string(b.WebSocket.Message)); err != nil {
+				dropped = true
+				break loop
+			}
+		case <-closed:
+			dropped = true
+			break loop
+		case <-hold.C:
+			break loop
+		case <-b.stopCh:
+			break loop
+		}
+	}
+	ws.Close()
+	<-closed
+	mu.Lock()
+	defer mu.Unlock()
+	return rtts, dropped
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requester
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	defer server.Close()
+
+	rep := &recordingReporter{}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:  req,
+		N:        4,
+		C:        2,
+		Reporter: rep,
+		WebSocket: &WebSocket{
+			Hold:     200 * time.Millisecond,
+			Interval: 20 * time.Millisecond,
+			Message:  []byte("ping"),
+		},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.results) != 4 {
+		t.Fatalf("Expected 4 results, found %v", len(rep.results))
+	}
+	for _, res := range rep.results {
+		if res.Err != nil || res.StatusCode != http.StatusSwitchingProtocols {
+			t.Errorf("Expected an established connection, found %v %v", res.StatusCode, res.Err)
+		}
+		if res.WSDropped {
+			t.Errorf("Expected the connection to be held")
+		}
+		if len(res.WSRoundTrips) < 5 {
+			t.Errorf("Expected at least 5 round trips, found %v", len(res.WSRoundTrips))
+		}
+	}
+}
+
+func TestWebSocketDropped(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	rep := &recordingReporter{}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:   req,
+		N:         2,
+		C:         2,
+		Reporter:  rep,
+		WebSocket: &WebSocket{Hold: time.Minute},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range rep.results {
+		if !res.WSDropped {
+			t.Errorf("Expected the connection to be dropped")
+		}
+	}
+}
+
+func TestWebSocketHandshakeFailure(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	var out bytes.Buffer
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	w := &Work{
+		Request:   req,
+		N:         3,
+		C:         1,
+		Writer:    &out,
+		WebSocket: &WebSocket{Hold: time.Second},
+	}
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Established:\t0 of 3", "Handshake failures:\t3", "Dropped:\t0"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, found %v", want, out.String())
+		}
+	}
+}